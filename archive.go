@@ -0,0 +1,329 @@
+package linguist
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// ArchiveSeparator separates an archive path from the path of an entry inside it
+const ArchiveSeparator = "!/"
+
+const (
+	// DefaultArchiveMaxDepth is the default number of nested archives that will be opened
+	DefaultArchiveMaxDepth = 3
+	// DefaultArchiveMaxTotalSize is the default limit of uncompressed bytes read from an archive
+	DefaultArchiveMaxTotalSize = 1 << 30
+	// DefaultArchiveMaxEntries is the default limit of entries read from an archive
+	DefaultArchiveMaxEntries = 100000
+)
+
+var (
+	// ErrArchiveTooLarge is returned when the uncompressed archive contents exceed MaxTotalSize
+	ErrArchiveTooLarge = errors.New("linguist: archive exceeds maximum total size")
+	// ErrArchiveTooManyEntries is returned when the archive contains more than MaxEntries entries
+	ErrArchiveTooManyEntries = errors.New("linguist: archive exceeds maximum number of entries")
+	// ErrNotArchive is returned when the body is not a supported archive format
+	ErrNotArchive = errors.New("linguist: not a supported archive")
+)
+
+// ArchiveOptions controls how archives are scanned. The zero value uses the defaults.
+type ArchiveOptions struct {
+	// MaxDepth is the number of levels of nested archives which will be opened, so 1 opens the
+	// archives inside the scanned archive but not the archives inside those
+	MaxDepth int
+	// MaxTotalSize is the maximum number of uncompressed bytes across all entries, including nested archives
+	MaxTotalSize int64
+	// MaxEntries is the maximum number of entries across all archives, including nested archives
+	MaxEntries int
+}
+
+func (o *ArchiveOptions) withDefaults() ArchiveOptions {
+	var opts ArchiveOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = DefaultArchiveMaxDepth
+	}
+	if opts.MaxTotalSize <= 0 {
+		opts.MaxTotalSize = DefaultArchiveMaxTotalSize
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = DefaultArchiveMaxEntries
+	}
+	return opts
+}
+
+// ArchiveEntry is the detection result for a single file inside an archive. A nested archive
+// which can't be read is reported as an entry with the error in Result.Message, after any of
+// its entries which were read before the error.
+type ArchiveEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Result Result `json:"result"`
+}
+
+type archiveFormat int
+
+const (
+	formatNone archiveFormat = iota
+	formatZip
+	formatTar
+	formatTarGzip
+	formatTarBzip2
+)
+
+var archiveExtensions = map[string]archiveFormat{
+	".zip":     formatZip,
+	".jar":     formatZip,
+	".war":     formatZip,
+	".ear":     formatZip,
+	".aar":     formatZip,
+	".tar":     formatTar,
+	".tgz":     formatTarGzip,
+	".tar.gz":  formatTarGzip,
+	".tbz":     formatTarBzip2,
+	".tbz2":    formatTarBzip2,
+	".tar.bz2": formatTarBzip2,
+}
+
+func archiveFormatByName(filename string) archiveFormat {
+	name := strings.ToLower(path.Base(filename))
+	for {
+		i := strings.Index(name, ".")
+		if i < 0 {
+			return formatNone
+		}
+		if f, ok := archiveExtensions[name[i:]]; ok {
+			return f
+		}
+		name = name[i+1:]
+	}
+}
+
+func archiveFormatByContent(header []byte) archiveFormat {
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return formatZip
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return formatTarGzip
+	case bytes.HasPrefix(header, []byte("BZh")):
+		return formatTarBzip2
+	case len(header) >= 262 && bytes.Equal(header[257:262], []byte("ustar")):
+		return formatTar
+	}
+	return formatNone
+}
+
+// IsArchive returns true if the filename looks like an archive which can be scanned with ScanArchive
+func IsArchive(filename string) bool {
+	return archiveFormatByName(filename) != formatNone
+}
+
+type archiveScanner struct {
+	ctx     context.Context
+	opts    ArchiveOptions
+	fn      func(ArchiveEntry) error
+	total   int64
+	entries int
+}
+
+// archiveReadError is an error reading a corrupt or truncated archive
+type archiveReadError struct {
+	error
+}
+
+// readError returns an archiveReadError for err, unless the scan stopped because of the limits or ctx
+func (s *archiveScanner) readError(err error, format string, args ...interface{}) error {
+	if s.total > s.opts.MaxTotalSize {
+		return ErrArchiveTooLarge
+	}
+	if ctxErr := s.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return archiveReadError{fmt.Errorf(format+": %v", append(args, err)...)}
+}
+
+// archiveReader counts the uncompressed bytes read from an archive. A tar stream is counted as a
+// whole, as skipping the rest of an entry still decompresses it.
+type archiveReader struct {
+	s *archiveScanner
+	r io.Reader
+}
+
+func (r *archiveReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.s.total += int64(n)
+	if r.s.total > r.s.opts.MaxTotalSize {
+		return n, ErrArchiveTooLarge
+	}
+	return n, err
+}
+
+// ScanArchive streams the entries of a zip, tar, tar.gz or tar.bz2 archive and calls fn with
+// the detection result of each file. Entries are reported with a virtual path such as
+// bundle.zip!/src/main.go. Nested archives are opened up to opts.MaxDepth.
+func ScanArchive(ctx context.Context, filename string, r io.Reader, opts *ArchiveOptions, fn func(ArchiveEntry) error) error {
+	s := &archiveScanner{ctx: ctx, opts: opts.withDefaults(), fn: fn}
+	return s.scan(filename, bufio.NewReader(r), 0)
+}
+
+// GetArchiveDetails returns the detection results for all files inside an archive body
+func GetArchiveDetails(ctx context.Context, filename string, body []byte, opts *ArchiveOptions) ([]ArchiveEntry, error) {
+	entries := make([]ArchiveEntry, 0)
+	err := ScanArchive(ctx, filename, bytes.NewReader(body), opts, func(e ArchiveEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// scan returns ErrNotArchive without consuming br if the content isn't a supported archive
+func (s *archiveScanner) scan(name string, br *bufio.Reader, depth int) error {
+	header, _ := br.Peek(512)
+	format := archiveFormatByContent(header)
+	byName := archiveFormatByName(name)
+	if format == formatNone && byName == formatTar {
+		// old style tar headers don't carry a magic number
+		format = formatTar
+	}
+	if (format == formatTarGzip || format == formatTarBzip2) && byName == formatNone {
+		// a compressed stream that isn't a tarball
+		return ErrNotArchive
+	}
+	switch format {
+	case formatZip:
+		return s.scanZip(name, br, depth)
+	case formatTar:
+		return s.scanTar(name, br, depth)
+	case formatTarGzip:
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return s.readError(err, "error opening %s", name)
+		}
+		defer gz.Close()
+		return s.scanTar(name, gz, depth)
+	case formatTarBzip2:
+		return s.scanTar(name, bzip2.NewReader(br), depth)
+	}
+	return ErrNotArchive
+}
+
+func (s *archiveScanner) scanZip(name string, r io.Reader, depth int) error {
+	// zip needs random access to the central directory so the compressed
+	// archive is buffered, bounded by the total size limit
+	buf, err := s.readLimited(name, r, s.opts.MaxTotalSize)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		return s.readError(err, "error opening %s", name)
+	}
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		if err := s.count(); err != nil {
+			return err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return s.readError(err, "error opening %s%s%s", name, ArchiveSeparator, f.Name)
+		}
+		err = s.entry(name, f.Name, int64(f.UncompressedSize64), &archiveReader{s, rc}, depth)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *archiveScanner) scanTar(name string, r io.Reader, depth int) error {
+	tr := tar.NewReader(&archiveReader{s, r})
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return s.readError(err, "error reading %s", name)
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		if err := s.count(); err != nil {
+			return err
+		}
+		if err := s.entry(name, hdr.Name, hdr.Size, tr, depth); err != nil {
+			return err
+		}
+	}
+}
+
+// count accounts for a new entry against the archive limits. The size of an entry is counted
+// by archiveReader as it's decompressed, as the sizes in the archive headers can't be trusted.
+func (s *archiveScanner) count() error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	s.entries++
+	if s.entries > s.opts.MaxEntries {
+		return ErrArchiveTooManyEntries
+	}
+	return nil
+}
+
+// readLimited reads the archive name from r fully, failing if more than limit bytes are produced
+func (s *archiveScanner) readLimited(name string, r io.Reader, limit int64) ([]byte, error) {
+	buf, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, s.readError(err, "error reading %s", name)
+	}
+	if int64(len(buf)) > limit {
+		return nil, ErrArchiveTooLarge
+	}
+	return buf, nil
+}
+
+// entry detects the file name of archive, read from r which counts towards the total size
+func (s *archiveScanner) entry(archive, name string, size int64, r io.Reader, depth int) error {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	vpath := archive + ArchiveSeparator + name
+	br := bufio.NewReader(io.LimitReader(r, size))
+	if depth < s.opts.MaxDepth && IsArchive(name) {
+		err := s.scan(vpath, br, depth+1)
+		if _, ok := err.(archiveReadError); ok {
+			// a corrupt nested archive doesn't stop the scan of the archive containing it
+			return s.fn(ArchiveEntry{Path: vpath, Size: size, Result: Result{Message: err.Error()}})
+		}
+		if err != ErrNotArchive {
+			return err
+		}
+	}
+	// only read enough of the entry to classify it and decide if it's large
+	body, err := ioutil.ReadAll(io.LimitReader(br, readLimit(name)))
+	if err != nil {
+		return s.readError(err, "error reading %s", vpath)
+	}
+	result, err := GetLanguageDetails(s.ctx, name, body)
+	if err != nil {
+		return err
+	}
+	if result.Result != nil {
+		result.Result.Path = vpath
+	}
+	return s.fn(ArchiveEntry{Path: vpath, Size: size, Result: result})
+}
@@ -0,0 +1,219 @@
+package linguist
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeZip(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, body := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(body)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func makeTarGz(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	for name, body := range files {
+		if err := w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		w.Write(body)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return buf.Bytes()
+}
+
+func archiveLanguages(entries []ArchiveEntry) map[string]string {
+	langs := make(map[string]string)
+	for _, e := range entries {
+		if e.Result.Result != nil {
+			langs[e.Path] = e.Result.Result.Language.Name
+		} else {
+			langs[e.Path] = ""
+		}
+	}
+	return langs
+}
+
+func TestIsArchive(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(IsArchive("bundle.zip"))
+	assert.True(IsArchive("lib/foo-1.0.jar"))
+	assert.True(IsArchive("foo.tar.gz"))
+	assert.True(IsArchive("foo-1.2.TGZ"))
+	assert.True(IsArchive("foo.tar.bz2"))
+	assert.False(IsArchive("foo.gz"))
+	assert.False(IsArchive("foo.go"))
+}
+
+func TestScanArchiveZip(t *testing.T) {
+	assert := assert.New(t)
+	buf := makeZip(t, map[string][]byte{
+		"src/main.go":  []byte("package main\nfunc main(){\n}\n"),
+		"web/index.js": []byte("var a = 1\n"),
+		"image.png":    []byte("\x89PNG\r\n\x1a\n\x00\x00"),
+	})
+	entries, err := GetArchiveDetails(context.Background(), "bundle.zip", buf, nil)
+	assert.NoError(err)
+	assert.Len(entries, 3)
+	langs := archiveLanguages(entries)
+	assert.Equal("Go", langs["bundle.zip!/src/main.go"])
+	assert.Equal("JavaScript", langs["bundle.zip!/web/index.js"])
+	assert.Equal("", langs["bundle.zip!/image.png"])
+	for _, e := range entries {
+		if e.Result.Result != nil {
+			assert.Equal(e.Path, e.Result.Result.Path)
+		}
+	}
+}
+
+func TestScanArchiveTarGz(t *testing.T) {
+	assert := assert.New(t)
+	buf := makeTarGz(t, map[string][]byte{
+		"./pkg/foo.rb": []byte("print \"hello\"\n"),
+	})
+	entries, err := GetArchiveDetails(context.Background(), "bundle.tgz", buf, nil)
+	assert.NoError(err)
+	assert.Len(entries, 1)
+	assert.Equal("bundle.tgz!/pkg/foo.rb", entries[0].Path)
+	assert.Equal("Ruby", entries[0].Result.Result.Language.Name)
+}
+
+func TestScanArchiveTarBzip2(t *testing.T) {
+	assert := assert.New(t)
+	buf, err := ioutil.ReadFile("./testdata/bundle.tar.bz2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := GetArchiveDetails(context.Background(), "bundle.tar.bz2", buf, nil)
+	assert.NoError(err)
+	langs := archiveLanguages(entries)
+	assert.Len(langs, 2)
+	assert.Equal("Go", langs["bundle.tar.bz2!/src/main.go"])
+	assert.Equal("Python", langs["bundle.tar.bz2!/lib/util.py"])
+}
+
+func TestScanArchiveNested(t *testing.T) {
+	assert := assert.New(t)
+	inner := makeZip(t, map[string][]byte{
+		"com/foo/Bar.java": []byte("package foo;\npublic class Bar\n{\n}\n"),
+	})
+	outer := makeTarGz(t, map[string][]byte{
+		"lib/foo.jar": inner,
+		"main.go":     []byte("package main\n"),
+	})
+	entries, err := GetArchiveDetails(context.Background(), "bundle.tar.gz", outer, nil)
+	assert.NoError(err)
+	langs := archiveLanguages(entries)
+	assert.Len(langs, 2)
+	assert.Equal("Java", langs["bundle.tar.gz!/lib/foo.jar!/com/foo/Bar.java"])
+	assert.Equal("Go", langs["bundle.tar.gz!/main.go"])
+
+	// MaxDepth 1 opens the archives in the scanned archive, and reports the archives inside those as entries
+	innermost := makeZip(t, map[string][]byte{"c.rb": []byte("puts 1\n")})
+	middle := makeZip(t, map[string][]byte{"b.zip": innermost, "b.py": []byte("import os\n")})
+	top := makeZip(t, map[string][]byte{"a.zip": middle})
+	entries, err = GetArchiveDetails(context.Background(), "top.zip", top, &ArchiveOptions{MaxDepth: 1})
+	assert.NoError(err)
+	langs = archiveLanguages(entries)
+	assert.Len(langs, 2)
+	assert.Equal("Python", langs["top.zip!/a.zip!/b.py"])
+	name, ok := langs["top.zip!/a.zip!/b.zip"]
+	assert.True(ok)
+	assert.Equal("", name)
+	entries, err = GetArchiveDetails(context.Background(), "top.zip", top, &ArchiveOptions{MaxDepth: 2})
+	assert.NoError(err)
+	assert.Equal("Ruby", archiveLanguages(entries)["top.zip!/a.zip!/b.zip!/c.rb"])
+}
+
+func TestScanArchiveLimits(t *testing.T) {
+	assert := assert.New(t)
+	buf := makeZip(t, map[string][]byte{
+		"a.go": bytes.Repeat([]byte("a"), 1000),
+		"b.go": bytes.Repeat([]byte("b"), 1000),
+		"c.go": bytes.Repeat([]byte("c"), 1000),
+	})
+	_, err := GetArchiveDetails(context.Background(), "bomb.zip", buf, &ArchiveOptions{MaxTotalSize: 1500})
+	assert.Equal(ErrArchiveTooLarge, err)
+	_, err = GetArchiveDetails(context.Background(), "bomb.zip", buf, &ArchiveOptions{MaxEntries: 2})
+	assert.Equal(ErrArchiveTooManyEntries, err)
+
+	// the part of an entry which isn't read to detect it still counts
+	bomb := makeTarGz(t, map[string][]byte{"a.txt": bytes.Repeat([]byte{0}, 4<<20)})
+	assert.True(len(bomb) < 1<<20)
+	_, err = GetArchiveDetails(context.Background(), "bomb.tar.gz", bomb, &ArchiveOptions{MaxTotalSize: 1 << 20})
+	assert.Equal(ErrArchiveTooLarge, err)
+	_, err = GetArchiveDetails(context.Background(), "bomb.tar.gz", bomb, &ArchiveOptions{MaxTotalSize: 8 << 20})
+	assert.NoError(err)
+}
+
+func TestScanArchiveNotArchive(t *testing.T) {
+	_, err := GetArchiveDetails(context.Background(), "foo.gz", []byte("hello"), nil)
+	assert.Equal(t, ErrNotArchive, err)
+}
+
+func TestScanArchiveCorruptNested(t *testing.T) {
+	assert := assert.New(t)
+	truncated := makeTarGz(t, map[string][]byte{
+		"a.go": bytes.Repeat([]byte("package a\n"), 1000),
+	})
+	outer := makeTarGz(t, map[string][]byte{
+		"lib/bad.zip":    []byte("PK\x03\x04 this isn't a zip"),
+		"lib/bad.tar.gz": truncated[:len(truncated)/2],
+		"main.go":        []byte("package main\n"),
+	})
+	entries, err := GetArchiveDetails(context.Background(), "bundle.tar.gz", outer, nil)
+	assert.NoError(err)
+	langs := archiveLanguages(entries)
+	assert.Len(langs, 3)
+	assert.Equal("Go", langs["bundle.tar.gz!/main.go"])
+	for _, e := range entries {
+		if e.Path != "bundle.tar.gz!/main.go" {
+			assert.False(e.Result.Success)
+			assert.Contains(e.Result.Message, e.Path)
+		}
+	}
+
+	// the outer archive being corrupt is still an error
+	_, err = GetArchiveDetails(context.Background(), "bundle.tar.gz", outer[:len(outer)/2], nil)
+	assert.Error(err)
+}
+
+func TestScanArchiveLimitsNested(t *testing.T) {
+	assert := assert.New(t)
+	inner := makeTarGz(t, map[string][]byte{
+		"a.go": bytes.Repeat([]byte("a"), 1000),
+		"b.go": bytes.Repeat([]byte("b"), 1000),
+	})
+	outer := makeZip(t, map[string][]byte{
+		"lib/inner.tgz": inner,
+	})
+	// the bytes read from the nested archive count towards the limit, and aren't reported as a corrupt entry
+	_, err := GetArchiveDetails(context.Background(), "bundle.zip", outer, &ArchiveOptions{MaxTotalSize: 1500})
+	assert.Equal(ErrArchiveTooLarge, err)
+	entries, err := GetArchiveDetails(context.Background(), "bundle.zip", outer, &ArchiveOptions{MaxTotalSize: 4096})
+	assert.NoError(err)
+	assert.Len(entries, 2)
+}
@@ -0,0 +1,298 @@
+package linguist
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jbrukh/bayesian"
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+	"github.com/jhaynie/linguist/generaltso/linguist/data"
+)
+
+// DefaultMemoryCacheSize is the default number of results kept by a MemoryCache
+const DefaultMemoryCacheSize = 10000
+
+const memoryCacheShards = 16
+
+// CacheStats are the statistics of a Cache
+type CacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int64 `json:"entries"`
+	// Size is the number of bytes used by the cache, if known
+	Size int64 `json:"size,omitempty"`
+	// Languages counts the hits by detected language, if known
+	Languages map[string]int64 `json:"languages,omitempty"`
+}
+
+// Cache stores detection results by key. A Detector computes keys from the filename, the
+// contents and the version of its rules and classifier, so a Cache only needs to store them.
+//
+// Implementations must be safe for concurrent use. Errors returned by a Cache are treated
+// as a cache miss by the Detector, so a failing backend never fails detection.
+type Cache interface {
+	// Get returns the result stored for key, or false if there isn't one
+	Get(key string) (*Result, bool, error)
+	// Put stores the result for key
+	Put(key string, result Result) error
+	// Delete removes the result stored for key
+	Delete(key string) error
+	// Stats returns the statistics of the cache
+	Stats() CacheStats
+}
+
+// copyResult returns a copy of the result which doesn't share its Detection
+func copyResult(r Result) Result {
+	if r.Result != nil {
+		d := *r.Result
+		if d.Language != nil {
+			l := *d.Language
+			d.Language = &l
+		}
+		r.Result = &d
+	}
+	return r
+}
+
+func resultLanguage(r *Result) string {
+	if r.Result != nil && r.Result.Language != nil {
+		return r.Result.Language.Name
+	}
+	return ""
+}
+
+// MemoryCache is an in-memory Cache which evicts the least recently used results. It is
+// split into shards with their own locks so that concurrent detections don't contend.
+type MemoryCache struct {
+	shards []*memoryShard
+	hits   int64
+	misses int64
+}
+
+type memoryShard struct {
+	mu        sync.Mutex
+	capacity  int
+	ll        *list.List
+	items     map[string]*list.Element
+	languages map[string]int64
+}
+
+type memoryEntry struct {
+	key    string
+	result Result
+}
+
+// NewMemoryCache returns a MemoryCache which holds up to size results, or DefaultMemoryCacheSize if size is 0
+func NewMemoryCache(size int) *MemoryCache {
+	if size <= 0 {
+		size = DefaultMemoryCacheSize
+	}
+	capacity := (size + memoryCacheShards - 1) / memoryCacheShards
+	c := &MemoryCache{shards: make([]*memoryShard, memoryCacheShards)}
+	for i := range c.shards {
+		c.shards[i] = &memoryShard{
+			capacity:  capacity,
+			ll:        list.New(),
+			items:     make(map[string]*list.Element),
+			languages: make(map[string]int64),
+		}
+	}
+	return c
+}
+
+func (c *MemoryCache) shard(key string) *memoryShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return c.shards[h.Sum32()%uint32(len(c.shards))]
+}
+
+// Get returns the result stored for key
+func (c *MemoryCache) Get(key string) (*Result, bool, error) {
+	s := c.shard(key)
+	s.mu.Lock()
+	e, ok := s.items[key]
+	if !ok {
+		s.mu.Unlock()
+		atomic.AddInt64(&c.misses, 1)
+		return nil, false, nil
+	}
+	s.ll.MoveToFront(e)
+	r := copyResult(e.Value.(*memoryEntry).result)
+	if l := resultLanguage(&r); l != "" {
+		s.languages[l]++
+	}
+	s.mu.Unlock()
+	atomic.AddInt64(&c.hits, 1)
+	return &r, true, nil
+}
+
+// Put stores the result for key, evicting the least recently used result if the cache is full
+func (c *MemoryCache) Put(key string, result Result) error {
+	result = copyResult(result)
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		e.Value.(*memoryEntry).result = result
+		s.ll.MoveToFront(e)
+		return nil
+	}
+	s.items[key] = s.ll.PushFront(&memoryEntry{key, result})
+	if s.ll.Len() > s.capacity {
+		oldest := s.ll.Back()
+		s.ll.Remove(oldest)
+		delete(s.items, oldest.Value.(*memoryEntry).key)
+		metrics().Cache(CacheEvict)
+	}
+	return nil
+}
+
+// Delete removes the result stored for key
+func (c *MemoryCache) Delete(key string) error {
+	s := c.shard(key)
+	s.mu.Lock()
+	if e, ok := s.items[key]; ok {
+		s.ll.Remove(e)
+		delete(s.items, key)
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Stats returns the statistics of the cache
+func (c *MemoryCache) Stats() CacheStats {
+	stats := CacheStats{
+		Hits:      atomic.LoadInt64(&c.hits),
+		Misses:    atomic.LoadInt64(&c.misses),
+		Languages: make(map[string]int64),
+	}
+	for _, s := range c.shards {
+		s.mu.Lock()
+		stats.Entries += int64(s.ll.Len())
+		for l, n := range s.languages {
+			stats.Languages[l] += n
+		}
+		s.mu.Unlock()
+	}
+	return stats
+}
+
+// Reset removes all results and zeroes the statistics
+func (c *MemoryCache) Reset() {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		s.ll.Init()
+		s.items = make(map[string]*list.Element)
+		s.languages = make(map[string]int64)
+		s.mu.Unlock()
+	}
+	atomic.StoreInt64(&c.hits, 0)
+	atomic.StoreInt64(&c.misses, 0)
+}
+
+// contentKey returns a hash of the filename and contents of a file
+func contentKey(filename string, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, filename)
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+var (
+	embeddedVersion     string
+	embeddedVersionOnce sync.Once
+)
+
+// modelVersion returns a hash of the classifier's learned data, which is the same for equal
+// classifiers in every process. The number of documents seen isn't part of it, since scoring
+// a document changes it.
+func modelVersion(classifier *bayesian.Classifier) string {
+	if classifier == generaltso.DefaultClassifier() {
+		// the embedded asset never changes, so hashing it once is enough and much faster
+		embeddedVersionOnce.Do(func() {
+			if asset, err := data.Asset("classifier"); err == nil {
+				sum := sha256.Sum256(asset)
+				embeddedVersion = hex.EncodeToString(sum[:])
+			}
+		})
+		if embeddedVersion != "" {
+			return embeddedVersion
+		}
+	}
+	model, err := decodeClassifier(classifier)
+	if err != nil {
+		return ""
+	}
+	// gob encodes maps in random order, so hash the words in sorted order
+	h := sha256.New()
+	fmt.Fprintf(h, "%d %v\n", model.Learned, model.TfIdf)
+	for _, class := range model.Classes {
+		cd := model.Datas[class]
+		if cd == nil {
+			continue
+		}
+		fmt.Fprintf(h, "%s %d\n", class, cd.Total)
+		words := make([]string, 0, len(cd.Freqs))
+		for w := range cd.Freqs {
+			words = append(words, w)
+		}
+		sort.Strings(words)
+		for _, w := range words {
+			fmt.Fprintf(h, "%q %v\n", w, cd.Freqs[w])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// rulesetGeneration is incremented whenever the exclusion, vendor, documentation, test file or preoptimization rules or the binary signatures change
+var rulesetGeneration int64
+
+// rulesetVersion returns a hash of the exclusion, vendor, documentation and test file rules, binary signatures, language overrides and preoptimization rules
+func rulesetVersion() string {
+	h := sha256.New()
+	keys := func(m map[string]bool) []string {
+		s := make([]string, 0, len(m))
+		for k := range m {
+			s = append(s, k)
+		}
+		sort.Strings(s)
+		return s
+	}
+	fmt.Fprintln(h, keys(excludeExtensions))
+	fmt.Fprintln(h, keys(excludedFilenames))
+	for _, r := range excludedRules {
+		fmt.Fprintln(h, r.String())
+	}
+	for _, s := range Signatures() {
+		fmt.Fprintln(h, s.String())
+	}
+	for _, r := range vendorRules {
+		fmt.Fprintln(h, "vendored", r.String())
+	}
+	for _, r := range documentationRules {
+		fmt.Fprintln(h, "documentation", r.String())
+	}
+	fmt.Fprintln(h, isDocumentationExcluded())
+	fmt.Fprintln(h, testFileRulesVersion())
+	fmt.Fprintln(h, "data", generaltso.CurrentData().Version())
+	overrides := make([]string, 0, len(languageOverrides))
+	for language, exts := range languageOverrides {
+		for ext, l := range exts {
+			overrides = append(overrides, language+ext+l)
+		}
+	}
+	sort.Strings(overrides)
+	fmt.Fprintln(h, overrides)
+	for _, r := range PreoptimizationRules() {
+		fmt.Fprintln(h, r.String())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,111 @@
+package linguist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryCache(t *testing.T) {
+	assert := assert.New(t)
+	c := NewMemoryCache(memoryCacheShards)
+	result := Result{Success: true, Result: &Detection{Path: "foo.go", Language: &Language{Name: "Go"}}}
+	assert.NoError(c.Put("a", result))
+	r, ok, err := c.Get("a")
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal("Go", r.Result.Language.Name)
+	// results are copies which can't change the cache
+	r.Result.Language.Name = "C"
+	result.Result.Language.Name = "C"
+	r, _, _ = c.Get("a")
+	assert.Equal("Go", r.Result.Language.Name)
+	_, ok, _ = c.Get("b")
+	assert.False(ok)
+
+	stats := c.Stats()
+	assert.Equal(int64(2), stats.Hits)
+	assert.Equal(int64(1), stats.Misses)
+	assert.Equal(int64(1), stats.Entries)
+	assert.Equal(int64(2), stats.Languages["Go"])
+
+	assert.NoError(c.Delete("a"))
+	_, ok, _ = c.Get("a")
+	assert.False(ok)
+
+	// each shard holds one entry, so the cache never grows past the number of shards
+	for i := 0; i < 100; i++ {
+		c.Put(fmt.Sprintf("key%d", i), result)
+	}
+	assert.True(c.Stats().Entries <= memoryCacheShards)
+	_, ok, _ = c.Get("key99")
+	assert.True(ok)
+
+	c.Reset()
+	assert.Equal(CacheStats{Languages: map[string]int64{}}, c.Stats())
+}
+
+type failingCache struct {
+	gets, puts int
+}
+
+func (c *failingCache) Get(key string) (*Result, bool, error) {
+	c.gets++
+	return nil, false, errors.New("unavailable")
+}
+
+func (c *failingCache) Put(key string, result Result) error {
+	c.puts++
+	return errors.New("unavailable")
+}
+
+func (c *failingCache) Delete(key string) error {
+	return errors.New("unavailable")
+}
+
+func (c *failingCache) Stats() CacheStats {
+	return CacheStats{}
+}
+
+func TestCacheErrorsAreMisses(t *testing.T) {
+	assert := assert.New(t)
+	c := &failingCache{}
+	d := NewDetector(WithCache(c))
+	r, err := d.GetLanguageDetails(context.Background(), "main.foogo", []byte("package main\n\nfunc main() {\n}\n"))
+	assert.NoError(err)
+	assert.Equal("Go", r.Result.Language.Name)
+	assert.Equal(1, c.gets)
+	assert.Equal(1, c.puts)
+}
+
+func TestDetectorCache(t *testing.T) {
+	assert := assert.New(t)
+	body := []byte("package main\n\nfunc main() {\n}\n")
+	d := NewDetector()
+	r, err := d.GetLanguageDetails(context.Background(), "main.foogo", body)
+	assert.NoError(err)
+	assert.False(r.IsCached)
+	r, err = d.GetLanguageDetails(context.Background(), "main.foogo", body)
+	assert.NoError(err)
+	assert.True(r.IsCached)
+	assert.Equal("Go", r.Result.Language.Name)
+	assert.Equal(int64(1), d.Cache().Stats().Hits)
+
+	// changing the pipeline invalidates cached results
+	d.RemoveStrategy(ClassifierStrategyName)
+	r, err = d.GetLanguageDetails(context.Background(), "main.foogo", body)
+	assert.NoError(err)
+	assert.False(r.IsCached)
+	assert.Equal("", r.Result.Language.Name)
+
+	// no cache
+	d = NewDetector(WithCache(nil))
+	assert.Nil(d.Cache())
+	d.GetLanguageDetails(context.Background(), "main.foogo", body)
+	r, err = d.GetLanguageDetails(context.Background(), "main.foogo", body)
+	assert.NoError(err)
+	assert.False(r.IsCached)
+}
@@ -0,0 +1,360 @@
+package linguist
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jbrukh/bayesian"
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+	"github.com/jhaynie/linguist/generaltso/linguist/tokenizer"
+)
+
+// Classifier is a Bayesian classifier of languages and the kind of tokenizer the documents it
+// learned were tokenized with, which WriteClassifier saves with it
+type Classifier struct {
+	*bayesian.Classifier
+	// Legacy is true if the documents were tokenized with tokenizer.TokenizeLegacy(), as for the
+	// embedded classifier asset, rather than with the lexer
+	Legacy bool
+}
+
+var (
+	embedded     *Classifier
+	embeddedOnce sync.Once
+)
+
+// embeddedClassifier returns the embedded classifier asset, which was trained with the legacy tokenizer
+func embeddedClassifier() *Classifier {
+	embeddedOnce.Do(func() {
+		embedded = &Classifier{generaltso.DefaultClassifier(), true}
+	})
+	return embedded
+}
+
+// tokenizeContext returns the tokens of body tokenized the same way as the documents the classifier learned
+func (c *Classifier) tokenizeContext(ctx context.Context, body []byte) ([]string, error) {
+	if c.Legacy {
+		return tokenizer.Legacy().TokenizeContext(ctx, body)
+	}
+	return tokenizer.TokenizeContext(ctx, body)
+}
+
+func (c *Classifier) tokenize(body []byte) []string {
+	tokens, _ := c.tokenizeContext(context.Background(), body)
+	return tokens
+}
+
+// Train builds a new classifier from a directory of samples laid out as <Language>/<file>.
+// Files in nested directories under a language directory are used as samples for that language.
+// Samples are tokenized with tokenizer.Tokenize(), or with t if provided. With tokenizer.Legacy() the
+// result is a legacy classifier, with any other Tokenizer it should be used with WithTokenizer(t).
+func Train(samplesDir string, t ...*tokenizer.Tokenizer) (*Classifier, error) {
+	dirs, err := ioutil.ReadDir(samplesDir)
+	if err != nil {
+		return nil, err
+	}
+	samples := make(map[bayesian.Class][]string)
+	classes := make([]bayesian.Class, 0)
+	for _, dir := range dirs {
+		if !dir.IsDir() || strings.HasPrefix(dir.Name(), ".") {
+			continue
+		}
+		class := bayesian.Class(dir.Name())
+		err := filepath.Walk(filepath.Join(samplesDir, dir.Name()), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(info.Name(), ".") {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.Mode().IsRegular() {
+				samples[class] = append(samples[class], path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(samples[class]) > 0 {
+			classes = append(classes, class)
+		}
+	}
+	if len(classes) < 2 {
+		return nil, fmt.Errorf("at least two languages with samples are required in %s, found %d", samplesDir, len(classes))
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i] < classes[j] })
+	tokenize := tokenizer.Tokenize
+	if len(t) > 0 && t[0] != nil {
+		tokenize = t[0].Tokenize
+	}
+	classifier := bayesian.NewClassifier(classes...)
+	for _, class := range classes {
+		for _, path := range samples[class] {
+			buf, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			classifier.Learn(tokenize(buf), class)
+		}
+	}
+	return &Classifier{classifier, len(t) > 0 && t[0] != nil && t[0].IsLegacy()}, nil
+}
+
+// WriteClassifier writes the classifier in the same format as the embedded classifier asset, with
+// whether it's a legacy classifier in an extra field which the bayesian package ignores
+func WriteClassifier(w io.Writer, classifier *Classifier) error {
+	data, err := decodeClassifier(classifier.Classifier)
+	if err != nil {
+		return err
+	}
+	data.Legacy = classifier.Legacy
+	return gob.NewEncoder(w).Encode(data)
+}
+
+// WriteClassifierFile writes the classifier to filename, see WriteClassifier
+func WriteClassifierFile(filename string, classifier *Classifier) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := WriteClassifier(w, classifier); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadClassifier reads a classifier written by WriteClassifier. Gzip compressed input is also accepted.
+// A classifier written by the bayesian package isn't a legacy classifier.
+func ReadClassifier(r io.Reader) (*Classifier, error) {
+	br := bufio.NewReader(r)
+	var in io.Reader = br
+	if header, _ := br.Peek(2); bytes.Equal(header, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		in = gz
+	}
+	var data classifierData
+	if err := gob.NewDecoder(in).Decode(&data); err != nil {
+		return nil, err
+	}
+	return data.classifier()
+}
+
+// ReadClassifierFile reads a classifier file written by WriteClassifierFile
+func ReadClassifierFile(filename string) (*Classifier, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadClassifier(f)
+}
+
+// WithClassifier uses classifier instead of the embedded classifier asset
+func WithClassifier(classifier *Classifier) DetectorOption {
+	return func(d *Detector) {
+		d.classifier = classifier
+	}
+}
+
+// Classifier returns the classifier used by the detector
+func (d *Detector) Classifier() *Classifier {
+	d.mu.RLock()
+	c := d.classifier
+	d.mu.RUnlock()
+	if c == nil {
+		return embeddedClassifier()
+	}
+	return c
+}
+
+// SetClassifier swaps the classifier used by the detector. Detections which are
+// already running finish with the previous classifier.
+func (d *Detector) SetClassifier(classifier *Classifier) {
+	d.mu.Lock()
+	d.classifier = classifier
+	d.mu.Unlock()
+}
+
+// ResetClassifier rolls the detector back to the embedded classifier asset
+func (d *Detector) ResetClassifier() {
+	d.SetClassifier(nil)
+}
+
+// Tokenize returns the tokens of body which the detector's classifier is given
+func (d *Detector) Tokenize(body []byte) []string {
+	return d.tokenize(d.Classifier(), body)
+}
+
+func (d *Detector) tokenize(classifier *Classifier, body []byte) []string {
+	tokens, _ := d.tokenizeContext(context.Background(), classifier, body)
+	return tokens
+}
+
+// tokenizeContext is tokenize which stops when ctx is done
+func (d *Detector) tokenizeContext(ctx context.Context, classifier *Classifier, body []byte) ([]string, error) {
+	if d.tokenizer != nil {
+		return d.tokenizer.TokenizeContext(ctx, body)
+	}
+	return classifier.tokenizeContext(ctx, body)
+}
+
+// ApplyCorrections fine-tunes a copy of the detector's current classifier with the
+// corrections and swaps it in. The new classifier is returned so that it can be persisted
+// with WriteClassifierFile and loaded again with WithClassifier or LoadClassifier.
+func (d *Detector) ApplyCorrections(corrections ...Correction) (*Classifier, error) {
+	// serialize fine-tuning so concurrent corrections aren't lost
+	d.tuneMu.Lock()
+	defer d.tuneMu.Unlock()
+	classifier := d.Classifier()
+	c, err := fineTune(classifier, func(body []byte) []string {
+		return d.tokenize(classifier, body)
+	}, corrections...)
+	if err != nil {
+		return nil, err
+	}
+	d.SetClassifier(c)
+	return c, nil
+}
+
+// LoadClassifier will load a classifier file and use it instead of the embedded classifier asset
+func LoadClassifier(filename string) error {
+	c, err := ReadClassifierFile(filename)
+	if err != nil {
+		return err
+	}
+	defaultDetector.SetClassifier(c)
+	return nil
+}
+
+// SetClassifier will swap the classifier used by GetLanguageDetails
+func SetClassifier(classifier *Classifier) {
+	defaultDetector.SetClassifier(classifier)
+}
+
+// ResetClassifier will roll GetLanguageDetails back to the embedded classifier asset
+func ResetClassifier() {
+	defaultDetector.ResetClassifier()
+}
+
+// ApplyCorrections will fine-tune the classifier used by GetLanguageDetails with the corrections
+func ApplyCorrections(corrections ...Correction) (*Classifier, error) {
+	return defaultDetector.ApplyCorrections(corrections...)
+}
+
+// Correction is a file which has been labeled with its correct language
+type Correction struct {
+	Filename string `json:"filename"`
+	Body     []byte `json:"body"`
+	Language string `json:"language"`
+}
+
+// classifierData mirrors the gob encoding of bayesian.Classifier, which keeps its
+// frequency tables private, so a model can be copied and extended with new languages
+type classifierData struct {
+	Classes         []bayesian.Class
+	Learned         int
+	Seen            int
+	Datas           map[bayesian.Class]*classData
+	TfIdf           bool
+	DidConvertTfIdf bool
+	// Legacy isn't part of the bayesian encoding, see Classifier
+	Legacy bool
+}
+
+type classData struct {
+	Freqs   map[string]float64
+	FreqTfs map[string][]float64
+	Total   int
+}
+
+// decodeClassifier returns the gob encoding of classifier decoded into a classifierData
+func decodeClassifier(classifier *bayesian.Classifier) (*classifierData, error) {
+	var buf bytes.Buffer
+	if err := classifier.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	var data classifierData
+	if err := gob.NewDecoder(&buf).Decode(&data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// classifier returns a Classifier with the data
+func (data *classifierData) classifier() (*Classifier, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(data); err != nil {
+		return nil, err
+	}
+	c, err := bayesian.NewClassifierFromReader(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return &Classifier{c, data.Legacy}, nil
+}
+
+// FineTune returns a copy of classifier which has also learned the corrections.
+// Languages which the classifier doesn't know yet are added to the copy. The
+// classifier passed in is not modified.
+func FineTune(classifier *Classifier, corrections ...Correction) (*Classifier, error) {
+	return fineTune(classifier, classifier.tokenize, corrections...)
+}
+
+func fineTune(classifier *Classifier, tokenize func([]byte) []string, corrections ...Correction) (*Classifier, error) {
+	if classifier.IsTfIdf() {
+		return nil, errors.New("fine-tuning a TF-IDF classifier is not supported")
+	}
+	data, err := decodeClassifier(classifier.Classifier)
+	if err != nil {
+		return nil, err
+	}
+	// keep tokenizing the same way as the classifier was trained
+	data.Legacy = classifier.Legacy
+	for _, c := range corrections {
+		if c.Language == "" {
+			return nil, fmt.Errorf("correction for %s is missing a language", c.Filename)
+		}
+		class := bayesian.Class(c.Language)
+		cd := data.Datas[class]
+		if cd == nil {
+			cd = &classData{}
+			data.Datas[class] = cd
+			data.Classes = append(data.Classes, class)
+		}
+		if cd.Freqs == nil {
+			cd.Freqs = make(map[string]float64)
+		}
+		// same as bayesian.Classifier.Learn
+		for _, word := range tokenize(c.Body) {
+			cd.Freqs[word]++
+			cd.Total++
+		}
+		data.Learned++
+	}
+	return data.classifier()
+}
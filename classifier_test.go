@@ -0,0 +1,219 @@
+package linguist
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jbrukh/bayesian"
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+	"github.com/jhaynie/linguist/generaltso/linguist/tokenizer"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeSamples(t *testing.T, samples map[string]string) string {
+	dir, err := ioutil.TempDir("", "linguist-samples")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range samples {
+		fn := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fn, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestTrain(t *testing.T) {
+	assert := assert.New(t)
+	dir := writeSamples(t, map[string]string{
+		"Widget/a.w":                  "widget frob knob\nwidget frob\n",
+		"Widget/nested/b.w":           "frob knob knob widget\n",
+		"Gadget/a.g":                  "gadget whirr click\n",
+		"Gadget/.hidden":              "widget widget widget widget\n",
+		"Gadget/filenames/Gadgetfile": "click click gadget\n",
+	})
+	defer os.RemoveAll(dir)
+	classifier, err := Train(dir)
+	assert.NoError(err)
+	assert.Len(classifier.Classes, 2)
+	assert.Equal(4, classifier.Learned())
+
+	var buf bytes.Buffer
+	assert.NoError(WriteClassifier(&buf, classifier))
+	loaded, err := ReadClassifier(bytes.NewReader(buf.Bytes()))
+	assert.NoError(err)
+	assert.Equal(classifier.Classes, loaded.Classes)
+	assert.False(loaded.Legacy)
+	// the bayesian package can still read the file
+	plain, err := bayesian.NewClassifierFromReader(bytes.NewReader(buf.Bytes()))
+	assert.NoError(err)
+	assert.Equal(classifier.Classes, plain.Classes)
+
+	// the gzip compressed asset format is also accepted
+	var gzbuf bytes.Buffer
+	gz := gzip.NewWriter(&gzbuf)
+	gz.Write(buf.Bytes())
+	gz.Close()
+	loaded, err = ReadClassifier(&gzbuf)
+	assert.NoError(err)
+	assert.Equal(classifier.Classes, loaded.Classes)
+
+	d := NewDetector(WithClassifier(loaded))
+	assert.Equal(loaded, d.Classifier())
+	r := detectWith(t, d, "foo.unknown", "frob knob widget\n")
+	assert.Equal("Widget", r.Language.Name)
+	assert.Equal(ClassifierStrategyName, r.Strategy)
+	r = detectWith(t, d, "foo.unknown", "whirr click\n")
+	assert.Equal("Gadget", r.Language.Name)
+}
+
+func TestTrainRequiresTwoLanguages(t *testing.T) {
+	dir := writeSamples(t, map[string]string{
+		"Widget/a.w": "widget frob knob\n",
+	})
+	defer os.RemoveAll(dir)
+	_, err := Train(dir)
+	assert.Error(t, err)
+}
+
+func TestTrainLegacy(t *testing.T) {
+	assert := assert.New(t)
+	dir := writeSamples(t, map[string]string{
+		"Widget/a.w": "widget(); frob\n",
+		"Gadget/a.g": "gadget(); whirr\n",
+	})
+	defer os.RemoveAll(dir)
+	classifier, err := Train(dir, tokenizer.Legacy())
+	assert.NoError(err)
+	assert.True(classifier.Legacy)
+	assert.Contains(classifier.WordsByClass("Widget"), "widget();")
+	body := []byte("widget(); frob\n")
+	assert.Equal(tokenizer.TokenizeLegacy(body), NewDetector(WithClassifier(classifier)).Tokenize(body))
+	assert.Equal(tokenizer.TokenizeLegacy(body), generaltso.TokenizeFor(classifier.Legacy, body))
+	assert.Equal("Widget", generaltso.AnalyseWith(classifier.Classifier, classifier.Legacy, body, []string{"Widget", "Gadget"}))
+	// other classifiers aren't affected
+	assert.Equal(tokenizer.Tokenize(body), NewDetector(WithClassifier(&Classifier{Classifier: classifier.Classifier})).Tokenize(body))
+}
+
+func TestLoadClassifier(t *testing.T) {
+	assert := assert.New(t)
+	dir := writeSamples(t, map[string]string{
+		"Widget/a.w": "widget frob knob\n",
+		"Gadget/a.g": "gadget whirr click\n",
+	})
+	defer os.RemoveAll(dir)
+	classifier, err := Train(dir)
+	assert.NoError(err)
+	fn := filepath.Join(dir, "classifier")
+	assert.NoError(WriteClassifierFile(fn, classifier))
+	assert.NoError(LoadClassifier(fn))
+	defer ResetClassifier()
+	assert.Equal(classifier.Classes, defaultDetector.Classifier().Classes)
+	r, err := getLanguageDetails(context.Background(), "foo.unknown", []byte("widget frob\n"))
+	assert.NoError(err)
+	assert.Equal("Widget", r.Result.Language.Name)
+	assert.Error(LoadClassifier(filepath.Join(dir, "missing")))
+}
+
+func TestFineTune(t *testing.T) {
+	assert := assert.New(t)
+	dir := writeSamples(t, map[string]string{
+		"Widget/a.w": "widget frob knob\n",
+		"Gadget/a.g": "gadget whirr click\n",
+	})
+	defer os.RemoveAll(dir)
+	base, err := Train(dir)
+	assert.NoError(err)
+	tuned, err := FineTune(base,
+		Correction{"a.s", []byte("sprocket cog cog\n"), "Sprocket"},
+		Correction{"b.g", []byte("gadget beep boop\n"), "Gadget"},
+	)
+	assert.NoError(err)
+	// the base classifier isn't modified
+	assert.Len(base.Classes, 2)
+	assert.Equal(2, base.Learned())
+	assert.Len(tuned.Classes, 3)
+	assert.Equal(4, tuned.Learned())
+
+	d := NewDetector(WithClassifier(base), WithStrategies(ClassifierStrategy))
+	r := detectWith(t, d, "foo", "beep boop frob\n")
+	assert.Equal("Widget", r.Language.Name)
+	r = detectWith(t, d, "foo", "cog sprocket\n")
+	assert.NotEqual("Sprocket", r.Language.Name)
+	d.SetClassifier(tuned)
+	r = detectWith(t, d, "foo", "beep boop frob\n")
+	assert.Equal("Gadget", r.Language.Name)
+	r = detectWith(t, d, "foo", "cog sprocket\n")
+	assert.Equal("Sprocket", r.Language.Name)
+
+	_, err = FineTune(base, Correction{Filename: "a.s", Body: []byte("cog")})
+	assert.Error(err)
+}
+
+func TestApplyCorrections(t *testing.T) {
+	assert := assert.New(t)
+	d := NewDetector(WithStrategies(ClassifierStrategy))
+	embedded := d.Classifier()
+	c, err := d.ApplyCorrections(Correction{"a.zz", []byte("zzfoo zzbar zzbaz\n"), "MyDSL"})
+	assert.NoError(err)
+	assert.Equal(c, d.Classifier())
+	assert.Equal(len(embedded.Classes)+1, len(c.Classes))
+	r := detectWith(t, d, "b.zz", "zzfoo zzbaz\n")
+	assert.Equal("MyDSL", r.Language.Name)
+
+	// persist and load the fine-tuned model
+	var buf bytes.Buffer
+	assert.NoError(WriteClassifier(&buf, c))
+	loaded, err := ReadClassifier(&buf)
+	assert.NoError(err)
+	// the fine-tuned embedded classifier still tokenizes like the legacy tokenizer it was trained with
+	assert.True(c.Legacy)
+	assert.True(loaded.Legacy)
+	body := []byte("foo();bar();\n")
+	assert.Equal(tokenizer.TokenizeLegacy(body), NewDetector(WithClassifier(loaded)).Tokenize(body))
+	r = detectWith(t, NewDetector(WithClassifier(loaded), WithStrategies(ClassifierStrategy)), "b.zz", "zzfoo zzbaz\n")
+	assert.Equal("MyDSL", r.Language.Name)
+
+	// roll back to the embedded baseline
+	d.ResetClassifier()
+	assert.Equal(embedded, d.Classifier())
+	r = detectWith(t, d, "b.zz", "zzfoo zzbaz\n")
+	assert.NotEqual("MyDSL", r.Language.Name)
+}
+
+func TestWithTokenizer(t *testing.T) {
+	assert := assert.New(t)
+	dir := writeSamples(t, map[string]string{
+		"Widget/a.w": "frob knob\n%% gadget whirr gadget whirr\n",
+		"Gadget/a.g": "gadget whirr click\n",
+	})
+	defer os.RemoveAll(dir)
+	syntax := tokenizer.DefaultSyntax()
+	syntax.StartLineComments = nil
+	syntax.LineComments = []string{"%%"}
+	tok := tokenizer.New(syntax)
+	classifier, err := Train(dir, tok)
+	assert.NoError(err)
+	d := NewDetector(WithClassifier(classifier), WithTokenizer(tok), WithStrategies(ClassifierStrategy))
+	assert.Equal([]string{"frob"}, d.Tokenize([]byte("frob %% knob\n")))
+	r := detectWith(t, d, "foo", "gadget whirr\n")
+	assert.Equal("Gadget", r.Language.Name)
+
+	// corrections are tokenized with the detector's tokenizer too
+	c, err := d.ApplyCorrections(Correction{"b.s", []byte("sprocket %% gadget whirr gadget whirr\n"), "Sprocket"})
+	assert.NoError(err)
+	assert.Len(c.Classes, 3)
+	r = detectWith(t, d, "foo", "gadget whirr\n")
+	assert.Equal("Gadget", r.Language.Name)
+	r = detectWith(t, d, "foo", "sprocket\n")
+	assert.Equal("Sprocket", r.Language.Name)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jhaynie/linguist"
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+)
+
+func data(args []string) error {
+	if len(args) == 0 || args[0] != "diff" {
+		return errors.New("expected a subcommand: diff")
+	}
+	fs := flag.NewFlagSet("data diff", flag.ExitOnError)
+	replace := fs.Bool("replace", false, "replace the embedded data files instead of merging with them")
+	asJSON := fs.Bool("json", false, "write the differences as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: linguist data diff [-replace] [-json] [<from>] <to>\n\n"+
+			"<from> and <to> are a directory of data files or a languages.yml, vendor.yml or documentation.yml\n"+
+			"file. <from> is the embedded data if omitted.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return errors.New("expected one or two data paths")
+	}
+	mode := linguist.DataMerge
+	if *replace {
+		mode = linguist.DataReplace
+	}
+	from := generaltso.EmbeddedData()
+	paths := fs.Args()
+	if len(paths) == 2 {
+		var err error
+		if from, err = linguist.LoadData(paths[0], mode); err != nil {
+			return err
+		}
+		paths = paths[1:]
+	}
+	to, err := linguist.LoadData(paths[0], mode)
+	if err != nil {
+		return err
+	}
+	diff := linguist.DiffData(from, to)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	}
+	if diff.Empty() {
+		fmt.Println("no differences")
+		return nil
+	}
+	for _, section := range []struct {
+		name    string
+		changes []linguist.DataChange
+	}{
+		{"languages", diff.Languages},
+		{"extensions", diff.Extensions},
+		{"filenames", diff.Filenames},
+	} {
+		if len(section.changes) == 0 {
+			continue
+		}
+		fmt.Printf("%s:\n", section.name)
+		for _, c := range section.changes {
+			fmt.Printf("  %s\n", c)
+		}
+	}
+	return nil
+}
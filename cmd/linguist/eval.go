@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/jhaynie/linguist"
+	"github.com/jhaynie/linguist/eval"
+	"github.com/jhaynie/linguist/generaltso/linguist/tokenizer"
+)
+
+func evaluate(args []string) error {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	corpus := fs.String("corpus", "", "directory of labeled files laid out as <Language>/<file>")
+	classifier := fs.String("classifier", "", "classifier file to use instead of the embedded classifier")
+	worst := fs.Int("worst", eval.DefaultWorst, "number of misclassified files to report")
+	cache := fs.Bool("cache", false, "allow results from the preoptimization cache")
+	asJSON := fs.Bool("json", false, "write the report as JSON")
+	legacy := fs.Bool("legacy-tokenizer", false, "use the word-splitting tokenizer from before the lexer, for classifier files which don't record that they were trained with it")
+	fs.Parse(args)
+	if *corpus == "" {
+		return errors.New("-corpus is required")
+	}
+	opts := []linguist.DetectorOption{}
+	if *legacy {
+		opts = append(opts, linguist.WithTokenizer(tokenizer.Legacy()))
+	}
+	if *classifier != "" {
+		c, err := linguist.ReadClassifierFile(*classifier)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, linguist.WithClassifier(c))
+	}
+	report, err := eval.Evaluate(context.Background(), *corpus, &eval.Options{
+		Detector: linguist.NewDetector(opts...),
+		UseCache: *cache,
+		Worst:    *worst,
+	})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return report.WriteJSON(os.Stdout)
+	}
+	return report.WriteText(os.Stdout)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/jhaynie/linguist"
+)
+
+func explain(args []string) error {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	cache := fs.Bool("cache", false, "allow results from the preoptimization cache")
+	asJSON := fs.Bool("json", false, "write the explanation as JSON")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("expected a single file")
+	}
+	filename := fs.Arg(0)
+	body, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	e, err := linguist.Explain(context.Background(), filename, body, !*cache)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(e)
+	}
+	_, err = fmt.Print(e)
+	return err
+}
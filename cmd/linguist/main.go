@@ -0,0 +1,59 @@
+// Command linguist provides tooling around the linguist package
+//
+// Usage:
+//
+//	linguist train -samples <dir> -o <file> [-legacy-tokenizer]
+//	linguist eval -corpus <dir> [-classifier <file>] [-legacy-tokenizer] [-json]
+//	linguist explain [-cache] [-json] <file>
+//	linguist scan [-segments] [-json] <dir>
+//	linguist data diff [-replace] [-json] [<from>] <to>
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"train":   {"train a classifier from a directory of <Language>/<file> samples", train},
+	"eval":    {"measure detection accuracy against a directory of <Language>/<file> files", evaluate},
+	"explain": {"show each step of the detection of a single file", explain},
+	"scan":    {"show the languages of the files in a directory", scan},
+	"data":    {"show the differences between sets of languages.yml, vendor.yml and documentation.yml", data},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: linguist <command> [arguments]\n\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		usage()
+	}
+	if err := cmd.run(flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "linguist %s: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
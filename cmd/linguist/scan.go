@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jhaynie/linguist"
+)
+
+func scan(args []string) error {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	segments := fs.Bool("segments", false, "attribute the bytes of languages embedded in polyglot files such as HTML and Markdown")
+	asJSON := fs.Bool("json", false, "write the totals as JSON")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("expected a single directory")
+	}
+	var opts []linguist.DetectorOption
+	if *segments {
+		opts = append(opts, linguist.WithSegmentation())
+	}
+	stats, err := linguist.NewDetector(opts...).ScanDirectory(context.Background(), fs.Arg(0), nil)
+	if err != nil {
+		return err
+	}
+	languages := stats.Languages()
+	testFiles, testBytes := stats.Tests()
+	nonTestFiles, nonTestBytes := stats.NonTests()
+	docFiles, docBytes := stats.Documentation()
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(map[string]interface{}{
+			"files":         stats.Files(),
+			"bytes":         stats.Bytes(),
+			"excluded":      stats.Excluded(),
+			"unknown":       stats.Unknown(),
+			"tests":         map[string]int64{"files": int64(testFiles), "bytes": testBytes},
+			"non_tests":     map[string]int64{"files": int64(nonTestFiles), "bytes": nonTestBytes},
+			"documentation": map[string]int64{"files": int64(docFiles), "bytes": docBytes},
+			"languages":     languages,
+		})
+	}
+	var total int64
+	for _, l := range languages {
+		total += l.Bytes
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "language\tfiles\tbytes\tembedded\ttests\t%%\t\n")
+	for _, l := range languages {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%.1f\t\n", l.Language, l.Files, l.Bytes, l.EmbeddedBytes, l.TestBytes, 100*float64(l.Bytes)/float64(total))
+	}
+	fmt.Fprintf(w, "\n%d files, %d excluded, %d unknown\t\t\t\t\t\t\n", stats.Files(), stats.Excluded(), stats.Unknown())
+	fmt.Fprintf(w, "%d test files with %d bytes, %d other files with %d bytes\t\t\t\t\t\t\n", testFiles, testBytes, nonTestFiles, nonTestBytes)
+	fmt.Fprintf(w, "%d documentation files with %d bytes\t\t\t\t\t\t\n", docFiles, docBytes)
+	return w.Flush()
+}
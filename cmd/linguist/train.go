@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/jhaynie/linguist"
+	"github.com/jhaynie/linguist/generaltso/linguist/tokenizer"
+)
+
+func train(args []string) error {
+	fs := flag.NewFlagSet("train", flag.ExitOnError)
+	samples := fs.String("samples", "", "directory of samples laid out as <Language>/<file>")
+	output := fs.String("o", "classifier", "file to write the trained classifier to")
+	legacy := fs.Bool("legacy-tokenizer", false, "use the word-splitting tokenizer from before the lexer, for classifiers trained with it")
+	fs.Parse(args)
+	if *samples == "" {
+		return errors.New("-samples is required")
+	}
+	var t []*tokenizer.Tokenizer
+	if *legacy {
+		t = append(t, tokenizer.Legacy())
+	}
+	classifier, err := linguist.Train(*samples, t...)
+	if err != nil {
+		return err
+	}
+	if err := linguist.WriteClassifierFile(*output, classifier); err != nil {
+		return err
+	}
+	fmt.Printf("trained %d languages from %d samples, wrote %s\n", len(classifier.Classes), classifier.Learned(), *output)
+	return nil
+}
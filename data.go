@@ -0,0 +1,317 @@
+package linguist
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+)
+
+// names of the linguist data files
+const (
+	LanguagesFile     = "languages.yml"
+	VendorFile        = "vendor.yml"
+	DocumentationFile = "documentation.yml"
+)
+
+// DataMode is how loaded data files are combined with the copies embedded in the package
+type DataMode int
+
+const (
+	// DataMerge adds the languages of a loaded languages.yml to the embedded languages, replacing
+	// languages with the same name, and adds the patterns of a loaded vendor.yml or
+	// documentation.yml to the embedded patterns. This is the default.
+	DataMerge DataMode = iota
+	// DataReplace replaces the embedded copy of each loaded data file
+	DataReplace
+)
+
+func (m DataMode) String() string {
+	if m == DataReplace {
+		return "replace"
+	}
+	return "merge"
+}
+
+// DataFiles are the readers of the data files to load. A nil reader keeps the embedded copy of the file.
+type DataFiles struct {
+	Languages     io.Reader
+	Vendor        io.Reader
+	Documentation io.Reader
+}
+
+// ReadData reads and checks data files and combines them with the embedded copies. The result
+// can be used with SetData or WithData.
+func ReadData(files DataFiles, mode DataMode) (*generaltso.Data, error) {
+	embedded := generaltso.EmbeddedData()
+	languages := make(map[string]generaltso.Language)
+	for _, name := range embedded.Languages() {
+		languages[name], _ = embedded.Language(name)
+	}
+	vendor, documentation := embedded.Vendor(), embedded.Documentation()
+	if files.Languages != nil {
+		loaded, err := generaltso.ParseLanguages(files.Languages)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", LanguagesFile, err)
+		}
+		if mode == DataReplace {
+			languages = make(map[string]generaltso.Language)
+		}
+		for name, l := range loaded {
+			languages[name] = l
+		}
+	}
+	var err error
+	if vendor, err = readPatterns(files.Vendor, VendorFile, vendor, mode); err != nil {
+		return nil, err
+	}
+	if documentation, err = readPatterns(files.Documentation, DocumentationFile, documentation, mode); err != nil {
+		return nil, err
+	}
+	data, err := generaltso.NewData(languages, vendor, documentation)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data: %v", err)
+	}
+	return data, nil
+}
+
+// readPatterns returns the patterns of a vendor.yml or documentation.yml combined with the embedded patterns
+func readPatterns(r io.Reader, name string, embedded []string, mode DataMode) ([]string, error) {
+	if r == nil {
+		return embedded, nil
+	}
+	loaded, err := generaltso.ParsePatterns(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if mode == DataReplace {
+		return loaded, nil
+	}
+	seen := make(map[string]bool)
+	for _, p := range embedded {
+		seen[p] = true
+	}
+	for _, p := range loaded {
+		if !seen[p] {
+			embedded = append(embedded, p)
+			seen[p] = true
+		}
+	}
+	return embedded, nil
+}
+
+// LoadData reads the data files at path, which is either a directory with any of languages.yml,
+// vendor.yml and documentation.yml or one of those files, see ReadData
+func LoadData(path string, mode DataMode) (*generaltso.Data, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{LanguagesFile, VendorFile, DocumentationFile}
+	dir := path
+	if !info.IsDir() {
+		dir, names = filepath.Dir(path), []string{filepath.Base(path)}
+		switch names[0] {
+		case LanguagesFile, VendorFile, DocumentationFile:
+		default:
+			return nil, fmt.Errorf("%s isn't one of %s, %s or %s", path, LanguagesFile, VendorFile, DocumentationFile)
+		}
+	}
+	var files DataFiles
+	var found bool
+	for _, name := range names {
+		f, err := os.Open(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		found = true
+		switch name {
+		case LanguagesFile:
+			files.Languages = f
+		case VendorFile:
+			files.Vendor = f
+		case DocumentationFile:
+			files.Documentation = f
+		}
+	}
+	if !found {
+		return nil, errors.New("no data files found in " + path)
+	}
+	data, err := ReadData(files, mode)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %v", path, err)
+	}
+	return data, nil
+}
+
+// SetData changes the data files which the package and every Detector without its own data
+// use, see WithData. A nil data restores the embedded data. The preoptimization table is rebuilt
+// from the new data, so rules added with AddPreoptimizationRule should be added after calling SetData.
+func SetData(data *generaltso.Data) {
+	defer atomic.AddInt64(&rulesetGeneration, 1)
+	generaltso.SetData(data)
+	// make sure that the table isn't built later from the data before
+	preoptimizeOnce.Do(func() {})
+	table := defaultPreoptimizationTable()
+	mutex.Lock()
+	preoptimizations = table
+	mutex.Unlock()
+}
+
+// kinds of DataChange
+const (
+	DataAdded   = "added"
+	DataRemoved = "removed"
+	DataChanged = "changed"
+)
+
+// DataChange is a language, extension or filename which differs between two data sets
+type DataChange struct {
+	Name string `json:"name"`
+	// Change is DataAdded, DataRemoved or DataChanged
+	Change string `json:"change"`
+	// Before and After are the languages of an extension or filename, or the fields of a language which differ
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+func (c DataChange) String() string {
+	switch c.Change {
+	case DataAdded:
+		return fmt.Sprintf("+ %s: %s", c.Name, strings.Join(c.After, ", "))
+	case DataRemoved:
+		return fmt.Sprintf("- %s: %s", c.Name, strings.Join(c.Before, ", "))
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Name, strings.Join(c.Before, ", "), strings.Join(c.After, ", "))
+}
+
+// DataDiff are the languages, extensions and filenames which differ between two data sets, in alphabetical order
+type DataDiff struct {
+	Languages  []DataChange `json:"languages"`
+	Extensions []DataChange `json:"extensions"`
+	Filenames  []DataChange `json:"filenames"`
+}
+
+// Empty returns true if there are no differences
+func (d DataDiff) Empty() bool {
+	return len(d.Languages) == 0 && len(d.Extensions) == 0 && len(d.Filenames) == 0
+}
+
+// DiffData returns the languages, extensions and filenames which were added, removed or changed from one data set to another
+func DiffData(from, to *generaltso.Data) DataDiff {
+	return DataDiff{
+		Languages:  diffIndex(languageFields(from), languageFields(to), fieldChanges),
+		Extensions: diffIndex(dataIndex(from, extensionsOf), dataIndex(to, extensionsOf), nil),
+		Filenames:  diffIndex(dataIndex(from, filenamesOf), dataIndex(to, filenamesOf), nil),
+	}
+}
+
+func extensionsOf(l generaltso.Language) []string { return l.Extensions }
+func filenamesOf(l generaltso.Language) []string  { return l.Filenames }
+
+// dataIndex returns the languages of each extension or filename of the data
+func dataIndex(data *generaltso.Data, keys func(l generaltso.Language) []string) map[string][]string {
+	index := make(map[string][]string)
+	for _, name := range data.Languages() {
+		l, _ := data.Language(name)
+		for _, k := range keys(l) {
+			index[k] = append(index[k], name)
+		}
+	}
+	return index
+}
+
+// diffIndex returns the keys which were added, removed or changed, with only the values which
+// differ if changed isn't nil
+func diffIndex(from, to map[string][]string, changed func(before, after []string) ([]string, []string)) []DataChange {
+	changes := make([]DataChange, 0)
+	for _, k := range unionKeys(from, to) {
+		before, inBefore := from[k]
+		after, inAfter := to[k]
+		switch {
+		case !inBefore:
+			changes = append(changes, DataChange{Name: k, Change: DataAdded, After: after})
+		case !inAfter:
+			changes = append(changes, DataChange{Name: k, Change: DataRemoved, Before: before})
+		case strings.Join(before, "\n") != strings.Join(after, "\n"):
+			if changed != nil {
+				before, after = changed(before, after)
+			}
+			changes = append(changes, DataChange{Name: k, Change: DataChanged, Before: before, After: after})
+		}
+	}
+	return changes
+}
+
+// languageFields returns the fields of each language of the data which aren't empty, as name: value
+func languageFields(data *generaltso.Data) map[string][]string {
+	fields := make(map[string][]string)
+	for _, name := range data.Languages() {
+		l, _ := data.Language(name)
+		var f []string
+		for _, kv := range [][2]string{
+			{"type", l.Type},
+			{"color", l.Color},
+			{"group", l.Group},
+			{"ace_mode", l.AceMode},
+			{"aliases", strings.Join(l.Aliases, " ")},
+			{"extensions", strings.Join(l.Extensions, " ")},
+			{"filenames", strings.Join(l.Filenames, " ")},
+			{"interpreters", strings.Join(l.Interpreters, " ")},
+		} {
+			if kv[1] != "" {
+				f = append(f, kv[0]+": "+kv[1])
+			}
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// fieldChanges returns the fields which are only in before and only in after
+func fieldChanges(before, after []string) ([]string, []string) {
+	in := func(s []string, v string) bool {
+		for _, e := range s {
+			if e == v {
+				return true
+			}
+		}
+		return false
+	}
+	var b, a []string
+	for _, f := range before {
+		if !in(after, f) {
+			b = append(b, f)
+		}
+	}
+	for _, f := range after {
+		if !in(before, f) {
+			a = append(a, f)
+		}
+	}
+	return b, a
+}
+
+func unionKeys(a, b map[string][]string) []string {
+	keys := make([]string, 0, len(a))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,184 @@
+package linguist
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+	"github.com/stretchr/testify/assert"
+)
+
+const zigLanguages = `Zig:
+  type: programming
+  color: "#ec915c"
+  aliases:
+  - ziglang
+  extensions:
+  - ".zig"
+  - ".zon"
+  filenames:
+  - build.zig.zon
+  interpreters:
+  - zig
+`
+
+func TestReadData(t *testing.T) {
+	assert := assert.New(t)
+	embedded := generaltso.EmbeddedData()
+	data, err := ReadData(DataFiles{Languages: strings.NewReader(zigLanguages)}, DataMerge)
+	assert.NoError(err)
+	assert.Equal(len(embedded.Languages())+1, len(data.Languages()))
+	assert.Equal([]string{"Zig"}, data.LanguagesByExtension("main.zig"))
+	assert.Equal("Zig", data.LanguageByAlias("ZigLang"))
+	assert.Equal([]string{"Go"}, data.LanguagesByExtension("main.go"))
+	assert.Equal(embedded.Vendor(), data.Vendor())
+	assert.NotEqual(embedded.Version(), data.Version())
+
+	data, err = ReadData(DataFiles{
+		Languages: strings.NewReader(zigLanguages),
+		Vendor:    strings.NewReader("- (^|/)imported/\n"),
+	}, DataReplace)
+	assert.NoError(err)
+	assert.Equal([]string{"Zig"}, data.Languages())
+	assert.Nil(data.LanguagesByExtension("main.go"))
+	assert.Equal([]string{"(^|/)imported/"}, data.Vendor())
+	assert.True(data.IsVendored("imported/lib.zig"))
+	assert.False(data.IsVendored("node_modules/a.js"))
+	// documentation wasn't loaded, so the embedded copy is kept
+	assert.Equal(embedded.Documentation(), data.Documentation())
+
+	data, err = ReadData(DataFiles{Vendor: strings.NewReader("- (^|/)imported/\n")}, DataMerge)
+	assert.NoError(err)
+	assert.True(data.IsVendored("imported/lib.zig"))
+	assert.True(data.IsVendored("node_modules/a.js"))
+
+	for _, files := range []DataFiles{
+		{Languages: strings.NewReader("Foo:\n  type: code\n")},
+		{Languages: strings.NewReader("Foo:\n  color: red\n")},
+		{Languages: strings.NewReader("Foo:\n  extensions:\n  - foo\n")},
+		{Languages: strings.NewReader("Foo:\n  filenames:\n  - a/b\n")},
+		{Languages: strings.NewReader("Foo:\n  interpreters:\n  - foo bar\n")},
+		{Languages: strings.NewReader("Foo:\n  aliases:\n  - golang\n")},
+		{Languages: strings.NewReader("- not a map\n")},
+		{Vendor: strings.NewReader("- (unclosed\n")},
+		{Documentation: strings.NewReader("a: b\n")},
+		{Documentation: strings.NewReader("- [a]\n")},
+	} {
+		_, err := ReadData(files, DataMerge)
+		assert.Error(err)
+	}
+}
+
+func TestLoadData(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "linguist-data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	_, err = LoadData(dir, DataMerge)
+	assert.Error(err)
+	if err := ioutil.WriteFile(filepath.Join(dir, LanguagesFile), []byte(zigLanguages), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, DocumentationFile), []byte("- (^|/)handbook/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, err := LoadData(dir, DataMerge)
+	assert.NoError(err)
+	assert.Equal([]string{"Zig"}, data.LanguagesByExtension("main.zig"))
+	assert.True(data.IsDocumentation("handbook/intro.md"))
+	data, err = LoadData(filepath.Join(dir, LanguagesFile), DataMerge)
+	assert.NoError(err)
+	assert.Equal([]string{"Zig"}, data.LanguagesByExtension("main.zig"))
+	assert.False(data.IsDocumentation("handbook/intro.md"))
+	if err := ioutil.WriteFile(filepath.Join(dir, "other.yml"), []byte(zigLanguages), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadData(filepath.Join(dir, "other.yml"), DataMerge)
+	assert.Error(err)
+	_, err = LoadData(filepath.Join(dir, "missing"), DataMerge)
+	assert.Error(err)
+}
+
+func TestSetData(t *testing.T) {
+	assert := assert.New(t)
+	defer SetData(nil)
+	data, err := ReadData(DataFiles{Languages: strings.NewReader(zigLanguages)}, DataMerge)
+	assert.NoError(err)
+	d := NewDetector()
+	body := []byte("const std = @import(\"std\");\n")
+	r, err := d.GetLanguageDetails(context.Background(), "main.zig", body)
+	assert.NoError(err)
+	assert.NotEqual("Zig", r.Result.Language.Name)
+
+	SetData(data)
+	assert.Equal(data, generaltso.CurrentData())
+	// the cached result is of the data before and the preoptimization table is rebuilt
+	r, err = d.GetLanguageDetails(context.Background(), "main.zig", body)
+	assert.NoError(err)
+	assert.Equal("Zig", r.Result.Language.Name)
+	assert.Equal("programming", r.Result.Language.Type)
+	assert.Equal(PreoptimizationStrategyName, r.Result.Strategy)
+	assert.Contains(PreoptimizationRules(), PreoptimizationRule{Extension: ".zig", Language: "Zig"})
+	assert.Equal("Zig", detectWith(t, d, "build", "#!/usr/bin/env zig\n").Language.Name)
+
+	SetData(nil)
+	assert.Equal(generaltso.EmbeddedData(), generaltso.CurrentData())
+	assert.NotContains(PreoptimizationRules(), PreoptimizationRule{Extension: ".zig", Language: "Zig"})
+}
+
+func TestWithData(t *testing.T) {
+	assert := assert.New(t)
+	data, err := ReadData(DataFiles{
+		Languages: strings.NewReader(zigLanguages),
+		Vendor:    strings.NewReader("- (^|/)imported/\n"),
+	}, DataMerge)
+	assert.NoError(err)
+	d := NewDetector(WithData(data))
+	assert.Equal(data, d.Data())
+	r := detectWith(t, d, "src/main.zig", "const std = @import(\"std\");\n")
+	assert.Equal("Zig", r.Language.Name)
+	assert.Equal(ExtensionStrategyName, r.Strategy)
+	vendored, err := d.GetLanguageDetails(context.Background(), "imported/lib.zig", []byte("const a = 1;\n"))
+	assert.NoError(err)
+	assert.True(vendored.IsVendored)
+	// other detectors keep the data of the package
+	assert.NotEqual("Zig", detectWith(t, NewDetector(), "src/main.zig", "const std = @import(\"std\");\n").Language.Name)
+	assert.False(IsVendored("imported/lib.zig"))
+	d.SetData(nil)
+	assert.Equal(generaltso.CurrentData(), d.Data())
+}
+
+func TestDiffData(t *testing.T) {
+	assert := assert.New(t)
+	embedded := generaltso.EmbeddedData()
+	assert.True(DiffData(embedded, embedded).Empty())
+	data, err := ReadData(DataFiles{Languages: strings.NewReader(zigLanguages + `Go:
+  type: programming
+  color: "#00ADD8"
+  aliases:
+  - golang
+  extensions:
+  - ".go"
+  ace_mode: golang
+`)}, DataMerge)
+	assert.NoError(err)
+	diff := DiffData(embedded, data)
+	assert.Equal([]DataChange{
+		{Name: "Go", Change: DataChanged, Before: []string{"color: #375eab"}, After: []string{"color: #00ADD8"}},
+		{Name: "Zig", Change: DataAdded, After: []string{"type: programming", "color: #ec915c", "aliases: ziglang", "extensions: .zig .zon", "filenames: build.zig.zon", "interpreters: zig"}},
+	}, diff.Languages)
+	assert.Equal([]DataChange{
+		{Name: ".zig", Change: DataAdded, After: []string{"Zig"}},
+		{Name: ".zon", Change: DataAdded, After: []string{"Zig"}},
+	}, diff.Extensions)
+	assert.Equal([]DataChange{{Name: "build.zig.zon", Change: DataAdded, After: []string{"Zig"}}}, diff.Filenames)
+	reverse := DiffData(data, embedded)
+	assert.Equal(DataRemoved, reverse.Languages[1].Change)
+	assert.Equal("- .zig: Zig", reverse.Extensions[0].String())
+}
@@ -0,0 +1,527 @@
+package linguist
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+	"github.com/jhaynie/linguist/generaltso/linguist/tokenizer"
+)
+
+// Detector detects languages by running a file through an ordered pipeline of strategies
+type Detector struct {
+	mu         sync.RWMutex
+	strategies []Strategy
+	classifier *Classifier
+	tokenizer  *tokenizer.Tokenizer
+	tuneMu     sync.Mutex
+	cache      Cache
+	vendored   VendoredPolicy
+	segments   bool
+	data       *generaltso.Data
+	root       string
+	// strategiesVersion is incremented whenever the pipeline changes
+	strategiesVersion int64
+	version           detectorVersion
+}
+
+// detectorVersion is the memoized version of the detector's results in a DiskCache
+type detectorVersion struct {
+	exclusions int64
+	strategies int64
+	classifier *Classifier
+	vendored   VendoredPolicy
+	segments   bool
+	data       *generaltso.Data
+	// model is the modelVersion of the classifier
+	model   string
+	version string
+}
+
+// DetectorOption is used to configure a Detector
+type DetectorOption func(d *Detector)
+
+// WithStrategies replaces the default detection pipeline with strategies, run in order. The
+// preoptimization table only answers for DefaultStrategies, so every file is run through them.
+func WithStrategies(strategies ...Strategy) DetectorOption {
+	return func(d *Detector) {
+		d.strategies = append([]Strategy{}, strategies...)
+	}
+}
+
+// WithTokenizer tokenizes files with t before they are given to the classifier. The classifier
+// should have been trained with the same tokenizer, see Train.
+func WithTokenizer(t *tokenizer.Tokenizer) DetectorOption {
+	return func(d *Detector) {
+		d.tokenizer = t
+	}
+}
+
+// WithCache stores results in c instead of a MemoryCache, such as a DiskCache which can be
+// shared with other processes. A nil Cache turns caching off.
+func WithCache(c Cache) DetectorOption {
+	return func(d *Detector) {
+		d.cache = c
+	}
+}
+
+// WithVendoredPolicy sets what the detector does with vendored files, see VendoredPolicy
+func WithVendoredPolicy(p VendoredPolicy) DetectorOption {
+	return func(d *Detector) {
+		d.vendored = p
+	}
+}
+
+// WithSegmentation splits polyglot files into the languages embedded in them, which are returned
+// in Detection.Segments. See Segments.
+func WithSegmentation() DetectorOption {
+	return func(d *Detector) {
+		d.segments = true
+	}
+}
+
+// WithData detects languages with data files loaded with LoadData or ReadData instead of the data
+// of the package, see SetData. The preoptimization table is built from the data of the package, so
+// a detector with its own data runs every file through the pipeline.
+func WithData(data *generaltso.Data) DetectorOption {
+	return func(d *Detector) {
+		d.data = data
+	}
+}
+
+// WithRoot makes absolute paths under root relative to it, for callers which only have the absolute
+// paths of the files of a repository. See NormalizePath.
+func WithRoot(root string) DetectorOption {
+	return func(d *Detector) {
+		d.root = NormalizePath(root)
+	}
+}
+
+// NewDetector returns a new Detector which uses DefaultStrategies and a MemoryCache unless configured otherwise
+func NewDetector(opts ...DetectorOption) *Detector {
+	d := &Detector{
+		strategies: DefaultStrategies(),
+		cache:      NewMemoryCache(DefaultMemoryCacheSize),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+var defaultDetector = NewDetector()
+
+// Strategies returns a copy of the detection pipeline
+func (d *Detector) Strategies() []Strategy {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return append([]Strategy{}, d.strategies...)
+}
+
+// AddStrategy inserts strategy into the pipeline before the strategy named before.
+// If before is empty or isn't found, the strategy is added to the end of the pipeline.
+// Once the pipeline differs from DefaultStrategies the preoptimization table isn't used.
+func (d *Detector) AddStrategy(strategy Strategy, before string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, s := range d.strategies {
+		if before != "" && s.Name() == before {
+			d.strategies = append(d.strategies[:i], append([]Strategy{strategy}, d.strategies[i:]...)...)
+			d.strategiesVersion++
+			return
+		}
+	}
+	d.strategies = append(d.strategies, strategy)
+	d.strategiesVersion++
+}
+
+// RemoveStrategy removes the strategy with the name from the pipeline
+func (d *Detector) RemoveStrategy(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, s := range d.strategies {
+		if s.Name() == name {
+			d.strategies = append(d.strategies[:i], d.strategies[i+1:]...)
+			d.strategiesVersion++
+			return
+		}
+	}
+}
+
+// AddStrategy will add a strategy to the default detection pipeline before the strategy named before
+func AddStrategy(strategy Strategy, before string) {
+	defaultDetector.AddStrategy(strategy, before)
+}
+
+// RemoveStrategy will remove the named strategy from the default detection pipeline
+func RemoveStrategy(name string) {
+	defaultDetector.RemoveStrategy(name)
+}
+
+// GetLanguageDetails returns the linguist results for a given file using this detector's pipeline.
+// Results found in the detector's Cache or the preoptimization cache are returned unless skip is true.
+// The filename is the path of the file relative to the root of the repository, and it's normalized
+// with NormalizePath, so Detection.Path may differ from it.
+func (d *Detector) GetLanguageDetails(ctx context.Context, filename string, body []byte, skip ...bool) (Result, error) {
+	filename = d.normalize(filename)
+	m := metrics()
+	start := time.Now()
+	ctx, span := startSpan(ctx, SpanDetect)
+	result, err := d.getCachedLanguageDetails(ctx, m, filename, body, skip...)
+	observeResult(m, result, err, len(body), time.Since(start))
+	if span.IsRecording() {
+		traceResult(span, d.Data(), filename, body, result, err)
+	}
+	span.End()
+	return result, err
+}
+
+// traceResult records the final result of a detection and the hints from data
+func traceResult(span Span, data *generaltso.Data, filename string, body []byte, result Result, err error) {
+	span.SetAttribute("path", filename)
+	span.SetAttribute("size", len(body))
+	span.SetAttribute("hints", data.LanguageHints(filename))
+	if err != nil {
+		span.SetAttribute("error", err.Error())
+		return
+	}
+	span.SetAttribute("cached", result.IsCached)
+	span.SetAttribute("excluded", result.IsExcluded)
+	if result.Result != nil {
+		span.SetAttribute("strategy", result.Result.Strategy)
+		if result.Result.Language != nil {
+			span.SetAttribute("language", result.Result.Language.Name)
+		}
+	}
+}
+
+func (d *Detector) getCachedLanguageDetails(ctx context.Context, m Metrics, filename string, body []byte, skip ...bool) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return noResult, canceled(err, filename)
+	}
+	if ex, r := isExcluded(ctx, filename, body); ex {
+		return *r, nil
+	}
+	policy := d.VendoredPolicy()
+	vendored := traceCheck(ctx, ExclusionVendored, d.isVendored(filename))
+	if vendored && policy == VendoredExclude {
+		return *vendoredResult, nil
+	}
+	if len(skip) > 0 && skip[0] {
+		result, err := d.getLanguageDetails(ctx, filename, body)
+		if err == nil {
+			err = d.annotate(ctx, filename, body, &result)
+		}
+		return result, err
+	}
+	c := d.Cache()
+	var key string
+	if c != nil {
+		key = d.cacheKey(filename, body)
+		_, span := startSpan(ctx, SpanCache)
+		// errors from the cache are treated as a miss
+		r, ok, err := c.Get(key)
+		if err != nil {
+			span.SetAttribute("error", err.Error())
+		}
+		hit := err == nil && ok && r != nil
+		span.SetAttribute("hit", hit)
+		span.End()
+		if hit {
+			m.Cache(CacheHit)
+			r.IsCached = true
+			return *r, nil
+		}
+		m.Cache(CacheMiss)
+	}
+	result := noResult
+	if d.preoptimized() {
+		_, span := startSpan(ctx, SpanPreoptimization)
+		result = checkPreoptimization(filename, body, vendored)
+		span.SetAttribute("matched", result.Success)
+		if result.Result != nil && result.Result.Language != nil {
+			span.SetAttribute("language", result.Result.Language.Name)
+		}
+		span.End()
+	}
+	if result.Success {
+		hits := atomic.AddInt32(&preoptimizationHits, 1)
+		// every N hits, resort so that the most popular stays
+		// at the top of the heap for faster access and less popular go to bottom
+		if hits%100 == 0 {
+			resort()
+		}
+	} else {
+		var err error
+		if result, err = d.getLanguageDetails(ctx, filename, body); err != nil || !result.Success {
+			return result, err
+		}
+	}
+	if err := d.annotate(ctx, filename, body, &result); err != nil {
+		return noResult, err
+	}
+	if c != nil {
+		c.Put(key, result)
+	}
+	return result, nil
+}
+
+// Cache returns the detector's Cache or nil if caching is turned off
+func (d *Detector) Cache() Cache {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.cache
+}
+
+// SetCache replaces the Cache used by the detector, or turns caching off if c is nil
+func (d *Detector) SetCache(c Cache) {
+	d.mu.Lock()
+	d.cache = c
+	d.mu.Unlock()
+}
+
+// SetCache will replace the Cache used by GetLanguageDetails
+func SetCache(c Cache) {
+	defaultDetector.SetCache(c)
+}
+
+// VendoredPolicy returns what the detector does with vendored files
+func (d *Detector) VendoredPolicy() VendoredPolicy {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.vendored
+}
+
+// SetVendoredPolicy sets what the detector does with vendored files
+func (d *Detector) SetVendoredPolicy(p VendoredPolicy) {
+	d.mu.Lock()
+	d.vendored = p
+	d.mu.Unlock()
+}
+
+// Segmentation returns true if the detector splits polyglot files into segments
+func (d *Detector) Segmentation() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.segments
+}
+
+// SetSegmentation turns the splitting of polyglot files into segments on or off
+func (d *Detector) SetSegmentation(on bool) {
+	d.mu.Lock()
+	d.segments = on
+	d.mu.Unlock()
+}
+
+// normalize returns filename with NormalizePath, relative to the detector's root if it has one
+func (d *Detector) normalize(filename string) string {
+	return relativePath(d.root, filename)
+}
+
+// Data returns the data files which the detector uses, which are the data of the package unless set with WithData
+func (d *Detector) Data() *generaltso.Data {
+	if data := d.ownData(); data != nil {
+		return data
+	}
+	return generaltso.CurrentData()
+}
+
+// SetData changes the data files which the detector uses. A nil data uses the data of the package.
+func (d *Detector) SetData(data *generaltso.Data) {
+	d.mu.Lock()
+	d.data = data
+	d.mu.Unlock()
+}
+
+// preoptimized returns true if the preoptimization table gives the same answers as the detector,
+// which is only when it runs DefaultStrategies with the data of the package the table is built from
+func (d *Detector) preoptimized() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.data != nil {
+		return false
+	}
+	defaults := DefaultStrategies()
+	if len(d.strategies) != len(defaults) {
+		return false
+	}
+	for i, s := range d.strategies {
+		if s != defaults[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ownData returns the data set with WithData or nil
+func (d *Detector) ownData() *generaltso.Data {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.data
+}
+
+// isVendored returns IsVendored with the detector's data
+func (d *Detector) isVendored(filename string) bool {
+	return isVendored(d.Data(), filename)
+}
+
+// isDocumentation returns IsDocumentation with the detector's data
+func (d *Detector) isDocumentation(filename string) bool {
+	return isDocumentation(d.Data(), filename)
+}
+
+// cacheKey returns the key of a file in the detector's Cache, which starts with the detector's version
+func (d *Detector) cacheKey(filename string, body []byte) string {
+	return d.cacheVersion() + "/" + contentKey(filename, body)
+}
+
+// cacheVersion returns a hash of everything which changes the detector's results: the exclusion
+// rules, the data files, the vendored policy, segmentation, the names of the strategies in the pipeline, the tokenizer and the classifier
+func (d *Detector) cacheVersion() string {
+	classifier := d.Classifier()
+	exclusions := atomic.LoadInt64(&rulesetGeneration)
+	d.mu.RLock()
+	v := d.version
+	strategies := d.strategiesVersion
+	vendored := d.vendored
+	segments := d.segments
+	data := d.data
+	if v.version != "" && v.exclusions == exclusions && v.strategies == strategies && v.classifier == classifier && v.vendored == vendored && v.segments == segments && v.data == data {
+		d.mu.RUnlock()
+		return v.version
+	}
+	names := make([]string, 0, len(d.strategies))
+	for _, s := range d.strategies {
+		names = append(names, s.Name())
+	}
+	tok := d.tokenizer
+	d.mu.RUnlock()
+	h := sha256.New()
+	fmt.Fprintln(h, rulesetVersion())
+	fmt.Fprintln(h, names)
+	fmt.Fprintln(h, "vendored", vendored)
+	fmt.Fprintln(h, "segments", segments)
+	if data != nil {
+		fmt.Fprintln(h, "data", data.Version())
+	}
+	if tok != nil {
+		fmt.Fprintf(h, "%v %+v\n", tok.IsLegacy(), tok.Syntax())
+	}
+	// hashing a model is slow, so only do it when the classifier changes
+	model := v.model
+	if v.classifier != classifier || model == "" {
+		model = modelVersion(classifier.Classifier)
+	}
+	fmt.Fprintln(h, classifier.Legacy, model)
+	v = detectorVersion{exclusions, strategies, classifier, vendored, segments, data, model, hex.EncodeToString(h.Sum(nil))[:16]}
+	d.mu.Lock()
+	d.version = v
+	d.mu.Unlock()
+	return v.version
+}
+
+// canceled wraps the error of a done context with the file being detected
+func canceled(err error, filename string) error {
+	return fmt.Errorf("linguist: detecting %s: %w", filename, err)
+}
+
+// lockGeneraltso waits for the generaltso lock or for ctx to be done
+func lockGeneraltso(ctx context.Context) error {
+	select {
+	case generaltsoLock <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func unlockGeneraltso() {
+	<-generaltsoLock
+}
+
+// detect runs the blob through the pipeline and returns the language and the name of the
+// strategy which decided it. If no strategy decided, the first of the remaining candidates in
+// alphabetical order is returned, so that every process returns the same language. ctx is
+// checked before each strategy.
+func (d *Detector) detect(ctx context.Context, blob *Blob) (string, string, error) {
+	var candidates []string
+	var decidedBy string
+	for _, s := range d.Strategies() {
+		if err := ctx.Err(); err != nil {
+			return "", "", err
+		}
+		sctx, span := startSpan(ctx, SpanStrategy+s.Name())
+		languages := s.Detect(sctx, blob, candidates)
+		if span.IsRecording() {
+			span.SetAttribute("candidates", candidates)
+			span.SetAttribute("languages", languages)
+		}
+		span.End()
+		if err := ctx.Err(); err != nil {
+			// the strategy may have given up early, so its answer can't be trusted
+			return "", "", err
+		}
+		if len(languages) == 1 {
+			return languages[0], s.Name(), nil
+		}
+		if len(languages) > 1 {
+			candidates = languages
+			decidedBy = s.Name()
+		}
+	}
+	if len(candidates) > 0 {
+		return firstLanguage(candidates), decidedBy, nil
+	}
+	return "", "", nil
+}
+
+func (d *Detector) getLanguageDetails(ctx context.Context, filename string, body []byte) (Result, error) {
+	blob := &Blob{Filename: filename, Body: body, detector: d}
+	// hold lock since generaltso isn't thread safe and uses shared maps
+	wait := time.Now()
+	if err := lockGeneraltso(ctx); err != nil {
+		return noResult, canceled(err, filename)
+	}
+	metrics().LockWait(time.Since(wait))
+	language, strategy, err := d.detect(ctx, blob)
+	if err != nil {
+		unlockGeneraltso()
+		return noResult, canceled(err, filename)
+	}
+	unlockGeneraltso()
+	// see if we have any language rule overrides
+	if l := languageOverride(language, filename); l != "" {
+		language = l
+	}
+	vendored := d.isVendored(filename)
+	binary := IsLikelyBinary(body)
+	generated := traceCheck(ctx, ExclusionGenerated, IsGenerated(filename, body))
+	documentation := traceCheck(ctx, ExclusionDocumentation, d.isDocumentation(filename))
+	test := IsTest(filename, language, body)
+	large := IsLargeBuffer(contentSize(filename, body))
+	excluded := binary || (vendored && d.VendoredPolicy() == VendoredExclude) || generated || (documentation && isDocumentationExcluded())
+	return Result{
+		Success:    true,
+		IsBinary:   binary,
+		IsVendored: vendored,
+		IsExcluded: excluded,
+		IsLarge:    large,
+		Result: &Detection{
+			Path:            filename,
+			Type:            "text",
+			Language:        registryLanguage(d.Data(), language),
+			Strategy:        strategy,
+			IsLarge:         large,
+			IsBinary:        binary,
+			IsGenerated:     generated,
+			IsVendored:      vendored,
+			IsDocumentation: documentation,
+			IsTest:          test,
+		},
+	}, nil
+}
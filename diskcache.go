@@ -0,0 +1,262 @@
+package linguist
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDiskCacheMaxSize is the default limit of bytes stored by a DiskCache
+const DefaultDiskCacheMaxSize = 256 << 20
+
+// DiskCacheOptions controls a DiskCache. The zero value uses the defaults.
+type DiskCacheOptions struct {
+	// MaxSize is the number of bytes the cache may use before the least recently used entries are evicted
+	MaxSize int64
+}
+
+// DiskCache is a persistent cache of detection results stored as a directory of sharded
+// files, so that short-lived processes scanning the same files can share results.
+//
+// A Detector's keys include the version of its ruleset and classifier, so changing the
+// classifier, the exclusion rules or the strategies automatically invalidates the entries.
+// Entries are written to a temporary file and renamed into place, so any number of processes
+// may use the same directory at once.
+type DiskCache struct {
+	dir      string
+	maxSize  int64
+	size     int64
+	entries  int64
+	hits     int64
+	misses   int64
+	evicting int32
+}
+
+const diskCacheSuffix = ".json"
+
+// NewDiskCache opens the cache in dir, creating it if needed
+func NewDiskCache(dir string, opts *DiskCacheOptions) (*DiskCache, error) {
+	c := &DiskCache{dir: dir, maxSize: DefaultDiskCacheMaxSize}
+	if opts != nil && opts.MaxSize > 0 {
+		c.maxSize = opts.MaxSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	size, err := c.walk(func(diskCacheEntry) {
+		c.entries++
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.size = size
+	return c, nil
+}
+
+var _ Cache = (*DiskCache)(nil)
+
+// Dir returns the directory of the cache
+func (c *DiskCache) Dir() string {
+	return c.dir
+}
+
+// Size returns the number of bytes used by the cache, as last counted by this process
+func (c *DiskCache) Size() int64 {
+	return atomic.LoadInt64(&c.size)
+}
+
+// path returns the file of the entry for key. Keys are hashed so that they are safe
+// file names, and the part of the key before the first / is used as a directory so
+// that the entries of a Detector version are kept together.
+func (c *DiskCache) path(key string) string {
+	namespace := "_"
+	if i := strings.Index(key, "/"); i > 0 {
+		namespace = hashKey(key[:i])
+	}
+	h := hashKey(key)
+	return filepath.Join(c.dir, namespace, h[:2], h[2:]+diskCacheSuffix)
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])[:32]
+}
+
+// Get returns the result stored for key
+func (c *DiskCache) Get(key string) (*Result, bool, error) {
+	fn := c.path(key)
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		atomic.AddInt64(&c.misses, 1)
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	var result Result
+	if err := json.Unmarshal(buf, &result); err != nil {
+		// a corrupt entry is a miss, and is replaced by the next Put
+		atomic.AddInt64(&c.misses, 1)
+		os.Remove(fn)
+		return nil, false, nil
+	}
+	// touch the entry so that eviction removes the least recently used entries first
+	now := time.Now()
+	os.Chtimes(fn, now, now)
+	atomic.AddInt64(&c.hits, 1)
+	return &result, true, nil
+}
+
+// Put stores the result for key
+func (c *DiskCache) Put(key string, result Result) error {
+	buf, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	fn := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(fn), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	// an entry which is replaced only counts for the difference in size
+	var replaced int64 = -1
+	if err == nil {
+		if info, serr := os.Stat(fn); serr == nil {
+			replaced = info.Size()
+		}
+		err = os.Rename(f.Name(), fn)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if replaced < 0 {
+		atomic.AddInt64(&c.entries, 1)
+		replaced = 0
+	}
+	if atomic.AddInt64(&c.size, int64(len(buf))-replaced) > c.maxSize {
+		c.evict()
+	}
+	return nil
+}
+
+// Delete removes the result stored for key
+func (c *DiskCache) Delete(key string) error {
+	fn := c.path(key)
+	info, err := os.Stat(fn)
+	if err == nil {
+		err = os.Remove(fn)
+	}
+	if err == nil {
+		atomic.AddInt64(&c.entries, -1)
+		atomic.AddInt64(&c.size, -info.Size())
+	}
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Stats returns the hits and misses of this process, and the entries and size of the
+// cache as last counted by this process
+func (c *DiskCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:    atomic.LoadInt64(&c.hits),
+		Misses:  atomic.LoadInt64(&c.misses),
+		Entries: atomic.LoadInt64(&c.entries),
+		Size:    atomic.LoadInt64(&c.size),
+	}
+}
+
+// Clear removes all entries from the cache
+func (c *DiskCache) Clear() error {
+	entries, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(c.dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	atomic.StoreInt64(&c.size, 0)
+	atomic.StoreInt64(&c.entries, 0)
+	return nil
+}
+
+type diskCacheEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// walk returns the total size of the entries in the cache and calls fn for each one
+func (c *DiskCache) walk(fn func(diskCacheEntry)) (int64, error) {
+	var total int64
+	err := filepath.Walk(c.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				// removed by another process
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() || !strings.HasSuffix(path, diskCacheSuffix) {
+			return nil
+		}
+		total += info.Size()
+		if fn != nil {
+			fn(diskCacheEntry{path, info.Size(), info.ModTime()})
+		}
+		return nil
+	})
+	return total, err
+}
+
+// evict removes the least recently used entries until the cache is at 90% of its maximum
+// size. Entries from other ruleset or classifier versions are never used again, so they
+// are the first to go.
+func (c *DiskCache) evict() {
+	if !atomic.CompareAndSwapInt32(&c.evicting, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&c.evicting, 0)
+	entries := make([]diskCacheEntry, 0)
+	total, err := c.walk(func(e diskCacheEntry) {
+		entries = append(entries, e)
+	})
+	if err != nil {
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+	target := c.maxSize / 10 * 9
+	count := int64(len(entries))
+	for _, e := range entries {
+		if total <= target {
+			break
+		}
+		if err := os.Remove(e.path); err == nil || os.IsNotExist(err) {
+			total -= e.size
+			count--
+			metrics().Cache(CacheEvict)
+		}
+	}
+	atomic.StoreInt64(&c.size, total)
+	atomic.StoreInt64(&c.entries, count)
+}
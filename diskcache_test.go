@@ -0,0 +1,185 @@
+package linguist
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newDiskCache(t *testing.T, opts *DiskCacheOptions) *DiskCache {
+	dir, err := ioutil.TempDir("", "linguist-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewDiskCache(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestDiskCache(t *testing.T) {
+	assert := assert.New(t)
+	c := newDiskCache(t, nil)
+	defer os.RemoveAll(c.Dir())
+	body := []byte("package main\n\nfunc main() {\n}\n")
+	d := NewDetector(WithCache(c))
+	r, err := d.GetLanguageDetails(context.Background(), "main.foogo", body)
+	assert.NoError(err)
+	assert.False(r.IsCached)
+	assert.Equal("Go", r.Result.Language.Name)
+	assert.True(c.Size() > 0)
+
+	// another process using the same directory gets the cached result
+	c2, err := NewDiskCache(c.Dir(), nil)
+	assert.NoError(err)
+	assert.Equal(c.Size(), c2.Size())
+	r, err = NewDetector(WithCache(c2)).GetLanguageDetails(context.Background(), "main.foogo", body)
+	assert.NoError(err)
+	assert.True(r.IsCached)
+	assert.Equal("Go", r.Result.Language.Name)
+	assert.Equal(ClassifierStrategyName, r.Result.Strategy)
+
+	// skip bypasses the cache
+	r, err = d.GetLanguageDetails(context.Background(), "main.foogo", body, true)
+	assert.NoError(err)
+	assert.False(r.IsCached)
+
+	// a corrupt entry is a miss
+	key := d.cacheKey("main.foogo", body)
+	assert.NoError(ioutil.WriteFile(c.path(key), []byte("{"), 0644))
+	_, ok, err := c.Get(key)
+	assert.NoError(err)
+	assert.False(ok)
+
+	stats := c.Stats()
+	assert.Equal(int64(1), stats.Entries)
+	// the first detection and the corrupt entry
+	assert.Equal(int64(2), stats.Misses)
+	assert.NoError(c.Delete(key))
+	assert.NoError(c.Delete(key))
+	assert.NoError(c.Clear())
+	_, ok, _ = c.Get(key)
+	assert.False(ok)
+}
+
+func TestDiskCacheVersion(t *testing.T) {
+	assert := assert.New(t)
+	d := NewDetector()
+	v := d.cacheVersion()
+	assert.Equal(v, d.cacheVersion())
+	assert.Equal(v, NewDetector().cacheVersion())
+
+	// changing the exclusion rules, pipeline or classifier changes the version
+	AddExcludedExtension(".foocache")
+	assert.NotEqual(v, d.cacheVersion())
+	RemoveExcludedExtension(".foocache")
+	assert.Equal(v, d.cacheVersion())
+
+	d.RemoveStrategy(HeuristicsStrategyName)
+	assert.NotEqual(v, d.cacheVersion())
+
+	dir := writeSamples(t, map[string]string{
+		"Widget/a.w": "widget frob knob\n",
+		"Gadget/a.g": "gadget whirr click\n",
+	})
+	defer os.RemoveAll(dir)
+	classifier, err := Train(dir)
+	assert.NoError(err)
+	other, err := Train(dir)
+	assert.NoError(err)
+	// equal classifiers have the same version
+	assert.Equal(modelVersion(classifier.Classifier), modelVersion(other.Classifier))
+	// scoring documents doesn't change the version, and neither does saving and loading the classifier
+	classifier.LogScores([]string{"widget"})
+	assert.Equal(modelVersion(other.Classifier), modelVersion(classifier.Classifier))
+	var buf bytes.Buffer
+	assert.NoError(WriteClassifier(&buf, classifier))
+	loaded, err := ReadClassifier(&buf)
+	assert.NoError(err)
+	assert.Equal(modelVersion(other.Classifier), modelVersion(loaded.Classifier))
+	assert.Equal(NewDetector(WithClassifier(other)).cacheVersion(), NewDetector(WithClassifier(loaded)).cacheVersion())
+	assert.NotEqual(v, NewDetector(WithClassifier(classifier)).cacheVersion())
+}
+
+func TestDiskCachePutTwice(t *testing.T) {
+	assert := assert.New(t)
+	c := newDiskCache(t, nil)
+	defer os.RemoveAll(c.Dir())
+	result := Result{Success: true, Result: &Detection{Path: "foo.go", Language: &Language{Name: "Go"}}}
+	assert.NoError(c.Put("v1/foo.go", result))
+	size := c.Size()
+	// replacing an entry doesn't count it again
+	assert.NoError(c.Put("v1/foo.go", result))
+	assert.Equal(size, c.Size())
+	assert.Equal(int64(1), c.Stats().Entries)
+	result.Result.Path = "a/longer/path/to/foo.go"
+	assert.NoError(c.Put("v1/foo.go", result))
+	assert.True(c.Size() > size)
+	assert.Equal(int64(1), c.Stats().Entries)
+	walked, err := c.walk(nil)
+	assert.NoError(err)
+	assert.Equal(walked, c.Size())
+
+	assert.NoError(c.Delete("v1/foo.go"))
+	assert.Equal(int64(0), c.Size())
+	assert.Equal(int64(0), c.Stats().Entries)
+	assert.NoError(c.Delete("v1/foo.go"))
+	assert.Equal(int64(0), c.Size())
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	assert := assert.New(t)
+	c := newDiskCache(t, &DiskCacheOptions{MaxSize: 4096})
+	defer os.RemoveAll(c.Dir())
+	result := Result{Success: true, Result: &Detection{Path: "foo.go", Language: &Language{Name: "Go"}}}
+	for i := 0; i < 200; i++ {
+		assert.NoError(c.Put(fmt.Sprintf("v1/foo%d.go", i), result))
+	}
+	assert.True(c.Size() <= 4096, "size %d", c.Size())
+	size, err := c.walk(nil)
+	assert.NoError(err)
+	assert.Equal(size, c.Size())
+	// the most recent entry survives
+	_, ok, _ := c.Get("v1/foo199.go")
+	assert.True(ok)
+	_, ok, _ = c.Get("v1/foo0.go")
+	assert.False(ok)
+}
+
+func TestDiskCacheConcurrency(t *testing.T) {
+	c := newDiskCache(t, nil)
+	defer os.RemoveAll(c.Dir())
+	result := Result{Success: true, Result: &Detection{Path: "foo.go", Language: &Language{Name: "Go"}}}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		// each goroutine uses its own DiskCache to simulate separate processes
+		dc, err := NewDiskCache(c.Dir(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(dc *DiskCache) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				key := fmt.Sprintf("v1/foo%d.go", j)
+				dc.Put(key, result)
+				if r, ok, _ := dc.Get(key); !ok || r.Result.Language.Name != "Go" {
+					t.Error("expected cached result")
+					return
+				}
+			}
+		}(dc)
+	}
+	wg.Wait()
+	// no temporary files are left behind
+	tmp, _ := filepath.Glob(filepath.Join(c.Dir(), "*", "*", ".tmp-*"))
+	assert.Empty(t, tmp)
+}
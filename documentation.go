@@ -0,0 +1,72 @@
+package linguist
+
+import (
+	"sync/atomic"
+
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+)
+
+var (
+	// documentationRules are checked in addition to the documentation.yml rules of linguist
+	documentationRules = []Match{
+		NewMatcher(`(^|/)AUTHORS(\.|$)`),
+		NewMatcher(`(^|/)PATENTS(\.|$)`),
+		NewMatcher(`(^|/)CODE_OF_CONDUCT(\.|$)`),
+		NewMatcher(`(^|/)PULL_REQUEST_TEMPLATE(\.|$)`),
+		NewMatcher(`(^|/)ISSUE_TEMPLATE(\.|/|$)`),
+	}
+	excludeDocumentation int32
+)
+
+// IsDocumentation returns true if the file is documentation according to the documentation.yml
+// rules of linguist or a rule added with AddDocumentationRule
+func IsDocumentation(filename string) bool {
+	return isDocumentation(generaltso.CurrentData(), NormalizePath(filename))
+}
+
+// isDocumentation is IsDocumentation with the documentation.yml rules of data
+func isDocumentation(data *generaltso.Data, filename string) bool {
+	if data.IsDocumentation(filename) {
+		return true
+	}
+	for _, rule := range documentationRules {
+		if rule.MatchString(filename) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddDocumentationRule will add a rule for files which are documentation
+func AddDocumentationRule(match Match) {
+	defer atomic.AddInt64(&rulesetGeneration, 1)
+	documentationRules = append(documentationRules, match)
+}
+
+// RemoveDocumentationRule will remove the added match from the documentation rules
+func RemoveDocumentationRule(match Match) {
+	defer atomic.AddInt64(&rulesetGeneration, 1)
+	for i, m := range documentationRules {
+		if match == m {
+			documentationRules = append(documentationRules[:i], documentationRules[i+1:]...)
+			break
+		}
+	}
+}
+
+// SetExcludeDocumentation sets whether documentation is excluded. Documentation is always detected
+// and flagged with Detection.IsDocumentation, but it is only marked as excluded, like vendored and
+// generated files, when exclude is true. The default is false.
+func SetExcludeDocumentation(exclude bool) {
+	defer atomic.AddInt64(&rulesetGeneration, 1)
+	var v int32
+	if exclude {
+		v = 1
+	}
+	atomic.StoreInt32(&excludeDocumentation, v)
+}
+
+// isDocumentationExcluded returns true if documentation is excluded
+func isDocumentationExcluded() bool {
+	return atomic.LoadInt32(&excludeDocumentation) == 1
+}
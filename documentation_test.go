@@ -0,0 +1,108 @@
+package linguist
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsDocumentation(t *testing.T) {
+	assert := assert.New(t)
+	for _, name := range []string{
+		"docs/index.md",
+		"project/Documentation/api.txt",
+		"README.md",
+		"src/CHANGELOG",
+		"LICENSE",
+		"AUTHORS.md",
+		".github/PULL_REQUEST_TEMPLATE.md",
+		"CODE_OF_CONDUCT.md",
+	} {
+		assert.True(IsDocumentation(name), name)
+	}
+	for _, name := range []string{"main.go", "src/docsify.js", "lib/readme_parser.rb"} {
+		assert.False(IsDocumentation(name), name)
+	}
+}
+
+func TestDocumentationRule(t *testing.T) {
+	assert := assert.New(t)
+	rule := NewMatcher(`^handbook/`)
+	assert.False(IsDocumentation("handbook/intro.md"))
+	AddDocumentationRule(rule)
+	assert.True(IsDocumentation("handbook/intro.md"))
+	RemoveDocumentationRule(rule)
+	assert.False(IsDocumentation("handbook/intro.md"))
+}
+
+func TestDocumentationDetected(t *testing.T) {
+	assert := assert.New(t)
+	body := []byte("# Usage\n\nRun the thing.\n")
+	for _, skip := range []bool{false, true} {
+		r, err := GetLanguageDetails(context.Background(), "docs/usage.md", body, skip)
+		assert.NoError(err)
+		assert.Equal("Markdown", r.Result.Language.Name)
+		assert.True(r.Result.IsDocumentation)
+		assert.False(r.IsExcluded)
+	}
+	r, err := GetLanguageDetails(context.Background(), "AUTHORS.md", []byte("* Jane\n"))
+	assert.NoError(err)
+	assert.NotNil(r.Result)
+	assert.True(r.Result.IsDocumentation)
+	r, err = GetLanguageDetails(context.Background(), "src/main.go", []byte("package main\n"))
+	assert.NoError(err)
+	assert.False(r.Result.IsDocumentation)
+}
+
+func TestExcludeDocumentation(t *testing.T) {
+	assert := assert.New(t)
+	SetExcludeDocumentation(true)
+	defer SetExcludeDocumentation(false)
+	body := []byte("# Usage\n\nRun the thing.\n")
+	for _, skip := range []bool{false, true} {
+		r, err := GetLanguageDetails(context.Background(), "docs/usage.md", body, skip)
+		assert.NoError(err)
+		// still detected, but not counted
+		assert.Equal("Markdown", r.Result.Language.Name)
+		assert.True(r.Result.IsDocumentation)
+		assert.True(r.IsExcluded)
+	}
+}
+
+func TestScanDirectoryDocumentation(t *testing.T) {
+	assert := assert.New(t)
+	dir := writeTree(t, map[string]string{
+		"main.go":       "package main\n",
+		"docs/usage.md": "# Usage\n\nRun the thing.\n",
+		"LICENSE":       "Permission is hereby granted, free of charge\n",
+	})
+	defer os.RemoveAll(dir)
+	stats, err := ScanDirectory(context.Background(), dir, nil)
+	assert.NoError(err)
+	// documentation which isn't excluded counts towards its language and has a total of its own
+	files, bytes := stats.Documentation()
+	assert.Equal(2, files)
+	assert.Equal(int64(len("# Usage\n\nRun the thing.\n")+len("Permission is hereby granted, free of charge\n")), bytes)
+	markdown := stats.Language("Markdown")
+	if assert.NotNil(markdown) {
+		assert.Equal(1, markdown.Files)
+		assert.Equal(int64(len("# Usage\n\nRun the thing.\n")), markdown.Bytes)
+	}
+	assert.Equal(0, stats.Excluded())
+
+	// excluded documentation is only counted as excluded
+	SetExcludeDocumentation(true)
+	defer SetExcludeDocumentation(false)
+	stats, err = ScanDirectory(context.Background(), dir, nil)
+	assert.NoError(err)
+	files, _ = stats.Documentation()
+	assert.Equal(0, files)
+	assert.Equal(2, stats.Excluded())
+	assert.Nil(stats.Language("Markdown"))
+	files, bytes = stats.NonTests()
+	assert.Equal(1, files)
+	assert.Equal(int64(len("package main\n")), bytes)
+	assert.Len(stats.Languages(), 1)
+}
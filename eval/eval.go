@@ -0,0 +1,279 @@
+// Package eval measures the accuracy of language detection against a labeled corpus
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jhaynie/linguist"
+)
+
+// Excluded is the detected language reported for files which were excluded from detection
+const Excluded = "(excluded)"
+
+// DefaultWorst is the default number of misclassified files in a report
+const DefaultWorst = 20
+
+// Options controls an evaluation. The zero value uses the default detector without the preoptimization cache.
+type Options struct {
+	// Detector to evaluate, defaults to linguist.NewDetector()
+	Detector *linguist.Detector
+	// UseCache will allow results to come from the preoptimization cache
+	UseCache bool
+	// Worst is the number of misclassified files to report, defaults to DefaultWorst
+	Worst int
+}
+
+// Metrics are the precision, recall and F1 score for a language or the whole corpus
+type Metrics struct {
+	Support        int     `json:"support"`
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	FalseNegatives int     `json:"false_negatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	F1             float64 `json:"f1"`
+}
+
+func (m *Metrics) compute() {
+	m.Precision = ratio(m.TruePositives, m.TruePositives+m.FalsePositives)
+	m.Recall = ratio(m.TruePositives, m.TruePositives+m.FalseNegatives)
+	if m.Precision+m.Recall > 0 {
+		m.F1 = 2 * m.Precision * m.Recall / (m.Precision + m.Recall)
+	}
+}
+
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+// Misclassification is a file which was detected as the wrong language
+type Misclassification struct {
+	Path     string `json:"path"`
+	Expected string `json:"expected"`
+	Detected string `json:"detected"`
+	Strategy string `json:"strategy,omitempty"`
+	// Margin is how much more the classifier preferred the detected language over the
+	// expected one, as a difference of log scores. Larger is worse.
+	Margin float64 `json:"margin"`
+}
+
+// Report is the result of an evaluation
+type Report struct {
+	Files    int     `json:"files"`
+	Correct  int     `json:"correct"`
+	Accuracy float64 `json:"accuracy"`
+	// Overall sums the per-language counts and macro-averages their precision, recall and F1
+	Overall   Metrics                   `json:"overall"`
+	Languages map[string]*Metrics       `json:"languages"`
+	Confusion map[string]map[string]int `json:"confusion"`
+	// Strategies counts the files decided by each strategy
+	Strategies map[string]int       `json:"strategies"`
+	Worst      []*Misclassification `json:"worst"`
+}
+
+// Evaluate runs detection over a corpus directory laid out as <Language>/<file> and reports
+// how accurate the detector was. Files are detected using their path relative to the language directory.
+func Evaluate(ctx context.Context, corpusDir string, opts *Options) (*Report, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Detector == nil {
+		o.Detector = linguist.NewDetector()
+	}
+	if o.Worst <= 0 {
+		o.Worst = DefaultWorst
+	}
+	dirs, err := ioutil.ReadDir(corpusDir)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{
+		Languages:  make(map[string]*Metrics),
+		Confusion:  make(map[string]map[string]int),
+		Strategies: make(map[string]int),
+	}
+	misclassified := make([]*Misclassification, 0)
+	metrics := func(language string) *Metrics {
+		m := report.Languages[language]
+		if m == nil {
+			m = &Metrics{}
+			report.Languages[language] = m
+		}
+		return m
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || strings.HasPrefix(dir.Name(), ".") {
+			continue
+		}
+		expected := dir.Name()
+		root := filepath.Join(corpusDir, expected)
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if strings.HasPrefix(info.Name(), ".") {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			body, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(root, path)
+			rel = filepath.ToSlash(rel)
+			result, err := o.Detector.GetLanguageDetails(ctx, rel, body, !o.UseCache)
+			if err != nil {
+				return err
+			}
+			detected, strategy := Excluded, ""
+			if result.Result != nil && !result.IsExcluded {
+				detected = result.Result.Language.Name
+				strategy = result.Result.Strategy
+			}
+			report.Files++
+			report.Strategies[strategy]++
+			if report.Confusion[expected] == nil {
+				report.Confusion[expected] = make(map[string]int)
+			}
+			report.Confusion[expected][detected]++
+			metrics(expected).Support++
+			if detected == expected {
+				report.Correct++
+				metrics(expected).TruePositives++
+				return nil
+			}
+			metrics(expected).FalseNegatives++
+			if detected != Excluded {
+				metrics(detected).FalsePositives++
+			}
+			misclassified = append(misclassified, &Misclassification{
+				Path:     filepath.ToSlash(filepath.Join(expected, rel)),
+				Expected: expected,
+				Detected: detected,
+				Strategy: strategy,
+				Margin:   margin(o.Detector, body, expected, detected),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	report.Accuracy = ratio(report.Correct, report.Files)
+	var count int
+	for _, m := range report.Languages {
+		m.compute()
+		if m.Support == 0 {
+			// only detected, never expected, so it doesn't count towards the average
+			continue
+		}
+		count++
+		report.Overall.Support += m.Support
+		report.Overall.TruePositives += m.TruePositives
+		report.Overall.FalsePositives += m.FalsePositives
+		report.Overall.FalseNegatives += m.FalseNegatives
+		report.Overall.Precision += m.Precision
+		report.Overall.Recall += m.Recall
+		report.Overall.F1 += m.F1
+	}
+	if count > 0 {
+		report.Overall.Precision /= float64(count)
+		report.Overall.Recall /= float64(count)
+		report.Overall.F1 /= float64(count)
+	}
+	sort.SliceStable(misclassified, func(i, j int) bool {
+		if misclassified[i].Margin != misclassified[j].Margin {
+			return misclassified[i].Margin > misclassified[j].Margin
+		}
+		return misclassified[i].Path < misclassified[j].Path
+	})
+	if len(misclassified) > o.Worst {
+		misclassified = misclassified[:o.Worst]
+	}
+	report.Worst = misclassified
+	return report, nil
+}
+
+// margin returns the difference between the classifier scores of the detected and expected languages
+func margin(d *linguist.Detector, body []byte, expected, detected string) float64 {
+	classifier := d.Classifier()
+	scores, _, _ := classifier.LogScores(d.Tokenize(body))
+	e, f := math.Inf(-1), math.Inf(-1)
+	for i, class := range classifier.Classes {
+		switch string(class) {
+		case expected:
+			e = scores[i]
+		case detected:
+			f = scores[i]
+		}
+	}
+	if math.IsInf(e, 0) || math.IsInf(f, 0) {
+		// one of the languages isn't known to the classifier, so there's nothing to compare
+		return 0
+	}
+	return f - e
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes a human readable summary of the report
+func (r *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "files: %d correct: %d accuracy: %.4f\n", r.Files, r.Correct, r.Accuracy)
+	fmt.Fprintf(w, "macro precision: %.4f recall: %.4f f1: %.4f\n\n", r.Overall.Precision, r.Overall.Recall, r.Overall.F1)
+	languages := make([]string, 0, len(r.Languages))
+	for l := range r.Languages {
+		languages = append(languages, l)
+	}
+	sort.Strings(languages)
+	fmt.Fprintf(w, "%-30s %8s %9s %8s %8s\n", "language", "support", "precision", "recall", "f1")
+	for _, l := range languages {
+		m := r.Languages[l]
+		fmt.Fprintf(w, "%-30s %8d %9.4f %8.4f %8.4f\n", l, m.Support, m.Precision, m.Recall, m.F1)
+	}
+	fmt.Fprintf(w, "\nconfusion (expected -> detected):\n")
+	for _, l := range languages {
+		detected := make([]string, 0)
+		for d := range r.Confusion[l] {
+			if d != l {
+				detected = append(detected, d)
+			}
+		}
+		sort.Strings(detected)
+		for _, d := range detected {
+			fmt.Fprintf(w, "  %s -> %s: %d\n", l, d, r.Confusion[l][d])
+		}
+	}
+	if len(r.Worst) > 0 {
+		fmt.Fprintf(w, "\nworst misclassified:\n")
+		for _, m := range r.Worst {
+			fmt.Fprintf(w, "  %s: expected %s, detected %s by %s (margin %.2f)\n", m.Path, m.Expected, m.Detected, m.Strategy, m.Margin)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/jhaynie/linguist"
+	"github.com/jhaynie/linguist/generaltso/linguist/tokenizer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluate(t *testing.T) {
+	assert := assert.New(t)
+	report, err := Evaluate(context.Background(), "./testdata/corpus", nil)
+	assert.NoError(err)
+	assert.Equal(9, report.Files)
+	assert.Equal(8, report.Correct)
+	assert.InDelta(8.0/9.0, report.Accuracy, 0.0001)
+	// C/mislabeled.rb is Ruby labeled as C
+	assert.Equal(1, report.Confusion["C"]["Ruby"])
+	assert.Equal(1, report.Confusion["C"]["C"])
+	c := report.Languages["C"]
+	assert.Equal(2, c.Support)
+	assert.Equal(1, c.FalseNegatives)
+	assert.Equal(1.0, c.Precision)
+	assert.Equal(0.5, c.Recall)
+	ruby := report.Languages["Ruby"]
+	assert.Equal(1, ruby.FalsePositives)
+	assert.InDelta(2.0/3.0, ruby.Precision, 0.0001)
+	assert.Equal(1.0, ruby.Recall)
+	assert.Len(report.Worst, 1)
+	assert.Equal("C/mislabeled.rb", report.Worst[0].Path)
+	assert.Equal("Ruby", report.Worst[0].Detected)
+
+	var buf bytes.Buffer
+	assert.NoError(report.WriteJSON(&buf))
+	var decoded Report
+	assert.NoError(json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(report.Files, decoded.Files)
+	assert.Equal(report.Confusion, decoded.Confusion)
+
+	buf.Reset()
+	assert.NoError(report.WriteText(&buf))
+	assert.Contains(buf.String(), "C -> Ruby: 1")
+}
+
+func TestEvaluateCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Evaluate(ctx, "./testdata/corpus", nil)
+	assert.Equal(t, context.Canceled, err)
+}
+
+// evaluateTokenizer trains a classifier on the samples with the lexer or the legacy tokenizer
+// and returns the accuracy of the classifier on its own against the corpus
+func evaluateTokenizer(t *testing.T, legacy bool) float64 {
+	var tok []*tokenizer.Tokenizer
+	if legacy {
+		tok = append(tok, tokenizer.Legacy())
+	}
+	classifier, err := linguist.Train("./testdata/samples", tok...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := linguist.NewDetector(linguist.WithClassifier(classifier), linguist.WithStrategies(linguist.ClassifierStrategy))
+	report, err := Evaluate(context.Background(), "./testdata/corpus", &Options{Detector: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report.Accuracy
+}
+
+func TestTokenizerAccuracy(t *testing.T) {
+	lexer := evaluateTokenizer(t, false)
+	legacy := evaluateTokenizer(t, true)
+	t.Logf("classifier accuracy with lexer: %.4f legacy tokenizer: %.4f", lexer, legacy)
+	assert.True(t, lexer >= legacy, "lexer %.4f should be at least as accurate as the legacy tokenizer %.4f", lexer, legacy)
+}
@@ -0,0 +1,5 @@
+const path = require('path');
+
+module.exports = function (name) {
+  return path.join(__dirname, name);
+};
@@ -0,0 +1,10 @@
+import os
+
+
+def main():
+    for name in os.listdir("."):
+        print(name)
+
+
+if __name__ == "__main__":
+    main()
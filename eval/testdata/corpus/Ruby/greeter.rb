@@ -0,0 +1,9 @@
+class Greeter
+  def initialize(name)
+    @name = name
+  end
+
+  def greet
+    puts "Hello #{@name}"
+  end
+end
@@ -0,0 +1,15 @@
+#include <stdlib.h>
+#include "list.h"
+
+struct node *push(struct node **head, int value) {
+	struct node *n = malloc(sizeof(*n));
+	if (!n) return NULL;
+	n->value = value;
+	n->next = *head;
+	*head = n;
+	return n;
+}
+
+void free_list(struct node *head) {
+	while (head) { struct node *next = head->next; free(head); head = next; }
+}
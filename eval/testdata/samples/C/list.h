@@ -0,0 +1,12 @@
+#ifndef LIST_H
+#define LIST_H
+
+struct node {
+	int value;
+	struct node *next;
+};
+
+struct node *push(struct node **head, int value);
+void free_list(struct node *head);
+
+#endif
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type Server struct {
+	addr string
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "hello %s", r.URL.Path)
+}
+
+func New(addr string) *Server {
+	return &Server{addr: addr}
+}
+
+func (s *Server) Run() error {
+	if err := http.ListenAndServe(s.addr, s); err != nil {
+		return fmt.Errorf("listen: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package slice
+
+func Map(values []string, fn func(string) string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, fn(v))
+	}
+	return out
+}
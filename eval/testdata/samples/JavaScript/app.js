@@ -0,0 +1,11 @@
+'use strict';
+const express = require('express');
+const app = express();
+
+app.get('/', (req, res) => {
+  res.send('hello');
+});
+
+module.exports = function (port) {
+  return app.listen(port, () => console.log(`listening on ${port}`));
+};
@@ -0,0 +1,8 @@
+const fs = require('fs');
+
+exports.read = function (file, cb) {
+  fs.readFile(file, 'utf8', (err, data) => {
+    if (err) return cb(err);
+    cb(null, data.split('\n'));
+  });
+};
@@ -0,0 +1,14 @@
+#!/usr/bin/env python3
+import argparse
+import sys
+
+
+def parse(argv):
+    parser = argparse.ArgumentParser(description="example")
+    parser.add_argument("--verbose", action="store_true")
+    return parser.parse_args(argv)
+
+
+if __name__ == "__main__":
+    args = parse(sys.argv[1:])
+    print(args)
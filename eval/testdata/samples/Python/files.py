@@ -0,0 +1,12 @@
+import os
+
+
+def walk(root):
+    for dirpath, dirnames, filenames in os.walk(root):
+        for name in filenames:
+            yield os.path.join(dirpath, name)
+
+
+class Counter(object):
+    def __init__(self):
+        self.count = 0
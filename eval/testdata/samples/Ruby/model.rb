@@ -0,0 +1,15 @@
+class Model
+  attr_reader :name
+
+  def initialize(name)
+    @name = name
+  end
+
+  def add(a, b)
+    a + b
+  end
+
+  def to_s
+    "#{self.class}(#{@name})"
+  end
+end
@@ -0,0 +1,9 @@
+require 'rake'
+
+task :build => [:clean] do
+  sh "make"
+end
+
+task :clean do
+  rm_rf "build"
+end
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"log"
 	"math"
+	"sort"
+	"sync"
 
 	"github.com/jhaynie/linguist/generaltso/linguist/data"
 	"github.com/jhaynie/linguist/generaltso/linguist/tokenizer"
@@ -11,7 +13,7 @@ import (
 )
 
 var classifier *bayesian.Classifier
-var classifier_initialized bool = false
+var classifier_once sync.Once
 
 // Gets the baysian.Classifier which has been trained on programming language
 // samples from github.com/github/linguist after running the generator
@@ -21,7 +23,7 @@ func getClassifier() *bayesian.Classifier {
 	// NOTE(tso): this could probably go into an init() function instead
 	// but this lazy loading approach works, and it's conceivable that the
 	// analyse() function might not invoked in an actual runtime anyway
-	if !classifier_initialized {
+	classifier_once.Do(func() {
 		data, err := data.Asset("classifier")
 		if err != nil {
 			log.Panicln(err)
@@ -31,11 +33,24 @@ func getClassifier() *bayesian.Classifier {
 		if err != nil {
 			log.Panicln(err)
 		}
-		classifier_initialized = true
-	}
+	})
 	return classifier
 }
 
+// Returns the bayesian.Classifier embedded in the data package
+func DefaultClassifier() *bayesian.Classifier {
+	return getClassifier()
+}
+
+// Tokenizes contents the same way as the documents a classifier was trained with. Legacy
+// classifiers, such as the one embedded in the data package, were trained with tokenizer.TokenizeLegacy()
+func TokenizeFor(legacy bool, contents []byte) []string {
+	if legacy {
+		return tokenizer.TokenizeLegacy(contents)
+	}
+	return tokenizer.Tokenize(contents)
+}
+
 // Uses Naive Bayesian Classification on the file contents provided.
 //
 // Returns the name of a programming language, or the empty string if one could
@@ -45,10 +60,31 @@ func getClassifier() *bayesian.Classifier {
 //
 // Obtain hints from LanguageHints()
 //
+// A single hint is returned without tokenizing the contents, and if none of the
+// hints were trained into the classifier the first hint in alphabetical order is
+// returned, so a hint is never replaced by the empty string.
+//
 // NOTE(tso): May yield inaccurate results
 func Analyse(contents []byte, hints []string) (language string) {
-	document := tokenizer.Tokenize(contents)
-	classifier := getClassifier()
+	return AnalyseWith(getClassifier(), true, contents, hints)
+}
+
+// Same as Analyse() but uses the provided classifier instead of the one
+// embedded in the data package, such as one built with a custom set of samples.
+// legacy is true if the classifier was trained with tokenizer.TokenizeLegacy().
+func AnalyseWith(classifier *bayesian.Classifier, legacy bool, contents []byte, hints []string) (language string) {
+	if len(hints) == 1 {
+		return hints[0]
+	}
+	return AnalyseTokens(classifier, TokenizeFor(legacy, contents), hints)
+}
+
+// Same as AnalyseWith() but takes contents which have already been tokenized,
+// such as by a tokenizer.Tokenizer for a custom syntax.
+func AnalyseTokens(classifier *bayesian.Classifier, document []string, hints []string) (language string) {
+	if len(hints) == 1 {
+		return hints[0]
+	}
 	scores, idx, _ := classifier.LogScores(document)
 
 	if len(hints) == 0 {
@@ -72,5 +108,33 @@ func Analyse(contents []byte, hints []string) (language string) {
 			}
 		}
 	}
+	if best_answer == "" {
+		// the same hint whatever order the hints are in
+		best_answer = hints[0]
+		for _, hint := range hints[1:] {
+			if hint < best_answer {
+				best_answer = hint
+			}
+		}
+	}
 	return best_answer
 }
+
+// Score is the log probability the classifier gives a language for a document
+type Score struct {
+	Language string  `json:"language"`
+	Score    float64 `json:"score"`
+}
+
+// Returns the classifier's scores for a tokenized document, best first.
+func Scores(classifier *bayesian.Classifier, document []string) []Score {
+	scores, _, _ := classifier.LogScores(document)
+	result := make([]Score, 0, len(scores))
+	for id, score := range scores {
+		result = append(result, Score{string(classifier.Classes[id]), score})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Score > result[j].Score
+	})
+	return result
+}
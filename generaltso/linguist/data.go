@@ -0,0 +1,363 @@
+package linguist
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v1"
+)
+
+// Language is the entry of a language in languages.yml
+type Language struct {
+	Type         string   `yaml:"type,omitempty" json:"type,omitempty"`
+	Color        string   `yaml:"color,omitempty" json:"color,omitempty"`
+	Group        string   `yaml:"group,omitempty" json:"group,omitempty"`
+	AceMode      string   `yaml:"ace_mode,omitempty" json:"ace_mode,omitempty"`
+	Aliases      []string `yaml:"aliases,omitempty" json:"aliases,omitempty"`
+	Extensions   []string `yaml:"extensions,omitempty" json:"extensions,omitempty"`
+	Filenames    []string `yaml:"filenames,omitempty" json:"filenames,omitempty"`
+	Interpreters []string `yaml:"interpreters,omitempty" json:"interpreters,omitempty"`
+}
+
+// Data is a set of the languages.yml, vendor.yml and documentation.yml data files
+// of linguist which languages are detected with. It can't be changed once created.
+type Data struct {
+	languages     map[string]Language
+	vendor        []string
+	documentation []string
+	extensions    map[string][]string
+	// extensions in lower case
+	folded       map[string][]string
+	filenames    map[string][]string
+	interpreters map[string][]string
+	aliases      map[string]string
+	vendorRE     *regexp.Regexp
+	doxRE        *regexp.Regexp
+	version      string
+}
+
+var (
+	languageTypes = map[string]bool{"programming": true, "markup": true, "data": true, "prose": true}
+	colorRE       = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+	embeddedData  *Data
+	currentData   atomic.Value
+)
+
+func init() {
+	languages, err := ParseLanguages(strings.NewReader(files["data/languages.yml"]))
+	if err != nil {
+		log.Fatal(err)
+	}
+	vendor, err := ParsePatterns(strings.NewReader(files["data/vendor.yml"]))
+	if err != nil {
+		log.Fatal(err)
+	}
+	documentation, err := ParsePatterns(strings.NewReader(files["data/documentation.yml"]))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if embeddedData, err = NewData(languages, vendor, documentation); err != nil {
+		log.Fatal(err)
+	}
+	currentData.Store(embeddedData)
+}
+
+// Parses languages.yml from r, which must be a map of languages. The entries are checked by NewData.
+func ParseLanguages(r io.Reader) (map[string]Language, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var shape interface{}
+	if err := yaml.Unmarshal(buf, &shape); err != nil {
+		return nil, fmt.Errorf("error parsing languages: %v", err)
+	}
+	if _, ok := shape.(map[interface{}]interface{}); !ok && shape != nil {
+		return nil, fmt.Errorf("error parsing languages: expected a map of languages")
+	}
+	languages := make(map[string]Language)
+	if err := yaml.Unmarshal(buf, &languages); err != nil {
+		return nil, fmt.Errorf("error parsing languages: %v", err)
+	}
+	return languages, nil
+}
+
+// Parses a list of regular expressions such as vendor.yml or documentation.yml from r.
+//
+// Returns an error if r isn't a list of strings or any of them doesn't compile.
+func ParsePatterns(r io.Reader) ([]string, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var list []interface{}
+	if err := yaml.Unmarshal(buf, &list); err != nil {
+		return nil, fmt.Errorf("error parsing patterns: %v", err)
+	}
+	var shape interface{}
+	if err := yaml.Unmarshal(buf, &shape); err == nil && shape != nil && list == nil {
+		return nil, fmt.Errorf("error parsing patterns: expected a list of patterns")
+	}
+	patterns := make([]string, 0, len(list))
+	for _, v := range list {
+		p, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("error parsing patterns: %v isn't a string", v)
+		}
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", p, err)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// Returns Data for the languages and the vendor and documentation patterns.
+//
+// Returns an error if a language has an unknown type, a color which isn't #RRGGBB, an extension
+// without a leading dot, a filename with a slash, an interpreter with spaces, an empty alias or
+// an alias of another language, or if a pattern doesn't compile.
+func NewData(languages map[string]Language, vendor, documentation []string) (*Data, error) {
+	d := &Data{
+		languages:     make(map[string]Language, len(languages)),
+		vendor:        append([]string{}, vendor...),
+		documentation: append([]string{}, documentation...),
+		extensions:    make(map[string][]string),
+		folded:        make(map[string][]string),
+		filenames:     make(map[string][]string),
+		interpreters:  make(map[string][]string),
+		aliases:       make(map[string]string),
+	}
+	names := make([]string, 0, len(languages))
+	for n := range languages {
+		names = append(names, n)
+	}
+	// in order so that the languages of an extension, filename or interpreter are too
+	sort.Strings(names)
+	for _, n := range names {
+		l := languages[n]
+		if err := checkLanguage(n, l); err != nil {
+			return nil, err
+		}
+		d.languages[n] = l
+		for _, e := range l.Extensions {
+			d.extensions[e] = append(d.extensions[e], n)
+			if lower := strings.ToLower(e); !contains(d.folded[lower], n) {
+				d.folded[lower] = append(d.folded[lower], n)
+			}
+		}
+		for _, f := range l.Filenames {
+			d.filenames[f] = append(d.filenames[f], n)
+		}
+		for _, i := range l.Interpreters {
+			d.interpreters[i] = append(d.interpreters[i], n)
+		}
+	}
+	// names first, so that an alias can't take the name of another language
+	for _, n := range names {
+		d.aliases[strings.ToLower(n)] = n
+	}
+	for _, n := range names {
+		for _, a := range languages[n].Aliases {
+			if o, ok := d.aliases[strings.ToLower(a)]; ok && o != n {
+				return nil, fmt.Errorf("language %s: alias %q is %s", n, a, o)
+			}
+			d.aliases[strings.ToLower(a)] = n
+		}
+	}
+	var err error
+	if d.vendorRE, err = compilePatterns(d.vendor); err != nil {
+		return nil, fmt.Errorf("vendor: %v", err)
+	}
+	if d.doxRE, err = compilePatterns(d.documentation); err != nil {
+		return nil, fmt.Errorf("documentation: %v", err)
+	}
+	h := sha256.New()
+	for _, n := range names {
+		fmt.Fprintf(h, "%s %+v\n", n, d.languages[n])
+	}
+	fmt.Fprintln(h, d.vendor)
+	fmt.Fprintln(h, d.documentation)
+	d.version = hex.EncodeToString(h.Sum(nil))[:16]
+	return d, nil
+}
+
+func checkLanguage(name string, l Language) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("language without a name")
+	}
+	if l.Type != "" && !languageTypes[l.Type] {
+		return fmt.Errorf("language %s: unknown type %q", name, l.Type)
+	}
+	if l.Color != "" && !colorRE.MatchString(l.Color) {
+		return fmt.Errorf("language %s: color %q isn't #RRGGBB", name, l.Color)
+	}
+	for _, e := range l.Extensions {
+		if len(e) < 2 || e[0] != '.' || strings.ContainsAny(e, "/ ") {
+			return fmt.Errorf("language %s: extension %q must start with a dot", name, e)
+		}
+	}
+	for _, f := range l.Filenames {
+		if f == "" || strings.Contains(f, "/") {
+			return fmt.Errorf("language %s: invalid filename %q", name, f)
+		}
+	}
+	for _, i := range l.Interpreters {
+		if i == "" || strings.ContainsAny(i, " \t/") {
+			return fmt.Errorf("language %s: invalid interpreter %q", name, i)
+		}
+	}
+	for _, a := range l.Aliases {
+		if strings.TrimSpace(a) == "" {
+			return fmt.Errorf("language %s: invalid alias %q", name, a)
+		}
+	}
+	return nil
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// compilePatterns returns a regular expression which matches any of the patterns, or
+// nil if there are none
+func compilePatterns(patterns []string) (*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", p, err)
+		}
+	}
+	return regexp.Compile("(?:" + strings.Join(patterns, ")|(?:") + ")")
+}
+
+// Returns the data files built in to the package
+func EmbeddedData() *Data {
+	return embeddedData
+}
+
+// Returns the data which the functions of the package use, which is EmbeddedData unless
+// it was changed with SetData.
+func CurrentData() *Data {
+	return currentData.Load().(*Data)
+}
+
+// Changes the data which the functions of the package use. A nil d restores EmbeddedData.
+func SetData(d *Data) {
+	if d == nil {
+		d = embeddedData
+	}
+	currentData.Store(d)
+}
+
+// Returns a hash of the contents of the data
+func (d *Data) Version() string {
+	return d.version
+}
+
+// Returns the names of the languages in alphabetical order
+func (d *Data) Languages() []string {
+	names := make([]string, 0, len(d.languages))
+	for n := range d.languages {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the entry of a language, or false if there isn't one
+func (d *Data) Language(name string) (Language, bool) {
+	l, ok := d.languages[name]
+	return l, ok
+}
+
+// Returns the vendor.yml patterns
+func (d *Data) Vendor() []string {
+	return append([]string{}, d.vendor...)
+}
+
+// Returns the documentation.yml patterns
+func (d *Data) Documentation() []string {
+	return append([]string{}, d.documentation...)
+}
+
+// Returns all languages which list the longest extension of filename, see MatchExtension
+func (d *Data) LanguagesByExtension(filename string) []string {
+	if ext := d.Extension(filename); ext != "" {
+		return d.ExtensionLanguages(ext)
+	}
+	return nil
+}
+
+// Returns the longest extension of filename which is listed, see MatchExtension, or the
+// empty string if there is none
+func (d *Data) Extension(filename string) string {
+	return MatchExtension(filename, func(ext string) bool {
+		return len(d.ExtensionLanguages(ext)) > 0
+	})
+}
+
+// Returns all languages which list the extension, such as .blade.php, or which list it in a
+// different case if the extension is in lower case
+func (d *Data) ExtensionLanguages(ext string) []string {
+	if l := d.extensions[ext]; len(l) > 0 {
+		return l
+	}
+	return d.folded[ext]
+}
+
+// Returns all languages which list the base name of filename, such as Makefile for build/Makefile
+func (d *Data) LanguagesByFilename(filename string) []string {
+	return d.filenames[BaseName(filename)]
+}
+
+// Returns all languages which list the interpreter
+func (d *Data) LanguagesByInterpreter(interpreter string) []string {
+	return d.interpreters[interpreter]
+}
+
+// Returns the language for a name or alias (case-insensitive), or the empty string if there is no such language
+func (d *Data) LanguageByAlias(alias string) string {
+	return d.aliases[strings.ToLower(alias)]
+}
+
+// Returns all languages of the base name of filename and then of its extension
+func (d *Data) LanguageHints(filename string) (hints []string) {
+	hints = append(hints, d.LanguagesByFilename(filename)...)
+	return append(hints, d.LanguagesByExtension(filename)...)
+}
+
+// Returns the extensions which belong to exactly one language, mapped to that language
+func (d *Data) UnambiguousExtensions() map[string]string {
+	return unambiguous(d.extensions)
+}
+
+// Returns the filenames which belong to exactly one language, mapped to that language
+func (d *Data) UnambiguousFilenames() map[string]string {
+	return unambiguous(d.filenames)
+}
+
+// Checks if path matches the vendor patterns
+func (d *Data) IsVendored(path string) bool {
+	return d.vendorRE != nil && d.vendorRE.MatchString(path)
+}
+
+// Checks if path matches the documentation patterns
+func (d *Data) IsDocumentation(path string) bool {
+	return d.doxRE != nil && d.doxRE.MatchString(path)
+}
@@ -15,14 +15,6 @@
 
 package linguist
 
-import (
-	"log"
-	"regexp"
-	"strings"
-
-	"gopkg.in/yaml.v1"
-)
-
 // Checks if filename should not be passed to LanguageByFilename.
 //
 // (this simply calls IsVendored and IsDocumentation)
@@ -37,35 +29,14 @@ func ShouldIgnoreContents(contents []byte) bool {
 	return IsBinary(contents)
 }
 
-var vendorRE *regexp.Regexp
-var doxRE *regexp.Regexp
-
-func init() {
-	var regexps []string
-	bytes := []byte(files["data/vendor.yml"])
-	if err := yaml.Unmarshal(bytes, &regexps); err != nil {
-		log.Fatal(err)
-		return
-	}
-	vendorRE = regexp.MustCompile(strings.Join(regexps, "|"))
-
-	var moreregex []string
-	bytes = []byte(files["data/documentation.yml"])
-	if err := yaml.Unmarshal(bytes, &moreregex); err != nil {
-		log.Fatal(err)
-		return
-	}
-	doxRE = regexp.MustCompile(strings.Join(moreregex, "|"))
-}
-
 // Checks if path contains a filename commonly belonging to configuration files.
 func IsVendored(path string) bool {
-	return vendorRE.MatchString(path)
+	return CurrentData().IsVendored(path)
 }
 
 // Checks if path contains a filename commonly belonging to documentation.
 func IsDocumentation(path string) bool {
-	return doxRE.MatchString(path)
+	return CurrentData().IsDocumentation(path)
 }
 
 // Checks contents for known character escape codes which
@@ -0,0 +1,50 @@
+package linguist
+
+import "strings"
+
+// Returns the last element of filename, which may be separated with forward or backward slashes
+func BaseName(filename string) string {
+	if i := strings.LastIndexAny(filename, `/\`); i >= 0 {
+		return filename[i+1:]
+	}
+	return filename
+}
+
+// Returns the extensions of the base name of filename from the longest to the shortest, such
+// as .blade.php and .php for index.blade.php, or .eslintrc.json and .json for .eslintrc.json.
+//
+// Returns nil if the name has no extension.
+func Extensions(filename string) []string {
+	base := BaseName(filename)
+	var exts []string
+	for i := 0; i < len(base); i++ {
+		if base[i] != '.' {
+			continue
+		}
+		// a leading dot is part of the name or the first extension of a dot file
+		if ext := base[i:]; len(ext) > 1 && !strings.HasSuffix(ext, ".") {
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
+
+// Returns the longest extension of filename for which found returns true. The extensions are
+// first tried as they are and then in lower case, so FOO.C matches .C before .c and FOO.CPP
+// matches .cpp.
+//
+// Returns the empty string if none was found.
+func MatchExtension(filename string, found func(ext string) bool) string {
+	exts := Extensions(filename)
+	for _, ext := range exts {
+		if found(ext) {
+			return ext
+		}
+	}
+	for _, ext := range exts {
+		if lower := strings.ToLower(ext); lower != ext && found(lower) {
+			return lower
+		}
+	}
+	return ""
+}
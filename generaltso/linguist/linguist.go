@@ -15,53 +15,9 @@
 
 package linguist
 
-import (
-	"bufio"
-	"bytes"
-	"log"
-	"path/filepath"
-	"regexp"
-
-	"gopkg.in/yaml.v1"
-)
-
-var (
-	extensions   = map[string][]string{}
-	filenames    = map[string][]string{}
-	interpreters = map[string][]string{}
-	colors       = map[string]string{}
-
-	shebangRE       = regexp.MustCompile(`^#!\s*(\S+)(?:\s+(\S+))?.*`)
-	scriptVersionRE = regexp.MustCompile(`((?:\d+\.?)+)`)
-)
-
-func init() {
-	type language struct {
-		Extensions   []string `yaml:"extensions,omitempty"`
-		Filenames    []string `yaml:"filenames,omitempty"`
-		Interpreters []string `yaml:"interpreters,omitempty"`
-		Color        string   `yaml:"color,omitempty"`
-	}
-	languages := map[string]*language{}
-
-	bytes := []byte(files["data/languages.yml"])
-	if err := yaml.Unmarshal(bytes, languages); err != nil {
-		log.Fatal(err)
-	}
+import "regexp"
 
-	for n, l := range languages {
-		for _, e := range l.Extensions {
-			extensions[e] = append(extensions[e], n)
-		}
-		for _, f := range l.Filenames {
-			filenames[f] = append(filenames[f], n)
-		}
-		for _, i := range l.Interpreters {
-			interpreters[i] = append(interpreters[i], n)
-		}
-		colors[n] = l.Color
-	}
-}
+var scriptVersionRE = regexp.MustCompile(`((?:\d+\.?)+)`)
 
 // Convenience function that returns the color associated
 // with the language, in HTML Hex notation (e.g. "#123ABC")
@@ -69,10 +25,52 @@ func init() {
 //
 // Returns the empty string if there is no associated color for the language.
 func LanguageColor(language string) string {
-	if c, ok := colors[language]; ok {
-		return c
+	l, _ := CurrentData().Language(language)
+	return l.Color
+}
+
+// Returns the type of the language from the languages.yml file, one of
+// "programming", "markup", "data" or "prose", or the empty string if the
+// language is unknown.
+func LanguageType(language string) string {
+	l, _ := CurrentData().Language(language)
+	return l.Type
+}
+
+// Returns the group the language belongs to in the languages.yml file, such as
+// "JavaScript" for "JSX", or the empty string if it isn't in a group.
+func LanguageGroup(language string) string {
+	l, _ := CurrentData().Language(language)
+	return l.Group
+}
+
+// Returns the Ace editor mode of the language from the languages.yml file,
+// or the empty string if the language is unknown.
+func LanguageAceMode(language string) string {
+	l, _ := CurrentData().Language(language)
+	return l.AceMode
+}
+
+// Returns the extensions in languages.yml which belong to exactly one language,
+// mapped to that language.
+func UnambiguousExtensions() map[string]string {
+	return CurrentData().UnambiguousExtensions()
+}
+
+// Returns the filenames in languages.yml which belong to exactly one language,
+// mapped to that language.
+func UnambiguousFilenames() map[string]string {
+	return CurrentData().UnambiguousFilenames()
+}
+
+func unambiguous(m map[string][]string) map[string]string {
+	result := make(map[string]string)
+	for k, l := range m {
+		if len(l) == 1 {
+			result[k] = l[0]
+		}
 	}
-	return ""
+	return result
 }
 
 // Attempts to determine the language of a source file based solely on 
@@ -81,14 +79,12 @@ func LanguageColor(language string) string {
 //
 // Returns the empty string in ambiguous or unrecognized cases.
 func LanguageByFilename(filename string) string {
-	if l := filenames[filename]; len(l) == 1 {
+	d := CurrentData()
+	if l := d.LanguagesByFilename(filename); len(l) == 1 {
 		return l[0]
 	}
-	ext := filepath.Ext(filename)
-	if ext != "" {
-		if l := extensions[ext]; len(l) == 1 {
-			return l[0]
-		}
+	if l := d.LanguagesByExtension(filename); len(l) == 1 {
+		return l[0]
 	}
 	return ""
 }
@@ -101,15 +97,28 @@ func LanguageByFilename(filename string) string {
 //
 // May return an empty slice.
 func LanguageHints(filename string) (hints []string) {
-	if l, ok := filenames[filename]; ok {
-		hints = append(hints, l...)
-	}
-	if ext := filepath.Ext(filename); ext != "" {
-		if l, ok := extensions[ext]; ok {
-			hints = append(hints, l...)
-		}
-	}
-	return hints
+	return CurrentData().LanguageHints(filename)
+}
+
+// Returns all languages which list the base name of filename in languages.yml
+func LanguagesByFilename(filename string) []string {
+	return CurrentData().LanguagesByFilename(filename)
+}
+
+// Returns all languages which list the extension of filename in languages.yml
+func LanguagesByExtension(filename string) []string {
+	return CurrentData().LanguagesByExtension(filename)
+}
+
+// Returns all languages which list the interpreter in languages.yml
+func LanguagesByInterpreter(interpreter string) []string {
+	return CurrentData().LanguagesByInterpreter(interpreter)
+}
+
+// Returns the language for a name or alias (case-insensitive) such as "js" or "ruby",
+// or the empty string if there is no such language.
+func LanguageByAlias(alias string) string {
+	return CurrentData().LanguageByAlias(alias)
 }
 
 // Attempts to detect the language of a source file based on its
@@ -117,29 +126,51 @@ func LanguageHints(filename string) (hints []string) {
 //
 // Obtain hints with LanguageHints()
 //
+// A single hint is returned as is without running the classifier.
+//
 // Returns the empty string a language could not be determined.
 func LanguageByContents(contents []byte, hints []string) string {
 	interpreter := detectInterpreter(contents)
 	if interpreter != "" {
-		if l := interpreters[interpreter]; len(l) == 1 {
+		if l := CurrentData().LanguagesByInterpreter(interpreter); len(l) == 1 {
 			return l[0]
+		} else if len(l) > 1 {
+			// the languages of the interpreter become the hints, or narrow them
+			hints = narrowHints(hints, l)
 		}
 	}
+	if len(hints) == 1 {
+		return hints[0]
+	}
 	return Analyse(contents, hints)
 }
 
+// Returns the interpreter named by the shebang line of contents, with any
+// version number stripped, or the empty string if there is none. See ParseShebang.
+func DetectInterpreter(contents []byte) string {
+	return detectInterpreter(contents)
+}
+
 func detectInterpreter(contents []byte) string {
-	scanner := bufio.NewScanner(bytes.NewReader(contents))
-	scanner.Scan()
-	line := scanner.Text()
-	m := shebangRE.FindStringSubmatch(line)
-	if m == nil || len(m) != 3 {
-		return ""
+	if s, ok := ParseShebang(contents); ok {
+		return s.Interpreter
+	}
+	return ""
+}
+
+// narrowHints returns the hints which are also languages, or the languages if there are none
+func narrowHints(hints, languages []string) []string {
+	var narrowed []string
+	for _, h := range hints {
+		for _, l := range languages {
+			if h == l {
+				narrowed = append(narrowed, h)
+				break
+			}
+		}
 	}
-	base := filepath.Base(m[1])
-	if base == "env" && m[2] != "" {
-		base = m[2]
+	if len(narrowed) == 0 {
+		return languages
 	}
-	// Strip suffixed version number.
-	return scriptVersionRE.ReplaceAllString(base, "")
+	return narrowed
 }
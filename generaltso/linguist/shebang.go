@@ -0,0 +1,171 @@
+package linguist
+
+import (
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Shebang is the parsed #! line of a script
+type Shebang struct {
+	// Path is the program named by the #! line, such as /usr/bin/env
+	Path string
+	// Interpreter is the name of the interpreter which runs the script as listed in
+	// languages.yml, such as python for #!/usr/bin/env python3.12 and perl for perl5.36,
+	// or without any version if it isn't listed.
+	Interpreter string
+	// Version is the version stripped from the name of the interpreter, such as 3.12
+	Version string
+	// Args are the arguments passed to the interpreter
+	Args []string
+	// Exec is true if the interpreter is run by an exec line of a shell script,
+	// such as exec ruby "$0" "$@" following #!/bin/sh
+	Exec bool
+}
+
+var (
+	// a trailing version such as 3, 3.12 or -5.36
+	versionSuffixRE = regexp.MustCompile(`[.-]?\d+$`)
+	// all the trailing versions
+	versionRE = regexp.MustCompile(`\d+(?:[.-]\d+)*$`)
+	// exec tclsh "$0" ${1+"$@"} or exec /usr/bin/env ruby -x "$0" "$@"
+	execRE = regexp.MustCompile(`(?m)^[^#\n]*\bexec\s+(?:\S*/)?(?:env\s+)?([A-Za-z][\w.+-]*)[^\n]*\$\{?0\b`)
+	// shells which can re-dispatch a script to another interpreter with exec
+	shells = map[string]bool{"sh": true, "bash": true, "zsh": true, "ksh": true, "mksh": true, "dash": true, "ash": true}
+)
+
+// the number of lines after a shell #! line searched for an exec line
+const execSearchLines = 5
+
+// options of env which take a separate argument
+var envArgOptions = map[string]bool{"-u": true, "--unset": true, "-C": true, "--chdir": true, "-P": true, "-a": true, "--argv0": true}
+
+// Parses the #! line at the start of contents. The #! line may name the interpreter
+// directly or through env with options such as -S and -i and VAR=value assignments,
+// and a shell script may exec another interpreter with itself in one of the following
+// lines. Bytes which aren't UTF-8 are replaced.
+//
+// Returns false if contents doesn't start with a #! line.
+func ParseShebang(contents []byte) (Shebang, bool) {
+	return CurrentData().ParseShebang(contents)
+}
+
+// Parses the #! line at the start of contents with the interpreters of d, see ParseShebang
+func (d *Data) ParseShebang(contents []byte) (Shebang, bool) {
+	contents = bytes.TrimPrefix(contents, []byte("\xef\xbb\xbf"))
+	if !bytes.HasPrefix(contents, []byte("#!")) {
+		return Shebang{}, false
+	}
+	line := contents[2:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(toValidUTF8(string(line)))
+	if len(fields) == 0 {
+		return Shebang{}, false
+	}
+	s := Shebang{Path: fields[0]}
+	program, args := path.Base(fields[0]), fields[1:]
+	if program == "env" {
+		program, args = parseEnv(args)
+		if program == "" {
+			return Shebang{}, false
+		}
+	}
+	s.Interpreter, s.Version = d.interpreterName(program)
+	s.Args = args
+	if shells[s.Interpreter] {
+		lines := bytes.SplitN(contents, []byte("\n"), execSearchLines+2)
+		if len(lines) > execSearchLines+1 {
+			lines = lines[:execSearchLines+1]
+		}
+		if m := execRE.FindStringSubmatch(toValidUTF8(string(bytes.Join(lines[1:], []byte("\n"))))); m != nil {
+			// only follow an exec of an interpreter which languages.yml knows
+			if name, version := d.interpreterName(m[1]); len(d.interpreters[name]) > 0 {
+				s.Interpreter, s.Version, s.Args, s.Exec = name, version, nil, true
+			}
+		}
+	}
+	return s, true
+}
+
+// parseEnv returns the program run by env with args and the arguments to the program
+func parseEnv(args []string) (string, []string) {
+	for i := 0; i < len(args); i++ {
+		arg := strings.Trim(args[i], `'"`)
+		switch {
+		case arg == "--":
+			if i+1 < len(args) {
+				return strings.Trim(args[i+1], `'"`), args[i+2:]
+			}
+			return "", nil
+		case arg == "-S" || arg == "--split-string":
+			// the rest of the line is already split
+		case strings.HasPrefix(arg, "-S"):
+			// -Sdeno run
+			args[i] = arg[2:]
+			i--
+		case envArgOptions[arg]:
+			i++
+		case strings.HasPrefix(arg, "-"):
+			// -i, -, -v, --unset=NAME and other flags
+		case strings.Contains(arg, "="):
+			// VAR=value
+		default:
+			return arg, args[i+1:]
+		}
+	}
+	return "", nil
+}
+
+// interpreterName returns the name of the interpreter program as listed in languages.yml and its
+// version. Trailing versions are stripped until the name is listed and then for as long as the
+// name is of the same languages, so python3 is python but perl6 isn't perl. All of them are
+// stripped if the name isn't listed.
+func (d *Data) interpreterName(program string) (name, version string) {
+	version = versionRE.FindString(program)
+	name = program
+	for len(d.interpreters[name]) == 0 {
+		stripped := versionSuffixRE.ReplaceAllString(name, "")
+		if stripped == name || stripped == "" {
+			return scriptVersionRE.ReplaceAllString(program, ""), version
+		}
+		name = stripped
+	}
+	for {
+		stripped := versionSuffixRE.ReplaceAllString(name, "")
+		if stripped == name || stripped == "" || !sameLanguages(d.interpreters[stripped], d.interpreters[name]) {
+			return name, version
+		}
+		name = stripped
+	}
+}
+
+// sameLanguages returns true if a and b have the same languages in any order
+func sameLanguages(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, l := range a {
+		found := false
+		for _, o := range b {
+			if l == o {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func toValidUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	return strings.ToValidUTF8(s, string(utf8.RuneError))
+}
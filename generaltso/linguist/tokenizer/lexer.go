@@ -0,0 +1,399 @@
+package tokenizer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+)
+
+// Lex is a byte by byte port of github's linguist tokenizer which returns the
+// significant tokens of a piece of source code.
+//
+// Comments, string literals and numbers are skipped. Shebang lines produce a
+// SHEBANG#!<interpreter> token, SGML tags produce tokens for the tag name and
+// attribute names such as <div> and class=, and punctuation and operators such
+// as {, => and :: are tokens of their own.
+//
+// Lex uses DefaultSyntax(), use New() for a Tokenizer with a different syntax.
+func Lex(input []byte) []string {
+	return defaultTokenizer.Tokenize(input)
+}
+
+type lexer struct {
+	t      *Tokenizer
+	ctx    context.Context
+	input  []byte
+	pos    int
+	tokens []string
+	err    error
+	// lineStart is true if only spaces and tabs precede pos on the current line
+	lineStart bool
+}
+
+// the lexer checks for cancellation at every line and at least this often on long lines
+const cancelCheckBytes = 4096
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n' || b == '\f' || b == '\v'
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || b == '_' || b >= 0x80
+}
+
+func isWord(b byte) bool {
+	return isLetter(b) || isDigit(b)
+}
+
+// isTokenByte returns true for the bytes which make up a regular token
+func isTokenByte(b byte) bool {
+	return isWord(b) || b == '$' || b == '@' || b == '#' || b == '.'
+}
+
+func (l *lexer) emit(token string) {
+	l.tokens = append(l.tokens, token)
+}
+
+func (l *lexer) hasPrefix(prefix string) bool {
+	if len(l.input)-l.pos < len(prefix) {
+		return false
+	}
+	for i := 0; i < len(prefix); i++ {
+		if l.input[l.pos+i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *lexer) peek(offset int) byte {
+	if l.pos+offset < len(l.input) && l.pos+offset >= 0 {
+		return l.input[l.pos+offset]
+	}
+	return 0
+}
+
+// updateLineStart updates lineStart for the bytes consumed since start. Only those bytes are
+// looked at, so the lexer stays linear on long lines.
+func (l *lexer) updateLineStart(start int) {
+	for i := l.pos - 1; i >= start; i-- {
+		switch l.input[i] {
+		case '\n':
+			l.lineStart = true
+			return
+		case ' ', '\t':
+			continue
+		default:
+			l.lineStart = false
+			return
+		}
+	}
+}
+
+func (l *lexer) skipLine() {
+	if i := bytes.IndexByte(l.input[l.pos:], '\n'); i >= 0 {
+		l.pos += i
+	} else {
+		l.pos = len(l.input)
+	}
+}
+
+func (l *lexer) run() {
+	check := 0
+	l.lineStart = true
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		if c == '\n' || l.pos >= check {
+			if l.err = l.ctx.Err(); l.err != nil {
+				return
+			}
+			check = l.pos + cancelCheckBytes
+		}
+		start, lineStart := l.pos, l.lineStart
+		switch {
+		case isSpace(c):
+			l.pos++
+		case lineStart && l.hasPrefix("#!"):
+			l.shebang()
+		case lineStart && l.startLineComment():
+			l.skipLine()
+		case l.multiLineComment():
+		case !lineStart && l.singleLineComment():
+			l.skipLine()
+		case l.str():
+		case isDigit(c) && l.number():
+		case c == '<' && l.sgml():
+		case strings.IndexByte(l.t.syntax.Punctuation, c) >= 0:
+			l.emit(string(c))
+			l.pos++
+		case isTokenByte(c):
+			l.word()
+		case l.operator():
+		default:
+			l.pos++
+		}
+		l.updateLineStart(start)
+	}
+}
+
+// shebang emits a SHEBANG#!<interpreter> token for a #! line and skips the line
+func (l *lexer) shebang() {
+	start := l.pos
+	l.skipLine()
+	fields := strings.Fields(string(l.input[start+2 : l.pos]))
+	if len(fields) == 0 {
+		return
+	}
+	script := fields[0][strings.LastIndex(fields[0], "/")+1:]
+	if script == "env" {
+		script = ""
+		for _, f := range fields[1:] {
+			if strings.HasPrefix(f, "-") || strings.Contains(f, "=") {
+				continue
+			}
+			script = f
+			break
+		}
+	}
+	// strip any version number, python3 is python
+	if i := strings.IndexAny(script, "0123456789"); i >= 0 {
+		script = script[:i]
+	}
+	if script != "" {
+		l.emit("SHEBANG#!" + script)
+	}
+}
+
+// startLineComment returns true for comments which only start at the beginning of a line
+func (l *lexer) startLineComment() bool {
+	for _, c := range l.t.syntax.StartLineComments {
+		if l.hasPrefix(c) {
+			// these are only comments when followed by whitespace, otherwise
+			// "foo" at the start of a line would be skipped
+			next := l.peek(len(c))
+			return next == 0 || isSpace(next)
+		}
+	}
+	for _, c := range l.t.syntax.LineComments {
+		if l.hasPrefix(c) {
+			if c == "#" && l.directive() {
+				return false
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// directive returns true if pos is at a preprocessor directive such as #include
+func (l *lexer) directive() bool {
+	i := l.pos + 1
+	for i < len(l.input) && (l.input[i] == ' ' || l.input[i] == '\t') {
+		i++
+	}
+	j := i
+	for j < len(l.input) && isLetter(l.input[j]) {
+		j++
+	}
+	return l.t.directives[string(l.input[i:j])]
+}
+
+// singleLineComment returns true if pos is at the start of a comment in the middle of a line.
+// The comment must follow whitespace or the end of a statement, so that i-- or $#array aren't
+// treated as comments.
+func (l *lexer) singleLineComment() bool {
+	for _, c := range l.t.syntax.LineComments {
+		if !l.hasPrefix(c) {
+			continue
+		}
+		switch l.peek(-1) {
+		case ' ', '\t', ';', ')', '}', ']', ',':
+			return true
+		}
+	}
+	return false
+}
+
+// multiLineComment skips a multi-line comment and returns true if pos is at the start of one
+func (l *lexer) multiLineComment() bool {
+	for _, c := range l.t.syntax.BlockComments {
+		if !l.hasPrefix(c.Start) {
+			continue
+		}
+		l.pos += len(c.Start)
+		depth := 1
+		for l.pos < len(l.input) {
+			if c.Nested && l.hasPrefix(c.Start) {
+				depth++
+				l.pos += len(c.Start)
+				continue
+			}
+			if l.hasPrefix(c.End) {
+				l.pos += len(c.End)
+				depth--
+				if depth == 0 {
+					return true
+				}
+				continue
+			}
+			l.pos++
+		}
+		return true
+	}
+	return false
+}
+
+// str skips a string literal and returns true if pos is at the start of one
+func (l *lexer) str() bool {
+	for _, lit := range l.t.syntax.Strings {
+		if !l.hasPrefix(lit.Start) {
+			continue
+		}
+		if lit.Start == "'" && l.t.syntax.Apostrophes && l.pos > 0 && isWord(l.input[l.pos-1]) {
+			// an apostrophe such as don't
+			l.pos++
+			return true
+		}
+		l.skipString(lit)
+		return true
+	}
+	return false
+}
+
+// skipString skips the string literal at pos. Literals which aren't multiline end at
+// the end of the line if they aren't terminated.
+func (l *lexer) skipString(lit StringLiteral) {
+	l.pos += len(lit.Start)
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		switch {
+		case lit.Escape != 0 && c == lit.Escape:
+			l.pos += 2
+			continue
+		case l.hasPrefix(lit.End):
+			l.pos += len(lit.End)
+			return
+		case c == '\n' && !lit.Multiline:
+			return
+		}
+		l.pos++
+	}
+	if l.pos > len(l.input) {
+		l.pos = len(l.input)
+	}
+}
+
+// number skips a numeric literal such as 42, 1_000, 0x1f, 1.5e-3f or 10UL and returns true if pos is at one
+func (l *lexer) number() bool {
+	if l.t.number == nil {
+		return false
+	}
+	loc := l.t.number.FindIndex(l.input[l.pos:])
+	if loc == nil || loc[1] == 0 {
+		return false
+	}
+	l.pos += loc[1]
+	return true
+}
+
+// word emits a regular token such as foo, fmt.Println, $var or @property
+func (l *lexer) word() {
+	start := l.pos
+	for l.pos < len(l.input) && isTokenByte(l.input[l.pos]) {
+		l.pos++
+	}
+	token := string(l.input[start:l.pos])
+	if l.t.stringPrefixes[token] {
+		// r"raw", b'bytes' and friends are strings rather than a token and a string
+		for _, lit := range l.t.syntax.Strings {
+			if l.hasPrefix(lit.Start) {
+				l.skipString(lit)
+				return
+			}
+		}
+	}
+	l.emit(token)
+}
+
+// sgml emits the tokens for an SGML tag at pos and returns true, or returns false if pos isn't at a tag
+func (l *lexer) sgml() bool {
+	next := l.peek(1)
+	if !(isLetter(next) || next == '/' || next == '!' || next == '?') {
+		return false
+	}
+	end := -1
+	for i := l.pos + 1; i < len(l.input); i++ {
+		if l.input[i] == '<' {
+			return false
+		}
+		if l.input[i] == '>' {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return false
+	}
+	tag := l.input[l.pos:end]
+	l.pos = end + 1
+	// emit the start token, <div> or </div>
+	i := 1
+	if i < len(tag) && tag[i] == '/' {
+		i++
+	}
+	for i < len(tag) && !isSpace(tag[i]) {
+		i++
+	}
+	l.emit(string(tag[:i]) + ">")
+	for i < len(tag) {
+		c := tag[i]
+		if !isWord(c) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(tag) && (isWord(tag[i]) || tag[i] == '-' || tag[i] == ':') {
+			i++
+		}
+		if i < len(tag) && tag[i] == '=' {
+			// emit attributes with a trailing = and skip over the value
+			i++
+			l.emit(string(tag[start:i]))
+			if i < len(tag) && (tag[i] == '"' || tag[i] == '\'') {
+				q := tag[i]
+				i++
+				for i < len(tag) && tag[i] != q {
+					if tag[i] == '\\' {
+						i++
+					}
+					i++
+				}
+				i++
+			} else {
+				for i < len(tag) && !isSpace(tag[i]) {
+					i++
+				}
+			}
+			continue
+		}
+		// lone attribute
+		l.emit(string(tag[start:i]))
+	}
+	return true
+}
+
+// operator emits the longest operator at pos and returns true, or returns false if there is none
+func (l *lexer) operator() bool {
+	for _, op := range l.t.syntax.Operators {
+		if l.hasPrefix(op) {
+			l.emit(op)
+			l.pos += len(op)
+			return true
+		}
+	}
+	return false
+}
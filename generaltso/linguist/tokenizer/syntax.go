@@ -0,0 +1,190 @@
+package tokenizer
+
+import (
+	"context"
+	"regexp"
+	"sort"
+)
+
+// Comment is a comment delimited by Start and End, such as /* and */
+type Comment struct {
+	Start string
+	End   string
+	// Nested comments may contain other comments of the same kind, as in Haskell
+	Nested bool
+}
+
+// StringLiteral is a string literal delimited by Start and End
+type StringLiteral struct {
+	Start string
+	End   string
+	// Escape is the byte which escapes the next byte, or 0 for raw strings without escapes
+	Escape byte
+	// Multiline string literals may span lines, otherwise an unterminated literal ends at the end of the line
+	Multiline bool
+}
+
+// Syntax describes the comments, strings and other tokens of the languages a Tokenizer handles
+type Syntax struct {
+	// StartLineComments are comments which are only recognized at the start of a line when followed by whitespace
+	StartLineComments []string
+	// LineComments run to the end of the line. In the middle of a line they must follow whitespace
+	// or the end of a statement.
+	LineComments []string
+	// Directives are words following # at the start of a line which aren't comments, such as include
+	Directives []string
+	// BlockComments may span lines
+	BlockComments []Comment
+	// Strings are the string literals, including raw string forms
+	Strings []StringLiteral
+	// StringPrefixes are words which form a string literal with an immediately following quote, such as r in r"raw"
+	StringPrefixes []string
+	// Apostrophes treats a ' directly after a letter or digit as an apostrophe rather than the start of a string
+	Apostrophes bool
+	// Number matches numeric literals, which are skipped. It is matched at the start of a token beginning with a digit.
+	Number *regexp.Regexp
+	// Punctuation bytes are each a token of their own
+	Punctuation string
+	// Operators are tokens of their own, the longest match wins
+	Operators []string
+}
+
+// DefaultSyntax returns the syntax used by Lex(), which covers the C family, scripting languages and markup
+func DefaultSyntax() Syntax {
+	return Syntax{
+		StartLineComments: []string{
+			"\"", // Vim
+			"%",  // Tex
+		},
+		LineComments: []string{
+			"//", // C
+			"--", // Ada, Haskell, AppleScript
+			"#",  // Perl, Bash, Ruby
+		},
+		Directives: []string{
+			"define", "elif", "else", "endif", "endregion", "error", "if", "ifdef", "ifndef",
+			"import", "include", "line", "pragma", "region", "undef", "warning",
+		},
+		BlockComments: []Comment{
+			{"/*", "*/", false},    // C
+			{"<!--", "-->", false}, // XML
+			{"{-", "-}", true},     // Haskell
+			{"(*", "*)", true},     // OCaml, Coq
+			{`"""`, `"""`, false},  // Python
+			{"'''", "'''", false},  // Python
+			{"#`(", ")", false},    // Perl6
+		},
+		Strings: []StringLiteral{
+			{`"`, `"`, '\\', false},
+			{"'", "'", '\\', false},
+			{"`", "`", '\\', true},
+		},
+		StringPrefixes: []string{
+			"r", "b", "u", "f", "rb", "br", "fr", "rf", "R", "B", "U", "F",
+			"L", "u8", "Rb", "bR", "RB", "BR",
+		},
+		Apostrophes: true,
+		Number:      regexp.MustCompile(`(?:0[xX][0-9a-fA-F.]*|[0-9][0-9._]*)(?:[uU][lL]{0,2}|(?:[eE][-+0-9][0-9]*)?[fFlL]*)`),
+		Punctuation: ";{}()[]",
+		Operators: []string{
+			"<<=", ">>=", "||=", "&&=", "===", "!==", "**=", "<=>", "...",
+			"=>", "->", "<-", "::", ":=", "==", "!=", "<=", ">=", "&&", "||",
+			"<<", ">>", "++", "--", "+=", "-=", "*=", "/=", "|>", "??", "?.", "**",
+			"+", "-", "*", "/", "%", "&", "|", "^", "!", "~", "=", "<", ">", "?", ":",
+		},
+	}
+}
+
+func (s Syntax) clone() Syntax {
+	return Syntax{
+		StartLineComments: append([]string(nil), s.StartLineComments...),
+		LineComments:      append([]string(nil), s.LineComments...),
+		Directives:        append([]string(nil), s.Directives...),
+		BlockComments:     append([]Comment(nil), s.BlockComments...),
+		Strings:           append([]StringLiteral(nil), s.Strings...),
+		StringPrefixes:    append([]string(nil), s.StringPrefixes...),
+		Apostrophes:       s.Apostrophes,
+		Number:            s.Number,
+		Punctuation:       s.Punctuation,
+		Operators:         append([]string(nil), s.Operators...),
+	}
+}
+
+// Tokenizer returns the significant tokens of source code written with a Syntax.
+// A Tokenizer is immutable and safe for concurrent use.
+type Tokenizer struct {
+	syntax         Syntax
+	directives     map[string]bool
+	stringPrefixes map[string]bool
+	number         *regexp.Regexp
+	// legacy tokenizers use TokenizeLegacy() and have no syntax
+	legacy bool
+}
+
+var (
+	defaultTokenizer = New(DefaultSyntax())
+	legacyTokenizer  = &Tokenizer{legacy: true}
+)
+
+// Default returns the Tokenizer for DefaultSyntax(), which is used by Lex()
+func Default() *Tokenizer {
+	return defaultTokenizer
+}
+
+// Legacy returns the Tokenizer for TokenizeLegacy(), the word-splitting tokenizer from before
+// the lexer which the classifier embedded in the data package was trained with. Its Syntax is empty.
+func Legacy() *Tokenizer {
+	return legacyTokenizer
+}
+
+// IsLegacy returns true for the Tokenizer returned by Legacy()
+func (t *Tokenizer) IsLegacy() bool {
+	return t.legacy
+}
+
+// New returns a Tokenizer for the syntax. The syntax is copied, so changing it afterwards has no effect.
+func New(syntax Syntax) *Tokenizer {
+	t := &Tokenizer{
+		directives:     make(map[string]bool),
+		stringPrefixes: make(map[string]bool),
+	}
+	t.syntax = syntax.clone()
+	for _, d := range syntax.Directives {
+		t.directives[d] = true
+	}
+	for _, p := range syntax.StringPrefixes {
+		t.stringPrefixes[p] = true
+	}
+	if syntax.Number != nil {
+		// only match at the start of the token
+		t.number = regexp.MustCompile(`^(?:` + syntax.Number.String() + `)`)
+	}
+	sort.SliceStable(t.syntax.Operators, func(i, j int) bool {
+		return len(t.syntax.Operators[i]) > len(t.syntax.Operators[j])
+	})
+	return t
+}
+
+// Syntax returns a copy of the syntax the Tokenizer was created with
+func (t *Tokenizer) Syntax() Syntax {
+	return t.syntax.clone()
+}
+
+// Tokenize returns the significant tokens of input, see Lex() for details
+func (t *Tokenizer) Tokenize(input []byte) []string {
+	tokens, _ := t.TokenizeContext(context.Background(), input)
+	return tokens
+}
+
+// TokenizeContext is Tokenize which stops when ctx is done, returning the tokens found so far and ctx.Err()
+func (t *Tokenizer) TokenizeContext(ctx context.Context, input []byte) ([]string, error) {
+	if t.legacy {
+		return TokenizeLegacyContext(ctx, input)
+	}
+	if len(input) >= ByteLimit {
+		input = input[:ByteLimit]
+	}
+	l := &lexer{t: t, input: input, ctx: ctx}
+	l.run()
+	return l.tokens, l.err
+}
@@ -0,0 +1,9 @@
+# frozen_string_literal: true
+class Greeter
+  def initialize(name)
+    @name = name # the name
+  end
+
+  def greet = "Hello, #{@name}!"
+  def items; @items ||= [] end
+end
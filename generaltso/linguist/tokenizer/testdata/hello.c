@@ -0,0 +1,12 @@
+#include <stdio.h>
+#define MAX 10 /* upper bound */
+
+/* a block comment
+   spanning lines */
+int main(int argc, char **argv) {
+	char *s = "hello \"world\"";//trailing
+	for (int i = 0; i < MAX; i++) {
+		printf("%d\n", i << 2);
+	}
+	return 0x1F + 1.5e-3f;
+}
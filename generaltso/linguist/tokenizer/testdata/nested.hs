@@ -0,0 +1,6 @@
+{- outer {- inner -} still a comment -}
+module Main where
+
+main :: IO ()
+main = putStrLn "hi" -- comment
+  >>= \_ -> return ()
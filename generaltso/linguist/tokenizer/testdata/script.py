@@ -0,0 +1,7 @@
+#!/usr/bin/env python3
+# a comment
+def greet(name: str) -> str:
+    """Docstring with 'quotes' and # hashes"""
+    return f"hello {name}" if name else r'\d+'
+
+print(greet("x"), 1_000)  # trailing
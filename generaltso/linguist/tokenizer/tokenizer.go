@@ -13,6 +13,7 @@ package tokenizer
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"regexp"
 )
 
@@ -22,6 +23,9 @@ var (
 
 	// NOTE(tso): these string slices are turned into their regexp slice counterparts
 	// by this package's init() function.
+	//
+	// Deprecated: these are only used by TokenizeLegacy() and changing them has no
+	// effect after init(). Use New() with a Syntax for a Tokenizer with different comments.
 	StartLineComments = []string{
 		"\"", // Vim
 		"%",  // Tex
@@ -74,6 +78,21 @@ func FindMultiLineComment(token []byte) (matched bool, terminator *regexp.Regexp
 	return false, nil
 }
 
+// Tokenize returns the significant tokens of input for use by the bayesian classifier,
+// stripping comments, string literals and numbers. See Lex for details, and New() for
+// tokenizing other syntaxes.
+//
+// The classifier embedded in the data package was trained with TokenizeLegacy()
+// instead, see Legacy().
+func Tokenize(input []byte) (tokens []string) {
+	return Lex(input)
+}
+
+// Same as Tokenize() but stops when ctx is done, returning the tokens found so far and ctx.Err().
+func TokenizeContext(ctx context.Context, input []byte) ([]string, error) {
+	return defaultTokenizer.TokenizeContext(ctx, input)
+}
+
 // Simple tokenizer that uses bufio.Scanner to process lines and individual words
 // and matches them against regular expressions to filter out comments, strings, and numerals
 // in a manner very similar to github's linguist (see https://github.com/github/linguist/blob/master/lib/linguist/tokenizer.rb)
@@ -84,9 +103,16 @@ func FindMultiLineComment(token []byte) (matched bool, terminator *regexp.Regexp
 //
 // NOTE(tso): The tokens produced by this function may be of a dubious quality due to the approach taken.
 // Feedback and alternate implementations welcome :)
-func Tokenize(input []byte) (tokens []string) {
+func TokenizeLegacy(input []byte) (tokens []string) {
+	tokens, _ = TokenizeLegacyContext(context.Background(), input)
+	return tokens
+}
+
+// Same as TokenizeLegacy() but checks ctx between lines, returning the tokens found so far and ctx.Err()
+// when it's done.
+func TokenizeLegacyContext(ctx context.Context, input []byte) (tokens []string, err error) {
 	if len(input) == 0 {
-		return tokens
+		return tokens, nil
 	}
 	if len(input) >= ByteLimit {
 		input = input[:ByteLimit]
@@ -106,6 +132,9 @@ func Tokenize(input []byte) (tokens []string) {
 	// NOTE(tso): the use of goto here is probably interchangable with continue
 line:
 	for scanlines.Scan() {
+		if err := ctx.Err(); err != nil {
+			return tokens, err
+		}
 		ln := scanlines.Bytes()
 
 		for _, re := range StartLineComment {
@@ -175,5 +204,5 @@ line:
 			tokens = append(tokens, tk_s)
 		}
 	}
-	return tokens
+	return tokens, nil
 }
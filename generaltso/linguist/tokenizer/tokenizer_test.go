@@ -0,0 +1,184 @@
+package tokenizer
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the .golden files in testdata")
+
+func TestLexGolden(t *testing.T) {
+	files, err := filepath.Glob("testdata/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range files {
+		if strings.HasSuffix(fn, ".golden") {
+			continue
+		}
+		input, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual := strings.Join(Lex(input), "\n") + "\n"
+		golden := fn + ".golden"
+		if *update {
+			if err := ioutil.WriteFile(golden, []byte(actual), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, string(expected), actual, fn)
+	}
+}
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		input  string
+		tokens []string
+	}{
+		{"foo();//x", []string{"foo", "(", ")", ";"}},
+		{`a="b c"`, []string{"a", "="}},
+		{`a = 'it\'s' + b`, []string{"a", "=", "+", "b"}},
+		{"x => y :: z", []string{"x", "=>", "y", "::", "z"}},
+		{"i-- # note", []string{"i", "--"}},
+		{"$#array", []string{"$#array"}},
+		{"http://example.com", []string{"http", ":", "/", "/", "example.com"}},
+		{"(* a (* b *) c *) d", []string{"d"}},
+		{"x = `multi\nline` y", []string{"x", "=", "y"}},
+		{"#!/bin/sh\necho", []string{"SHEBANG#!sh", "echo"}},
+		{"#!/usr/bin/env -S python3 -u\n", []string{"SHEBANG#!python"}},
+		{"#ifdef FOO\n# comment\n", []string{"#ifdef", "FOO"}},
+		{`<a href="x" b=c d>`, []string{"<a>", "href=", "b=", "d"}},
+		{"a < b", []string{"a", "<", "b"}},
+		{"1.5e-3f 0xFF 10UL 42", nil},
+		{"don't stop", []string{"don", "t", "stop"}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.tokens, Lex([]byte(test.input)), test.input)
+	}
+}
+
+func TestLexByteLimit(t *testing.T) {
+	defer func(limit int) { ByteLimit = limit }(ByteLimit)
+	ByteLimit = 8
+	assert.Equal(t, []string{"foo", "bar"}, Lex([]byte("foo bar baz qux")))
+}
+
+func TestLegacy(t *testing.T) {
+	input := []byte("foo(); bar //x\n")
+	assert.Equal(t, Lex(input), Tokenize(input))
+	assert.False(t, Default().IsLegacy())
+	assert.True(t, Legacy().IsLegacy())
+	assert.Equal(t, TokenizeLegacy(input), Legacy().Tokenize(input))
+	assert.Equal(t, []string{"foo();", "bar"}, Legacy().Tokenize(input))
+	// the legacy tokenizer doesn't change Tokenize()
+	assert.Equal(t, Lex(input), Tokenize(input))
+}
+
+func TestNew(t *testing.T) {
+	syntax := DefaultSyntax()
+	assert.Equal(t, Lex([]byte("foo(); // x")), New(syntax).Tokenize([]byte("foo(); // x")))
+
+	// a lisp-like syntax with ; comments, no ' strings and r#"raw"# strings
+	syntax.LineComments = []string{";"}
+	syntax.Punctuation = "()"
+	syntax.Strings = []StringLiteral{
+		{`"`, `"`, '\\', false},
+		{`r#"`, `"#`, 0, true},
+	}
+	syntax.Operators = append(syntax.Operators, "'")
+	lisp := New(syntax)
+	assert.Equal(t, []string{"(", "defun", "f", "(", "x", ")", "'", "(", "x", ")", ")"},
+		lisp.Tokenize([]byte("(defun f (x) '(x)) ; done\n")))
+	assert.Equal(t, []string{"(", "print", ")"}, lisp.Tokenize([]byte("(print r#\"a \\\" b\"#)")))
+
+	// changing the syntax afterwards has no effect
+	syntax.Punctuation = ""
+	assert.Equal(t, "()", lisp.Syntax().Punctuation)
+	assert.Equal(t, []string{"(", ")"}, lisp.Tokenize([]byte("()")))
+
+	// numbers are only skipped with a pattern
+	syntax = DefaultSyntax()
+	syntax.Number = nil
+	assert.Equal(t, []string{"x", "=", "42"}, New(syntax).Tokenize([]byte("x = 42")))
+}
+
+// cancelAfter is a context which is done after its Err has been checked n times, so that
+// tests can cancel tokenizing part of the way through
+type cancelAfter struct {
+	context.Context
+	n int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestTokenizeContext(t *testing.T) {
+	input := []byte(strings.Repeat("foo bar baz\n", 1000))
+	tokens, err := TokenizeContext(context.Background(), input)
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 3000)
+
+	for name, tokenize := range map[string]func(context.Context, []byte) ([]string, error){
+		"lexer":  Default().TokenizeContext,
+		"legacy": TokenizeLegacyContext,
+	} {
+		tokens, err := tokenize(&cancelAfter{context.Background(), 10}, input)
+		assert.Equal(t, context.Canceled, err, name)
+		// the tokens of the lines before cancellation are returned
+		assert.NotEmpty(t, tokens, name)
+		assert.True(t, len(tokens) < 3000, name)
+	}
+}
+
+func TestTokenizeContextLongLine(t *testing.T) {
+	// a single line is still checked for cancellation
+	input := []byte(strings.Repeat("foo ", ByteLimit/4))
+	tokens, err := Default().TokenizeContext(&cancelAfter{context.Background(), 2}, input)
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, len(tokens) < ByteLimit/4)
+}
+
+func TestTokenizeDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	time.Sleep(time.Millisecond)
+	input := []byte(strings.Repeat("int main() { return 0; }\n", 4000))
+	tokens, err := TokenizeContext(ctx, input)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Empty(t, tokens)
+}
+
+func TestLexLinearTime(t *testing.T) {
+	for name, input := range map[string]string{
+		"spaces": "x" + strings.Repeat(" ", ByteLimit-2),
+		"tabs":   strings.Repeat("\t", ByteLimit-1),
+		"words":  strings.Repeat("x ", ByteLimit/2-1),
+	} {
+		start := time.Now()
+		Lex([]byte(input))
+		// quadratic scanning took seconds on these inputs
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("%s: lexing %d bytes took %v", name, len(input), d)
+		}
+	}
+	// what precedes a # on its line still decides whether it's a comment
+	assert.Equal(t, []string{"x"}, Lex([]byte("x\t\t# comment\n")))
+	assert.Equal(t, []string{"SHEBANG#!sh", "y"}, Lex([]byte("  \t#!/bin/sh\ny\n")))
+}
@@ -0,0 +1,73 @@
+package linguist
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// generatedFilenames are lock files and other files written by tools
+	generatedFilenames = map[string]bool{
+		"package-lock.json":   true,
+		"npm-shrinkwrap.json": true,
+		"yarn.lock":           true,
+		"pnpm-lock.yaml":      true,
+		"composer.lock":       true,
+		"Gopkg.lock":          true,
+		"glide.lock":          true,
+		"go.sum":              true,
+		"Cargo.lock":          true,
+		"poetry.lock":         true,
+		"Pipfile.lock":        true,
+	}
+	generatedRules = []*regexp.Regexp{
+		regexp.MustCompile(`\.pb\.(go|cc|h)$`),
+		regexp.MustCompile(`_pb2(_grpc)?\.py$`),
+		regexp.MustCompile(`\.designer\.(cs|vb)$`),
+		regexp.MustCompile(`\.(js|css)\.map$`),
+		regexp.MustCompile(`\.min\.(js|css)$`),
+	}
+	// generatedHeader matches the comments tools put at the top of the files they write
+	generatedHeader = regexp.MustCompile(`(?i)(code generated .*do not edit|generated by the protocol buffer compiler|<auto-generated|@generated\b|this file (was|is) (automatically|auto-?)\s?generated)`)
+)
+
+// the number of bytes at the start of a file which are searched for a generated header
+const generatedHeaderSize = 1024
+
+// IsGenerated returns true if the file was generated by a tool rather than written by hand, such as
+// lock files, protobuf output and minified JavaScript. If nil body, will only check for filename
+func IsGenerated(filename string, body []byte) bool {
+	filename = NormalizePath(filename)
+	if generatedFilenames[filepath.Base(filename)] {
+		return true
+	}
+	for _, rule := range generatedRules {
+		if rule.MatchString(filename) {
+			return true
+		}
+	}
+	if len(body) == 0 {
+		return false
+	}
+	header := body
+	if len(header) > generatedHeaderSize {
+		header = header[:generatedHeaderSize]
+	}
+	if generatedHeader.Match(header) {
+		return true
+	}
+	return isMinified(filename, body)
+}
+
+// isMinified returns true for JavaScript and CSS files with an average line length over 110 characters
+func isMinified(filename string, body []byte) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".js", ".mjs", ".css":
+	default:
+		return false
+	}
+	lines := bytes.Count(body, []byte("\n")) + 1
+	return len(body)/lines > 110
+}
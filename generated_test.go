@@ -0,0 +1,24 @@
+package linguist
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsGenerated(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(IsGenerated("web/package-lock.json", nil))
+	assert.True(IsGenerated("api/service.pb.go", nil))
+	assert.True(IsGenerated("proto/service_pb2.py", nil))
+	assert.True(IsGenerated("dist/app.min.js", nil))
+	assert.True(IsGenerated("main.go", []byte("// Code generated by go generate; DO NOT EDIT.\npackage main\n")))
+	assert.True(IsGenerated("Form.cs", []byte("//------\n// <auto-generated>\n//------\n")))
+	assert.True(IsGenerated("app.js", []byte(strings.Repeat("var a=1;", 100))))
+	assert.False(IsGenerated("main.go", nil))
+	assert.False(IsGenerated("main.go", []byte("package main\n\nfunc main() {}\n")))
+	assert.False(IsGenerated("app.js", []byte(strings.Repeat("var a = 1;\n", 100))))
+	// only the header is checked
+	assert.False(IsGenerated("main.go", []byte("package main\n"+strings.Repeat("\n", generatedHeaderSize)+"// Code generated by x. DO NOT EDIT.\n")))
+}
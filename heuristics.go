@@ -0,0 +1,102 @@
+package linguist
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+)
+
+// heuristic picks Language when Pattern matches the body of a file with an ambiguous extension.
+// A nil Pattern always matches and is used as the fallback for an extension.
+type heuristic struct {
+	Language string
+	Pattern  *regexp.Regexp
+}
+
+// heuristics are a subset of the upstream linguist heuristics.yml, checked in order
+var heuristics = map[string][]heuristic{
+	".cls": {
+		{"TeX", regexp.MustCompile(`\\\w+{`)},
+		{"Apex", regexp.MustCompile(`(?i)\b(public|private|global)\s+(with|without)\s+sharing\b`)},
+		{"Visual Basic", regexp.MustCompile(`(?m)^\s*(VERSION|Attribute VB_)`)},
+	},
+	".cs": {
+		{"Smalltalk", regexp.MustCompile(`![\w\s]+methodsFor: `)},
+		{"C#", regexp.MustCompile(`(?m)^\s*(using\s+[A-Z][\s\w.]+;|namespace\s*[\w.]+\s*(\{|;)|\/\/)`)},
+	},
+	".fs": {
+		{"Forth", regexp.MustCompile(`(?m)^(: |new-device)`)},
+		{"F#", regexp.MustCompile(`(?m)^\s*(#light|import|let|module|namespace|open|type)`)},
+		{"GLSL", regexp.MustCompile(`(?m)^\s*(#version|precision|uniform|varying|vec[234])`)},
+		{"Filterscript", regexp.MustCompile(`#include|#pragma\s+(rs|version)|__attribute__`)},
+	},
+	".h": {
+		{"Objective-C", regexp.MustCompile(`(?m)^\s*(@(interface|class|protocol|property|end|synchronised|selector|implementation)\b|#import\s+.+\.h[">])`)},
+		{"C++", regexp.MustCompile(`(?m)^\s*(#\s*include <(cstdint|string|vector|map|list|array|bitset|queue|stack|forward_list|unordered_map|unordered_set|(i|o|io)stream)>|template\s*<|(class|namespace)\s+\w+\s*\{|(public|private|protected):$|std::\w+)`)},
+		{"C", nil},
+	},
+	".m": {
+		{"Objective-C", regexp.MustCompile(`(?m)^\s*(@(interface|class|protocol|property|end|synchronised|selector|implementation)\b|#import\s+.+\.h[">])`)},
+		{"Mercury", regexp.MustCompile(`:- module`)},
+		{"MUF", regexp.MustCompile(`(?m)^: `)},
+		{"M", regexp.MustCompile(`(?m)^\s*;`)},
+		{"Mathematica", regexp.MustCompile(`\*\)$`)},
+		{"Matlab", regexp.MustCompile(`(?m)^\s*%`)},
+		{"Limbo", regexp.MustCompile(`(?m)^\w+\s*:\s*module\s*{`)},
+	},
+	".md": {
+		{"Markdown", regexp.MustCompile(`(?m)(^[-A-Za-z0-9=#!\*\[|>])|<\/|\A\z`)},
+		{"GCC Machine Description", regexp.MustCompile(`(?m)^(;;|\(define_)`)},
+	},
+	".pl": {
+		{"Prolog", regexp.MustCompile(`(?m)^[^#]*:-`)},
+		{"Perl", regexp.MustCompile(`\buse\s+(?:strict\b|v?5\.)`)},
+		{"Perl 6", regexp.MustCompile(`(?m)^\s*(?:use\s+v6\b|\bmodule\b|\b(?:my\s+)?class\b)`)},
+	},
+	".pro": {
+		{"Prolog", regexp.MustCompile(`(?m)^[^\[#]+:-`)},
+		{"INI", regexp.MustCompile(`last_client=`)},
+		{"QMake", regexp.MustCompile(`HEADERS|SOURCES`)},
+		{"IDL", regexp.MustCompile(`(?m)^\s*function[ \w,]+$`)},
+	},
+	".rs": {
+		{"Rust", regexp.MustCompile(`(?m)^(use |fn |mod |pub |macro_rules|impl|#!?\[)`)},
+		{"RenderScript", regexp.MustCompile(`#include|#pragma\s+(rs|version)|__attribute__`)},
+	},
+	".sql": {
+		{"PLpgSQL", regexp.MustCompile(`(?i)(?m)^\\i\b|AS \$\$|LANGUAGE '?plpgsql'?|SECURITY (DEFINER|INVOKER)|BEGIN( WORK| TRANSACTION)?;`)},
+		{"SQLPL", regexp.MustCompile(`(?i)(alter module)|(language sql)|(begin( NOT)+ atomic)|signal SQLSTATE '[0-9]+'`)},
+		{"PLSQL", regexp.MustCompile(`(?i)\$\$PLSQL_|XMLTYPE|sysdate|systimestamp|\.nextval|connect by|AUTHID (DEFINER|CURRENT_USER)|constructor\W+function`)},
+		{"SQL", nil},
+	},
+	".ts": {
+		{"XML", regexp.MustCompile(`<TS\b`)},
+		{"TypeScript", nil},
+	},
+}
+
+func detectHeuristics(ctx context.Context, blob *Blob, candidates []string) []string {
+	rules := heuristics[generaltso.MatchExtension(blob.Filename, func(ext string) bool { return heuristics[ext] != nil })]
+	span := spanFromContext(ctx)
+	tried := make([]string, 0, len(rules))
+	defer func() {
+		if len(tried) > 0 {
+			span.SetAttribute("tried", tried)
+		}
+	}()
+	for _, h := range rules {
+		if len(intersect(candidates, []string{h.Language})) == 0 {
+			continue
+		}
+		matched := h.Pattern == nil || h.Pattern.Match(blob.Body)
+		if span.IsRecording() {
+			tried = append(tried, fmt.Sprintf("%s %v=%v", h.Language, h.Pattern, matched))
+		}
+		if matched {
+			return []string{h.Language}
+		}
+	}
+	return nil
+}
@@ -4,12 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
-	"sort"
-	"strings"
 	"sync"
 	"sync/atomic"
 
@@ -57,10 +54,16 @@ type Detection struct {
 	IsImage                bool      `json:"is_image,omitempty"`
 	IsBinary               bool      `json:"is_binary,omitempty"`
 	IsVendored             bool      `json:"is_vendored,omitempty"`
+	IsTest                 bool      `json:"is_test,omitempty"`
 	IsHighRatioOfLongLines bool      `json:"is_high_ratio_of_long_lines,omitempty"`
 	IsViewable             bool      `json:"is_viewable,omitempty"`
 	IsSafeToColorize       bool      `json:"is_safe_to_colorize,omitempty"`
 	Language               *Language `json:"language,omitempty"`
+	Strategy               string    `json:"strategy,omitempty"`
+	// Segments are the languages embedded in the file if the detector splits files into segments, see Segments
+	Segments []Segment `json:"segments,omitempty"`
+	// Notebook are the sizes of the cells of a Jupyter notebook
+	Notebook *NotebookStats `json:"notebook,omitempty"`
 }
 
 // Result is the result details of a detection
@@ -70,13 +73,17 @@ type Result struct {
 	Result     *Detection `json:"result"`
 	IsBinary   bool       `json:"binary"`
 	IsLarge    bool       `json:"large"`
+	IsVendored bool       `json:"vendored"`
 	IsExcluded bool       `json:"excluded"`
 	IsCached   bool       `json:"cached"`
+	// Kind and MimeType describe the format of a binary file, see FileType
+	Kind     string `json:"kind,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
 }
 
 // String returns a string representation
 func (r Result) String() string {
-	return fmt.Sprintf("Result<success:%v,message:%v,result:%v,binary:%v,large:%v,excluded:%v,cached:%v>", r.Success, r.Message, r.Result, r.IsBinary, r.IsLarge, r.IsExcluded, r.IsCached)
+	return fmt.Sprintf("Result<success:%v,message:%v,result:%v,binary:%v,large:%v,vendored:%v,excluded:%v,cached:%v,kind:%v,mime_type:%v>", r.Success, r.Message, r.Result, r.IsBinary, r.IsLarge, r.IsVendored, r.IsExcluded, r.IsCached, r.Kind, r.MimeType)
 }
 
 // LResult is the result that comes back from linguist
@@ -86,74 +93,56 @@ type LResult struct {
 	Results []Detection `json:"results"`
 }
 
-type preoptimization struct {
-	Matchers  []Match
-	Result    Result
-	CacheHits int32
-}
-
 var (
-	preoptimizations = make([]*preoptimization, 0)
-	cacheMisses      int32
-	cacheHits        int32
-	preoptimized     bool
-	mutex            sync.RWMutex
-	generaltsoMutex  sync.Mutex
-	noResult         = Result{}
+	mutex sync.RWMutex
+	// generaltsoLock is held while using generaltso, which isn't thread safe and uses shared maps.
+	// It's a channel rather than a sync.Mutex so that waiting for it can be canceled.
+	generaltsoLock = make(chan struct{}, 1)
+	noResult       = Result{}
 )
 
-func preoptimize(re Match, filename string, body string, rules ...Match) {
-	result, err := getLanguageDetails(context.Background(), filename, []byte(body))
-	if err == nil && result.Success {
-		p := &preoptimization{
-			Matchers: []Match{re},
-			Result:   result,
-		}
-		if len(rules) > 0 {
-			for _, r := range rules {
-				p.Matchers = append(p.Matchers, r)
-			}
-		}
-		preoptimizations = append(preoptimizations, p)
+func cacheStats() CacheStats {
+	if c := defaultDetector.Cache(); c != nil {
+		return c.Stats()
 	}
+	return CacheStats{}
 }
 
-func resort() {
-	mutex.Lock()
-	sort.Slice(preoptimizations, func(i, j int) bool {
-		return preoptimizations[j].CacheHits < preoptimizations[i].CacheHits
-	})
-	mutex.Unlock()
-}
-
-// CacheHits returns the number of cache hits
+// CacheHits returns the number of cache hits reported by the Cache used by GetLanguageDetails
 func CacheHits() int32 {
-	return atomic.LoadInt32(&cacheHits)
+	return int32(cacheStats().Hits)
 }
 
-// CacheMisses returns the number of cache misses
+// CacheMisses returns the number of cache misses reported by the Cache used by GetLanguageDetails
 func CacheMisses() int32 {
-	return atomic.LoadInt32(&cacheMisses)
+	return int32(cacheStats().Misses)
 }
 
 func cacheCounterReset() {
-	atomic.StoreInt32(&cacheHits, 0)
-	atomic.StoreInt32(&cacheMisses, 0)
-	resort()
+	if c, ok := defaultDetector.Cache().(*MemoryCache); ok {
+		c.Reset()
+	}
+	preoptimizationCounterReset()
 }
 
-// MostPopular returns the most popular language based on cache hits since the worker has started
+// MostPopular returns the most popular language based on cache hits since the worker has started.
+// If the Cache doesn't count hits by language, the most used preoptimization is returned.
 func MostPopular() Detection {
-	resort()
-	// for i, r := range preoptimizations {
-	// 	fmt.Printf("%d %d %v\n", i, r.CacheHits, r.Result.Results[0].Language.Name)
-	// }
-	return *preoptimizations[0].Result.Result
-}
-
-// Initialize will warm up the preoptimization cache
-func Initialize() {
-	preoptimizeInit()
+	stats := cacheStats()
+	if stats.Languages == nil {
+		return mostPopularPreoptimization()
+	}
+	var popular string
+	var max int64
+	for l, n := range stats.Languages {
+		if n > max || (n == max && l < popular) {
+			popular, max = l, n
+		}
+	}
+	if popular == "" {
+		return Detection{}
+	}
+	return Detection{Type: "text", Language: registryLanguage(generaltso.CurrentData(), popular)}
 }
 
 // Match is a simple struct for describing a match rule
@@ -188,129 +177,9 @@ func NewNotMatcher(s string) Match {
 	return Match{regexp.MustCompile(s), true}
 }
 
-// initialize a pre-optimization cache for well-known languages to speed up
-// calculating predictable language results
-func preoptimizeInit() {
-	if preoptimized == false {
-		preoptimized = true
-		noVendorMatcher := NewNotMatcher("^(node_modules|vendor|Godeps)/")
-		preoptimize(NewMatcher("\\.js$"), "test.js", "var a", noVendorMatcher)
-		preoptimize(NewMatcher("\\.ts$"), "test.ts", "interface Foo {\n}", noVendorMatcher)
-		preoptimize(NewMatcher("\\.ejs$"), "test.ejs", "<% if (names.length) { %>foo<% } %>", noVendorMatcher)
-		preoptimize(NewMatcher("\\.go$"), "test.go", "package main\nfunc main(){\n}\n", noVendorMatcher)
-		preoptimize(NewMatcher("Makefile$"), "Makefile", ".phony foo\n", noVendorMatcher)
-		preoptimize(NewMatcher("\\.ya?ml$"), "test.yml", "---\nfoo: 1\n", noVendorMatcher)
-		preoptimize(NewMatcher("\\.json$"), "test.json", "{\"a\":1}", noVendorMatcher)
-		preoptimize(NewMatcher("\\.swift$"), "test.swift", "let a=0")
-		preoptimize(NewMatcher("\\.c(\\+\\+|pp|c)$"), "test.cpp", "class Foo{\n};\n", noVendorMatcher)
-		preoptimize(NewMatcher("\\.hbs$"), "test.hbs", "<div>{{foo}}</div>", noVendorMatcher)
-		preoptimize(NewMatcher("\\.html$"), "test.html", "<div>hi</div>", noVendorMatcher)
-		preoptimize(NewMatcher("\\.css$"), "test.css", ".rule {color:red}", noVendorMatcher)
-		preoptimize(NewMatcher("\\.scss$"), "test.scss", ".rule {color:red}", noVendorMatcher)
-		preoptimize(NewMatcher("\\.(ba|z)?sh$"), "test.sh", "#!/bin/sh\n", noVendorMatcher)
-		preoptimize(NewMatcher("\\.(md|markdown)$"), "test.md", "# Foo\n## Hello\nthis is a markdown file\n", noVendorMatcher)
-		preoptimize(NewMatcher("\\.json5$"), "test.json5", "{a:1}", noVendorMatcher)
-		preoptimize(NewMatcher("\\.jsx$"), "test.jsx", "import a from 'foo'\n", noVendorMatcher)
-		preoptimize(NewMatcher("\\.ts$"), "test.ts", "import a from 'foo'\n", noVendorMatcher)
-		preoptimize(NewMatcher("\\.tsx$"), "test.tsx", "import a from 'foo'\n", noVendorMatcher)
-		preoptimize(NewMatcher("\\.m$"), "test.m", "@implementation Foo\n@end\n", noVendorMatcher)
-		preoptimize(NewMatcher("\\.mm$"), "test.mm", "@implementation Foo\n@end\n", noVendorMatcher)
-		preoptimize(NewMatcher("\\.(c|h)$"), "test.c", "void main(){\n}\n", noVendorMatcher)
-		preoptimize(NewMatcher("\\.rb$"), "test.rb", "print \"hello\"")
-		preoptimize(NewMatcher("\\.py$"), "test.py", "def foo\nend\n")
-		preoptimize(NewMatcher("\\.proto$"), "test.proto", "package foo\nmessage Bar\n{\n}\n", noVendorMatcher)
-		preoptimize(NewMatcher("\\.java$"), "test.java", "package foo\npublic class Bar\n{\n}\n")
-		preoptimize(NewMatcher("\\.cs$"), "test.cs", "class Bar\n{\n}\n")
-		preoptimize(NewMatcher("\\.xml$"), "test.xml", "<a>foo</a>", noVendorMatcher)
-		preoptimize(NewMatcher("\\.lua$"), "test.lua", "x=0")
-		preoptimize(NewMatcher("\\.txt$"), "test.txt", "hi", noVendorMatcher)
-		preoptimize(NewMatcher("\\.sql$"), "test.sql", "-- test\ndelete from `foo`;\nCREATE TABLE IF NOT EXISTS `foo` (l int(11));\n", noVendorMatcher)
-		preoptimize(NewMatcher("\\.coffee$"), "test.coffee", "a = 1", noVendorMatcher)
-		preoptimize(NewMatcher("\\.properties$"), "test.properties", "a=1", noVendorMatcher)
-		preoptimize(NewMatcher("Dockerfile(\\.*)$"), "Dockerfile", "FROM nodejs\n")
-		preoptimize(NewMatcher("LICENSE$"), "LICENSE", "MIT License\n", noVendorMatcher)
-		// reset after loading.
-		atomic.StoreInt32(&cacheMisses, 0)
-		atomic.StoreInt32(&cacheHits, 0)
-	}
-}
-
-// CheckPreoptimizationCache will return a potential Result for a filename match based on the preoptimization cache
-func CheckPreoptimizationCache(filename string) Result {
-	mutex.RLock()
-	for _, p := range preoptimizations {
-		var matched bool
-		for _, matcher := range p.Matchers {
-			if matcher.MatchString(filename) {
-				matched = true
-			} else {
-				break
-			}
-		}
-		if matched {
-			ex, r := IsExcluded(filename, nil)
-			if ex {
-				mutex.RUnlock()
-				return *r
-			}
-			// make a copy so that the result can't be mutated
-			l := Language(*p.Result.Result.Language)
-			result := Result{
-				Success:  true,
-				IsCached: true,
-				Result: &Detection{
-					Path:                   filename,
-					Type:                   p.Result.Result.Type,
-					ExtName:                p.Result.Result.ExtName,
-					MimeType:               p.Result.Result.MimeType,
-					ContentType:            p.Result.Result.ContentType,
-					Disposition:            p.Result.Result.Disposition,
-					IsDocumentation:        p.Result.Result.IsDocumentation,
-					IsLarge:                p.Result.Result.IsLarge,
-					IsGenerated:            p.Result.Result.IsGenerated,
-					IsText:                 p.Result.Result.IsText,
-					IsImage:                p.Result.Result.IsImage,
-					IsBinary:               p.Result.Result.IsBinary,
-					IsVendored:             p.Result.Result.IsVendored,
-					IsHighRatioOfLongLines: p.Result.Result.IsHighRatioOfLongLines,
-					IsViewable:             p.Result.Result.IsViewable,
-					IsSafeToColorize:       p.Result.Result.IsSafeToColorize,
-					Language:               &l,
-				},
-				IsBinary:   p.Result.Result.IsBinary,
-				IsLarge:    p.Result.Result.IsLarge,
-				IsExcluded: p.Result.Result.IsBinary,
-			}
-			atomic.AddInt32(&p.CacheHits, 1)
-			mutex.RUnlock()
-			return result
-		}
-	}
-	mutex.RUnlock()
-	return noResult
-}
-
 // GetLanguageDetails returns the linguist results for a given file
 func GetLanguageDetails(ctx context.Context, filename string, body []byte, skip ...bool) (Result, error) {
-	if ex, r := IsExcluded(filename, body); ex {
-		return *r, nil
-	}
-	if len(skip) == 0 || !skip[0] {
-		if preop := CheckPreoptimizationCache(filename); preop.Success {
-			hits := atomic.AddInt32(&cacheHits, 1)
-			// every N hits, resort so that the most popular stays
-			// at the top of the heap for faster access and less popular go to bottom
-			if hits%100 == 0 {
-				resort()
-			}
-			return preop, nil
-		}
-	}
-	result, err := getLanguageDetails(ctx, filename, body)
-	if result.Success {
-		atomic.AddInt32(&cacheMisses, 1)
-	}
-	return result, err
+	return defaultDetector.GetLanguageDetails(ctx, filename, body, skip...)
 }
 
 // File is a wrapper around a file name and body
@@ -331,61 +200,31 @@ type Filereq struct {
 	Index int
 }
 
-// GetLanguageDetailsMultiple returns the linguist results for one or more files
+// GetLanguageDetailsMultiple returns the linguist results for one or more files. If ctx is done
+// before all the files are detected, the results of the files before it are returned with the error.
 func GetLanguageDetailsMultiple(ctx context.Context, files []*File, skipCache ...bool) ([]Result, error) {
 	results := make([]Result, 0)
-	jsonbody := make([]Filereq, 0)
 	var skip bool
 	if len(skipCache) != 0 && skipCache[0] {
 		skip = true
 	}
-	for i, file := range files {
-		if ex, r := IsExcluded(file.filename, file.body); ex {
-			results = append(results, *r)
-			continue
-		}
-		if !skip {
-			if preop := CheckPreoptimizationCache(file.filename); preop.Success {
-				hits := atomic.AddInt32(&cacheHits, 1)
-				// every N hits, resort so that the most popular stays
-				// at the top of the heap for faster access and less popular go to bottom
-				if hits%100 == 0 {
-					resort()
-				}
-				results = append(results, preop)
-				continue
-			}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return results, canceled(err, file.filename)
 		}
-		jsonbody = append(jsonbody, Filereq{file.filename, file.body, i})
-		results = append(results, Result{})
-	}
-	if len(jsonbody) == 0 {
-		return results, nil
-	}
-	for _, j := range jsonbody {
-		r, err := getLanguageDetails(ctx, j.Name, j.Body)
+		r, err := defaultDetector.GetLanguageDetails(ctx, file.filename, file.body, skip)
 		if err != nil {
-			return nil, err
+			return results, err
 		}
-		results[j.Index] = r
+		results = append(results, r)
 	}
 	return results, nil
 }
 
-// IsLikelyBinary returns true if the body is likely a binary buffer
+// IsLikelyBinary returns true if the body is likely a binary buffer, because it has the signature of
+// a binary format or its contents aren't text. Use FileType to find out which format it is.
 func IsLikelyBinary(body []byte) bool {
-	ct := http.DetectContentType(body)
-	if strings.HasPrefix(ct, "image/") || strings.HasPrefix(ct, "video/") {
-		return true
-	}
-	switch ct {
-	case "application/octet-stream", "application/pdf", "application/ogg",
-		"application/x-rar-compressed", "application/zip", "application/x-gzip":
-		{
-			return true
-		}
-	}
-	return generaltso.IsBinary(body)
+	return Sniff("", body) != nil || binaryContentType(body) != "" || looksBinary(body)
 }
 
 // MaxBufferSize is the large size in bytes that a buffer can be before it's considered "large"
@@ -397,15 +236,33 @@ func IsLargeBuffer(size int) bool {
 }
 
 func isFilenameExcluded(name string) bool {
-	if excludedFilenames[filepath.Base(name)] || excludeExtensions[filepath.Ext(name)] {
-		return true
+	return filenameExclusion(name) != ""
+}
+
+// filenameExclusion returns a description of the rule which excludes the file, or an empty string if it isn't excluded
+func filenameExclusion(name string) string {
+	if base := filepath.Base(name); excludedFilenames[base] {
+		return "filename " + base
+	}
+	if ext := generaltso.MatchExtension(name, func(ext string) bool { return excludeExtensions[ext] }); ext != "" {
+		return "extension " + ext
 	}
 	for _, rule := range excludedRules {
 		if rule.MatchString(name) {
-			return true
+			return rule.String()
 		}
 	}
-	return false
+	return ""
+}
+
+// languageOverride returns the language which replaces language for the extension of filename, or
+// the empty string if there isn't one
+func languageOverride(language, filename string) string {
+	kv := languageOverrides[language]
+	if kv == nil {
+		return ""
+	}
+	return kv[generaltso.MatchExtension(filename, func(ext string) bool { return kv[ext] != "" })]
 }
 
 var (
@@ -504,14 +361,7 @@ var (
 		"webpack.config.prod.js":     true,
 		"webpackDevServer.config.js": true,
 		"bower.json":                 true,
-		"AUTHORS":                    true,
-		"AUTHORS.md":                 true,
-		"PATENTS":                    true,
-		"license":                    true,
-		"LICENSE":                    true,
-		"LICENSE.md":                 true,
 		"VERSION":                    true,
-		"PULL_REQUEST_TEMPLATE.md":   true,
 		"glide.yaml":                 true,
 		"Gopkg.lock":                 true,
 		"Gopkg.toml":                 true,
@@ -520,43 +370,49 @@ var (
 	}
 	excludedRules = []Match{
 		NewMatcher("^(\\.github|\\.vscode)\\/"),
-		NewMatcher("(node_modules|vendor|Godeps)\\/"),
 		NewMatcher("\\.min\\.js$"),     // minimized JS
 		NewMatcher("\\.js\\.map$"),     // JS sourcemap
 		NewMatcher("^dist/(.*)\\.js$"), // generated JS files
 	}
-	binaryResult   = &Result{true, "", nil, true, false, true, false}
-	largeResult    = &Result{true, "", nil, false, true, true, false}
-	excludedResult = &Result{true, "", nil, false, false, true, false}
+	binaryResult   = &Result{Success: true, IsBinary: true, IsExcluded: true}
+	largeResult    = &Result{Success: true, IsLarge: true, IsExcluded: true}
+	vendoredResult = &Result{Success: true, IsVendored: true, IsExcluded: true}
+	excludedResult = &Result{Success: true, IsExcluded: true}
 )
 
 // AddExcludedRule will add a rule to the exclusions list
 func AddExcludedRule(match Match) {
+	defer atomic.AddInt64(&rulesetGeneration, 1)
 	excludedRules = append(excludedRules, match)
 }
 
 // AddExcludedFilename will add a filename rule to be excluded
 func AddExcludedFilename(filename string) {
+	defer atomic.AddInt64(&rulesetGeneration, 1)
 	excludedFilenames[filename] = true
 }
 
 // AddExcludedExtension will add extension to the exclusion list
 func AddExcludedExtension(ext string) {
+	defer atomic.AddInt64(&rulesetGeneration, 1)
 	excludeExtensions[ext] = true
 }
 
 // RemoveExcludedExtension will remove the extension as an exclusion rule
 func RemoveExcludedExtension(ext string) {
+	defer atomic.AddInt64(&rulesetGeneration, 1)
 	delete(excludeExtensions, ext)
 }
 
 // RemoveExcludedFilename will remove the filename as an exclusion rule
 func RemoveExcludedFilename(filename string) {
+	defer atomic.AddInt64(&rulesetGeneration, 1)
 	delete(excludedFilenames, filename)
 }
 
 // RemoveExcludedRule will remove the added match from the exclusion rule
 func RemoveExcludedRule(match Match) {
+	defer atomic.AddInt64(&rulesetGeneration, 1)
 	for i, m := range excludedRules {
 		if match == m {
 			excludedRules[i] = excludedRules[len(excludedRules)-1]
@@ -568,54 +424,42 @@ func RemoveExcludedRule(match Match) {
 
 // IsExcluded returns true if the filename and optional body is excluded. If nil body, will only check for filename
 func IsExcluded(filename string, body []byte) (bool, *Result) {
+	return isExcluded(context.Background(), NormalizePath(filename), body)
+}
+
+// isExcluded is IsExcluded which traces each check as a span
+func isExcluded(ctx context.Context, filename string, body []byte) (bool, *Result) {
 	if body != nil {
-		if IsLikelyBinary(body) {
-			return true, binaryResult
+		kind, mimeType := FileType(filename, body)
+		if traceCheck(ctx, ExclusionBinary, mimeType != "", "kind", kind, "mime_type", mimeType) {
+			r := *binaryResult
+			r.Kind, r.MimeType = kind, mimeType
+			return true, &r
 		}
-		if IsLargeBuffer(len(body)) {
+		if traceCheck(ctx, ExclusionLarge, IsLargeBuffer(contentSize(filename, body))) {
 			return true, largeResult
 		}
 	}
-	if isFilenameExcluded(filename) {
+	rule := filenameExclusion(filename)
+	if traceCheck(ctx, ExclusionRule, rule != "", "rule", rule) {
 		return true, excludedResult
 	}
 	return false, nil
 }
 
-func getLanguageDetails(ctx context.Context, filename string, body []byte) (Result, error) {
-	// hold lock since generaltso isn't thread safe and uses shared maps
-	generaltsoMutex.Lock()
-	hints := generaltso.LanguageHints(filename)
-	language := generaltso.LanguageByContents(body, hints)
-	vendored := generaltso.IsVendored(filename)
-	generaltsoMutex.Unlock()
-	// see if we have any language rule overrides
-	kv := languageOverrides[language]
-	if kv != nil {
-		l := kv[filepath.Ext(filename)]
-		if l != "" {
-			language = l
+// traceCheck records the result of an exclusion check as a span and returns it
+func traceCheck(ctx context.Context, reason string, excluded bool, attrs ...string) bool {
+	_, span := startSpan(ctx, SpanExclusion+"."+reason)
+	if span.IsRecording() {
+		span.SetAttribute("excluded", excluded)
+		for i := 0; excluded && i+1 < len(attrs); i += 2 {
+			span.SetAttribute(attrs[i], attrs[i+1])
 		}
 	}
-	binary := IsLikelyBinary(body)
-	generated := false
-	large := IsLargeBuffer(len(body))
-	excluded := binary || vendored || generated
-	return Result{
-		Success:    true,
-		IsBinary:   binary,
-		IsExcluded: excluded,
-		IsLarge:    large,
-		Result: &Detection{
-			Path: filename,
-			Type: "text",
-			Language: &Language{
-				Name: language,
-			},
-			IsLarge:     large,
-			IsBinary:    binary,
-			IsGenerated: generated,
-			IsVendored:  vendored,
-		},
-	}, nil
+	span.End()
+	return excluded
+}
+
+func getLanguageDetails(ctx context.Context, filename string, body []byte) (Result, error) {
+	return defaultDetector.getLanguageDetails(ctx, filename, body)
 }
@@ -8,6 +8,7 @@ import (
 	"sync"
 	"testing"
 
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -816,6 +817,12 @@ func TestCacheStats(t *testing.T) {
 	if CacheMisses() != 0 {
 		t.Fatalf("expected cache misses to be 0, was %d", CacheMisses())
 	}
+	if popular := MostPopular(); popular.Language != nil {
+		t.Fatalf("expected no popular language for an empty cache, was %v", popular.Language.Name)
+	}
+	for i := 0; i < 10; i++ {
+		GetLanguageDetails(context.Background(), "foo.yml", []byte("---\nfoo: 1\n"))
+	}
 	popular := MostPopular()
 	if popular.Language.Name != "YAML" {
 		t.Fatalf("expected popular.Language to be YAML, was %v", popular.Language.Name)
@@ -827,11 +834,12 @@ func TestCacheStats(t *testing.T) {
 	if popular.Language.Name != "Go" {
 		t.Fatalf("expected popular.Language to be Go, was %v", popular.Language.Name)
 	}
-	if CacheHits() != 101 {
-		t.Fatalf("expected cache hits to be 101, was %d", CacheHits())
+	// the first lookup of each file is a miss, and the rest are served from the cache
+	if CacheHits() != 109 {
+		t.Fatalf("expected cache hits to be 109, was %d", CacheHits())
 	}
-	if CacheMisses() != 0 {
-		t.Fatalf("expected cache misses to be 0, was %d", CacheMisses())
+	if CacheMisses() != 2 {
+		t.Fatalf("expected cache misses to be 2, was %d", CacheMisses())
 	}
 }
 
@@ -954,6 +962,71 @@ func TestIgnoreExcludedFilename(t *testing.T) {
 	}
 }
 
+func TestIgnoreCompoundExcludedExtension(t *testing.T) {
+	assert := assert.New(t)
+	for _, filename := range []string{".eslintrc.json", "web/.eslintrc.json", "dist/app.tar.gz", "LOGO.PNG", "Notes.DOCX"} {
+		r, err := GetLanguageDetails(context.Background(), filename, []byte("foo\n"))
+		assert.NoError(err)
+		assert.True(r.IsExcluded, filename)
+		assert.Nil(r.Result, filename)
+	}
+	r, err := GetLanguageDetails(context.Background(), "config.json", []byte("{}\n"))
+	assert.NoError(err)
+	assert.False(r.IsExcluded)
+}
+
+func TestExtensions(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{".blade.php", ".php"}, generaltso.Extensions("views/index.blade.php"))
+	assert.Equal([]string{".eslintrc.json", ".json"}, generaltso.Extensions("web/.eslintrc.json"))
+	assert.Equal([]string{".bashrc"}, generaltso.Extensions(".bashrc"))
+	assert.Equal([]string{".tar.gz", ".gz"}, generaltso.Extensions("a.tar.gz"))
+	assert.Nil(generaltso.Extensions("Makefile"))
+	assert.Nil(generaltso.Extensions("dir.d/Makefile"))
+	assert.Nil(generaltso.Extensions("foo."))
+	known := map[string]bool{".C": true, ".c": true, ".cpp": true, ".d.ts": true, ".ts": true}
+	found := func(ext string) bool { return known[ext] }
+	assert.Equal(".C", generaltso.MatchExtension("FOO.C", found))
+	assert.Equal(".c", generaltso.MatchExtension("foo.c", found))
+	assert.Equal(".cpp", generaltso.MatchExtension("FOO.CPP", found))
+	assert.Equal(".d.ts", generaltso.MatchExtension("types/index.D.TS", found))
+	assert.Equal(".ts", generaltso.MatchExtension("app.spec.ts", found))
+	assert.Equal("", generaltso.MatchExtension("foo.go", found))
+}
+
+func TestCompoundAndCaseInsensitiveExtensions(t *testing.T) {
+	assert := assert.New(t)
+	data := generaltso.CurrentData()
+	assert.Equal([]string{"Blade"}, data.LanguagesByExtension("views/index.blade.php"))
+	assert.Equal([]string{"Python"}, data.LanguagesByExtension("SETUP.PY"))
+	assert.Equal([]string{"Python"}, generaltso.LanguageHints("SETUP.PY"))
+	assert.Equal("Python", generaltso.LanguageByFilename("SETUP.PY"))
+	assert.Equal(".blade.php", data.Extension("index.blade.php"))
+	assert.Equal("", data.Extension("Makefile"))
+	for _, skip := range []bool{false, true} {
+		r, err := GetLanguageDetails(context.Background(), "views/index.blade.php", []byte("@extends('layout')\n<p>{{ $name }}</p>\n"), skip)
+		assert.NoError(err)
+		assert.Equal("Blade", r.Result.Language.Name)
+		r, err = GetLanguageDetails(context.Background(), "MAIN.GO", []byte("package main\n"), skip)
+		assert.NoError(err)
+		assert.Equal("Go", r.Result.Language.Name)
+	}
+	// a rule for the shorter extension doesn't match a longer extension of another language
+	assert.NoError(AddPreoptimizationRule(PreoptimizationRule{Extension: ".php", Language: "PHP"}))
+	defer RemovePreoptimizationRule(PreoptimizationRule{Extension: ".php"})
+	r := CheckPreoptimizationCache("views/index.blade.php")
+	assert.Equal("Blade", r.Result.Language.Name)
+	// nor does it without a rule for the longer extension which languages.yml knows
+	assert.True(RemovePreoptimizationRule(PreoptimizationRule{Extension: ".blade.php"}))
+	assert.False(CheckPreoptimizationCache("views/index.blade.php").Success)
+	assert.NoError(AddPreoptimizationRule(PreoptimizationRule{Extension: ".blade.php", Language: "Blade"}))
+	assert.NoError(AddPreoptimizationRule(PreoptimizationRule{Extension: ".twig.php", Language: "Twig"}))
+	defer RemovePreoptimizationRule(PreoptimizationRule{Extension: ".twig.php"})
+	assert.Equal("Twig", CheckPreoptimizationCache("views/index.twig.php").Result.Language.Name)
+	assert.Equal("PHP", CheckPreoptimizationCache("index.php").Result.Language.Name)
+	assert.True(CheckPreoptimizationCache("INDEX.PHP").Success)
+}
+
 func TestMutation(t *testing.T) {
 	r, err := GetLanguageDetails(context.Background(), "foo.js", []byte("var foo\n"))
 	if err != nil {
@@ -0,0 +1,283 @@
+package linguist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+)
+
+// Signature identifies a binary file format by the bytes at an offset of the file, like the magic
+// numbers of libmagic
+type Signature struct {
+	// Kind is a description of the format, such as "ELF executable"
+	Kind     string `json:"kind"`
+	MimeType string `json:"mime_type"`
+	Offset   int    `json:"offset"`
+	Magic    []byte `json:"magic"`
+	// Extensions limits the signature to files with one of the extensions, which are matched like
+	// the extensions of languages. A signature without Magic matches files with one of the
+	// extensions whose contents aren't text.
+	Extensions []string `json:"extensions,omitempty"`
+	// check is an additional test of the body for magic numbers shared by several formats
+	check func(body []byte) bool
+}
+
+func (s Signature) String() string {
+	return fmt.Sprintf("Signature<kind:%v,mime_type:%v,offset:%v,magic:%x,extensions:%v>", s.Kind, s.MimeType, s.Offset, s.Magic, s.Extensions)
+}
+
+func (s *Signature) hasExtension(ext string) bool {
+	for _, e := range s.Extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Signature) match(filename string, body []byte) bool {
+	if len(s.Extensions) > 0 && generaltso.MatchExtension(filename, s.hasExtension) == "" {
+		return false
+	}
+	if len(s.Magic) == 0 {
+		return len(s.Extensions) > 0 && looksBinary(body)
+	}
+	if len(body) < s.Offset+len(s.Magic) || !bytes.Equal(body[s.Offset:s.Offset+len(s.Magic)], s.Magic) {
+		return false
+	}
+	if s.check != nil && !s.check(body) {
+		return false
+	}
+	// printable magic such as OTTO or PK is also the start of some text files
+	return !isPrintable(s.Magic) || !isText(body)
+}
+
+func isPrintable(b []byte) bool {
+	for _, c := range b {
+		if (c < 32 && c != '\t' && c != '\n' && c != '\r') || c > 126 {
+			return false
+		}
+	}
+	return true
+}
+
+// isText returns true if the start of body is valid UTF-8 which doesn't look binary
+func isText(body []byte) bool {
+	if looksBinary(body) {
+		return false
+	}
+	if len(body) > binaryScanSize {
+		body = body[:binaryScanSize]
+	}
+	for len(body) > 0 {
+		r, size := utf8.DecodeRune(body)
+		// a rune cut off at the end of the scan is fine
+		if r == utf8.RuneError && size == 1 && (len(body) >= utf8.UTFMax || utf8.FullRune(body)) {
+			return false
+		}
+		body = body[size:]
+	}
+	return true
+}
+
+// isJavaClass tells Java class files from Mach-O universal binaries, which share the magic
+// number 0xcafebabe. Class files have a major version of at least 45 where universal binaries
+// have a small number of architectures.
+func isJavaClass(body []byte) bool {
+	return len(body) >= 8 && binary.BigEndian.Uint16(body[6:8]) >= 45
+}
+
+// isPE checks that the DOS header of an MZ file points to a PE header
+func isPE(body []byte) bool {
+	if len(body) < 0x40 {
+		return false
+	}
+	offset := int(binary.LittleEndian.Uint32(body[0x3c:0x40]))
+	return offset+4 <= len(body) && bytes.Equal(body[offset:offset+4], []byte("PE\x00\x00"))
+}
+
+// isBzip2 checks the block magic after the header, since BZh is common at the start of text
+func isBzip2(body []byte) bool {
+	return len(body) >= 10 && body[3] >= '1' && body[3] <= '9' && bytes.Equal(body[4:10], []byte("1AY&SY"))
+}
+
+func defaultSignatures() []Signature {
+	return []Signature{
+		{Kind: "ELF executable", MimeType: "application/x-elf", Magic: []byte("\x7fELF")},
+		{Kind: "Mach-O executable", MimeType: "application/x-mach-binary", Magic: []byte{0xfe, 0xed, 0xfa, 0xce}},
+		{Kind: "Mach-O executable", MimeType: "application/x-mach-binary", Magic: []byte{0xfe, 0xed, 0xfa, 0xcf}},
+		{Kind: "Mach-O executable", MimeType: "application/x-mach-binary", Magic: []byte{0xce, 0xfa, 0xed, 0xfe}},
+		{Kind: "Mach-O executable", MimeType: "application/x-mach-binary", Magic: []byte{0xcf, 0xfa, 0xed, 0xfe}},
+		{Kind: "Java class file", MimeType: "application/java-vm", Magic: []byte{0xca, 0xfe, 0xba, 0xbe}, check: isJavaClass},
+		{Kind: "Mach-O universal binary", MimeType: "application/x-mach-binary", Magic: []byte{0xca, 0xfe, 0xba, 0xbe}},
+		{Kind: "PE executable", MimeType: "application/vnd.microsoft.portable-executable", Magic: []byte("MZ"), check: isPE},
+		{Kind: "WebAssembly binary", MimeType: "application/wasm", Magic: []byte("\x00asm")},
+		{Kind: "LLVM bitcode", MimeType: "application/x-llvm-bitcode", Magic: []byte("BC\xc0\xde")},
+		{Kind: "Dalvik executable", MimeType: "application/vnd.android.dex", Magic: []byte("dex\n")},
+		{Kind: "SQLite database", MimeType: "application/vnd.sqlite3", Magic: []byte("SQLite format 3\x00")},
+		{Kind: "HDF5 data", MimeType: "application/x-hdf5", Magic: []byte("\x89HDF\r\n\x1a\n")},
+		{Kind: "PDF document", MimeType: "application/pdf", Magic: []byte("%PDF-")},
+		{Kind: "PNG image", MimeType: "image/png", Magic: []byte("\x89PNG\r\n\x1a\n")},
+		{Kind: "JPEG image", MimeType: "image/jpeg", Magic: []byte{0xff, 0xd8, 0xff}},
+		{Kind: "GIF image", MimeType: "image/gif", Magic: []byte("GIF87a")},
+		{Kind: "GIF image", MimeType: "image/gif", Magic: []byte("GIF89a")},
+		{Kind: "WebP image", MimeType: "image/webp", Offset: 8, Magic: []byte("WEBP")},
+		{Kind: "ICO image", MimeType: "image/x-icon", Magic: []byte{0x00, 0x00, 0x01, 0x00}},
+		{Kind: "WAV audio", MimeType: "audio/wav", Offset: 8, Magic: []byte("WAVE")},
+		{Kind: "Ogg media", MimeType: "application/ogg", Magic: []byte("OggS")},
+		{Kind: "MP4 media", MimeType: "video/mp4", Offset: 4, Magic: []byte("ftyp")},
+		{Kind: "TrueType font", MimeType: "font/ttf", Magic: []byte{0x00, 0x01, 0x00, 0x00, 0x00}},
+		{Kind: "OpenType font", MimeType: "font/otf", Magic: []byte("OTTO")},
+		{Kind: "TrueType font collection", MimeType: "font/collection", Magic: []byte("ttcf")},
+		{Kind: "WOFF font", MimeType: "font/woff", Magic: []byte("wOFF")},
+		{Kind: "WOFF2 font", MimeType: "font/woff2", Magic: []byte("wOF2")},
+		{Kind: "Zip archive", MimeType: "application/zip", Magic: []byte("PK\x03\x04")},
+		{Kind: "gzip compressed data", MimeType: "application/gzip", Magic: []byte{0x1f, 0x8b}},
+		{Kind: "bzip2 compressed data", MimeType: "application/x-bzip2", Magic: []byte("BZh"), check: isBzip2},
+		{Kind: "XZ compressed data", MimeType: "application/x-xz", Magic: []byte("\xfd7zXZ\x00")},
+		{Kind: "Zstandard compressed data", MimeType: "application/zstd", Magic: []byte{0x28, 0xb5, 0x2f, 0xfd}},
+		{Kind: "7-zip archive", MimeType: "application/x-7z-compressed", Magic: []byte("7z\xbc\xaf\x27\x1c")},
+		{Kind: "RAR archive", MimeType: "application/vnd.rar", Magic: []byte("Rar!\x1a\x07")},
+		{Kind: "tar archive", MimeType: "application/x-tar", Offset: 257, Magic: []byte("ustar")},
+		{Kind: "Protocol Buffers binary", MimeType: "application/x-protobuf", Extensions: []string{".pb", ".binpb"}},
+	}
+}
+
+var (
+	signaturesMu sync.RWMutex
+	signatures   = defaultSignatures()
+)
+
+// Signatures returns a copy of the signatures used to identify binary files, in the order they're checked
+func Signatures() []Signature {
+	signaturesMu.RLock()
+	defer signaturesMu.RUnlock()
+	return append([]Signature{}, signatures...)
+}
+
+// AddSignature adds a signature for a binary file format. It's checked before the built in
+// signatures, so it can be used to give a more specific kind to a format.
+func AddSignature(s Signature) error {
+	if s.Kind == "" {
+		return fmt.Errorf("signature needs a kind")
+	}
+	if len(s.Magic) == 0 && len(s.Extensions) == 0 {
+		return fmt.Errorf("signature %s needs magic bytes or extensions", s.Kind)
+	}
+	if s.Offset < 0 {
+		return fmt.Errorf("signature %s has a negative offset", s.Kind)
+	}
+	defer atomic.AddInt64(&rulesetGeneration, 1)
+	signaturesMu.Lock()
+	signatures = append([]Signature{s}, signatures...)
+	signaturesMu.Unlock()
+	return nil
+}
+
+// RemoveSignature removes the signatures of kind and returns false if there weren't any
+func RemoveSignature(kind string) bool {
+	defer atomic.AddInt64(&rulesetGeneration, 1)
+	signaturesMu.Lock()
+	defer signaturesMu.Unlock()
+	found := false
+	kept := signatures[:0:0]
+	for _, s := range signatures {
+		if s.Kind == kind {
+			found = true
+			continue
+		}
+		kept = append(kept, s)
+	}
+	signatures = kept
+	return found
+}
+
+// ResetSignatures puts back the built in signatures
+func ResetSignatures() {
+	defer atomic.AddInt64(&rulesetGeneration, 1)
+	signaturesMu.Lock()
+	signatures = defaultSignatures()
+	signaturesMu.Unlock()
+}
+
+// Sniff returns the signature of the binary format of body, or nil if it doesn't match one. The
+// filename is only used for signatures limited to extensions and may be empty.
+func Sniff(filename string, body []byte) *Signature {
+	signaturesMu.RLock()
+	defer signaturesMu.RUnlock()
+	for i := range signatures {
+		if signatures[i].match(filename, body) {
+			s := signatures[i]
+			return &s
+		}
+	}
+	return nil
+}
+
+// FileType returns the kind and MIME type of a binary file, or empty strings if it isn't one.
+// Files without a matching signature use the MIME type of http.DetectContentType.
+func FileType(filename string, body []byte) (kind, mimeType string) {
+	if s := Sniff(filename, body); s != nil {
+		return s.Kind, s.MimeType
+	}
+	if ct := binaryContentType(body); ct != "" {
+		return "", ct
+	}
+	if looksBinary(body) {
+		return "", "application/octet-stream"
+	}
+	return "", ""
+}
+
+// binaryContentType returns the binary MIME type found by http.DetectContentType. Its generic
+// application/octet-stream is left out, since any control character gives it, and so are files
+// which are text despite starting with a signature.
+func binaryContentType(body []byte) string {
+	ct := http.DetectContentType(body)
+	binary := strings.HasPrefix(ct, "image/") || strings.HasPrefix(ct, "video/") || strings.HasPrefix(ct, "audio/") || strings.HasPrefix(ct, "font/")
+	switch ct {
+	case "application/pdf", "application/ogg", "application/x-rar-compressed", "application/zip",
+		"application/x-gzip", "application/wasm":
+		binary = true
+	}
+	if !binary || isText(body) {
+		return ""
+	}
+	return ct
+}
+
+// the number of bytes at the start of a file which are checked for binary content
+const binaryScanSize = 8000
+
+// looksBinary returns true if the start of body has a NUL byte, as git does, or if more than one
+// in ten bytes is a control character which doesn't appear in text. Text with a stray escape or
+// form feed isn't binary. UTF-16 text with a byte order mark is never binary.
+func looksBinary(body []byte) bool {
+	if bytes.HasPrefix(body, []byte{0xff, 0xfe}) || bytes.HasPrefix(body, []byte{0xfe, 0xff}) {
+		return false
+	}
+	if len(body) > binaryScanSize {
+		body = body[:binaryScanSize]
+	}
+	if len(body) == 0 {
+		return false
+	}
+	var control int
+	for _, b := range body {
+		switch {
+		case b == 0:
+			return true
+		case b == '\t', b == '\n', b == '\r', b == '\f', b == '\v', b == '\b', b == 0x1b:
+		case b < 32, b == 0x7f:
+			control++
+		}
+	}
+	return control*10 > len(body)
+}
@@ -0,0 +1,133 @@
+package linguist
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// peHeader returns the start of a PE executable whose DOS header points to the PE header at 0x40
+func peHeader() []byte {
+	b := make([]byte, 0x48)
+	copy(b, "MZ")
+	b[0x3c] = 0x40
+	copy(b[0x40:], "PE\x00\x00")
+	return b
+}
+
+func TestSniff(t *testing.T) {
+	assert := assert.New(t)
+	tar := make([]byte, 512)
+	copy(tar[257:], "ustar")
+	for _, tc := range []struct {
+		filename string
+		body     []byte
+		kind     string
+		mimeType string
+	}{
+		{"a.out", []byte("\x7fELF\x02\x01\x01\x00\x00\x00"), "ELF executable", "application/x-elf"},
+		{"a.out", []byte{0xcf, 0xfa, 0xed, 0xfe, 0x07, 0x00, 0x00, 0x01}, "Mach-O executable", "application/x-mach-binary"},
+		{"a.out", []byte{0xca, 0xfe, 0xba, 0xbe, 0x00, 0x00, 0x00, 0x02}, "Mach-O universal binary", "application/x-mach-binary"},
+		{"Main.class", []byte{0xca, 0xfe, 0xba, 0xbe, 0x00, 0x00, 0x00, 0x34}, "Java class file", "application/java-vm"},
+		{"app.exe", peHeader(), "PE executable", "application/vnd.microsoft.portable-executable"},
+		{"app.wasm", []byte("\x00asm\x01\x00\x00\x00"), "WebAssembly binary", "application/wasm"},
+		{"app.db", []byte("SQLite format 3\x00\x10\x00"), "SQLite database", "application/vnd.sqlite3"},
+		{"font.woff2", []byte("wOF2\x00\x01\x00\x00"), "WOFF2 font", "font/woff2"},
+		{"font.ttf", []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x0f}, "TrueType font", "font/ttf"},
+		{"image.webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), "WebP image", "image/webp"},
+		{"data.bz2", []byte("BZh91AY&SY\x00"), "bzip2 compressed data", "application/x-bzip2"},
+		{"data.tar", tar, "tar archive", "application/x-tar"},
+		{"model.pb", []byte{0x0a, 0x05, 0x01, 0x02, 0x00, 0x12}, "Protocol Buffers binary", "application/x-protobuf"},
+	} {
+		s := Sniff(tc.filename, tc.body)
+		if assert.NotNil(s, tc.kind) {
+			assert.Equal(tc.kind, s.Kind)
+			assert.Equal(tc.mimeType, s.MimeType)
+		}
+		assert.True(IsLikelyBinary(tc.body), tc.kind)
+	}
+}
+
+func TestSniffText(t *testing.T) {
+	assert := assert.New(t)
+	for _, body := range []string{
+		"MZ is the signature of DOS executables\n",
+		"BZh is the start of a bzip2 file\n",
+		"OTTO the cat\n",
+		"#!/bin/sh\necho \x1b[1mbold\x1b[0m\n",
+		"page one\n\fpage two\n",
+		"a stray \x01 control character in an otherwise normal line of text\n",
+	} {
+		assert.Nil(Sniff("file.txt", []byte(body)), body)
+		assert.False(IsLikelyBinary([]byte(body)), body)
+		kind, mimeType := FileType("file.txt", []byte(body))
+		assert.Empty(kind)
+		assert.Empty(mimeType)
+	}
+	// a .pb file which is text isn't a protobuf binary
+	assert.Nil(Sniff("graph.pb", []byte("node {\n  name: \"x\"\n}\n")))
+	// UTF-16 text with a byte order mark
+	assert.False(IsLikelyBinary([]byte("\xff\xfeh\x00i\x00\n\x00")))
+	assert.True(IsLikelyBinary([]byte("\x01\x02\x03\x04 junk")))
+	assert.True(IsLikelyBinary([]byte("text\x00with a nul")))
+}
+
+func TestFileTypeFallback(t *testing.T) {
+	assert := assert.New(t)
+	kind, mimeType := FileType("blob", []byte("\x01\x02\x03\x04\x05\x06"))
+	assert.Empty(kind)
+	assert.Equal("application/octet-stream", mimeType)
+	kind, mimeType = FileType("image.bmp", []byte("BM\x36\x00\x00\x00\x00\x00\x00\x00\x36\x00\x00\x00"))
+	assert.Empty(kind)
+	assert.Equal("image/bmp", mimeType)
+}
+
+func TestAddSignature(t *testing.T) {
+	assert := assert.New(t)
+	defer ResetSignatures()
+	body := []byte("GRPH\x00\x01\x00\x00 model data")
+	assert.Nil(Sniff("model.bin", body))
+	assert.NoError(AddSignature(Signature{Kind: "Graph model", MimeType: "application/x-graph", Magic: []byte("GRPH")}))
+	s := Sniff("model.bin", body)
+	if assert.NotNil(s) {
+		assert.Equal("Graph model", s.Kind)
+	}
+	// custom signatures are checked first
+	assert.NoError(AddSignature(Signature{Kind: "Go test ELF", MimeType: "application/x-elf", Magic: []byte("\x7fELF"), Extensions: []string{".test"}}))
+	assert.Equal("Go test ELF", Sniff("linguist.test", []byte("\x7fELF\x02")).Kind)
+	assert.Equal("ELF executable", Sniff("linguist", []byte("\x7fELF\x02")).Kind)
+	// extensions are matched like the extensions of languages, including compound and upper case ones
+	assert.Equal("Go test ELF", Sniff("bin/LINGUIST.TEST", []byte("\x7fELF\x02")).Kind)
+	assert.NoError(AddSignature(Signature{Kind: "Model archive", MimeType: "application/x-model", Extensions: []string{".model.bin"}}))
+	assert.Equal("Model archive", Sniff("weights.MODEL.BIN", []byte("\x00\x01\x02\x03")).Kind)
+	assert.Nil(Sniff("weights.bin", []byte("\x00\x01\x02\x03")))
+	assert.True(RemoveSignature("Model archive"))
+
+	assert.True(RemoveSignature("Graph model"))
+	assert.False(RemoveSignature("Graph model"))
+	assert.Nil(Sniff("model.bin", body))
+
+	assert.Error(AddSignature(Signature{MimeType: "application/x-nothing", Magic: []byte("X")}))
+	assert.Error(AddSignature(Signature{Kind: "Nothing"}))
+	assert.Error(AddSignature(Signature{Kind: "Nothing", Magic: []byte("X"), Offset: -1}))
+}
+
+func TestBinaryResultKind(t *testing.T) {
+	assert := assert.New(t)
+	r, err := GetLanguageDetails(context.Background(), "bin/tool", []byte("\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00"))
+	assert.NoError(err)
+	assert.True(r.IsBinary)
+	assert.True(r.IsExcluded)
+	assert.Nil(r.Result)
+	assert.Equal("ELF executable", r.Kind)
+	assert.Equal("application/x-elf", r.MimeType)
+	// the shared binary result isn't changed
+	assert.Empty(binaryResult.Kind)
+
+	r, err = GetLanguageDetails(context.Background(), "notes.txt", []byte("a stray \x01 control character in an otherwise normal line of text\n"))
+	assert.NoError(err)
+	assert.False(r.IsBinary)
+	assert.Empty(r.MimeType)
+	assert.NotNil(r.Result)
+}
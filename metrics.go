@@ -0,0 +1,379 @@
+package linguist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// outcomes of a detection reported to Metrics
+const (
+	OutcomeDetected = "detected"
+	OutcomeUnknown  = "unknown"
+	OutcomeExcluded = "excluded"
+	OutcomeError    = "error"
+)
+
+// stages of a detection whose latency is reported to Metrics
+const (
+	StageTokenize = "tokenize"
+	StageClassify = "classify"
+	StageTotal    = "total"
+)
+
+// reasons a file is excluded reported to Metrics
+const (
+	ExclusionBinary    = "binary"
+	ExclusionLarge     = "large"
+	ExclusionRule      = "rule"
+	ExclusionVendored  = "vendored"
+	ExclusionGenerated = "generated"
+	// ExclusionDocumentation is only reported when documentation is excluded with SetExcludeDocumentation
+	ExclusionDocumentation = "documentation"
+)
+
+// cache events reported to Metrics
+const (
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheEvict = "evict"
+)
+
+// Metrics receives measurements from detection. Implementations must be safe for concurrent
+// use and should be cheap, since they are called on every detection.
+type Metrics interface {
+	// Detection counts a detection of language by strategy with one of the Outcome constants
+	Detection(language, outcome, strategy string)
+	// Latency observes the duration of one of the Stage constants
+	Latency(stage string, d time.Duration)
+	// Exclusion counts a file excluded for one of the Exclusion constants
+	Exclusion(reason string)
+	// Cache counts one of the Cache event constants
+	Cache(event string)
+	// BytesProcessed counts the bytes of the files passed to detection
+	BytesProcessed(n int)
+	// LockWait observes the time spent waiting for the lock around the language registry
+	LockWait(d time.Duration)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) Detection(language, outcome, strategy string) {}
+func (nopMetrics) Latency(stage string, d time.Duration)        {}
+func (nopMetrics) Exclusion(reason string)                      {}
+func (nopMetrics) Cache(event string)                           {}
+func (nopMetrics) BytesProcessed(n int)                         {}
+func (nopMetrics) LockWait(d time.Duration)                     {}
+
+type metricsHolder struct {
+	m Metrics
+}
+
+var currentMetrics atomic.Value
+
+func init() {
+	currentMetrics.Store(metricsHolder{nopMetrics{}})
+}
+
+// SetMetrics sets the Metrics which all detections and caches report to. Metrics are off by default, and nil turns them off again.
+func SetMetrics(m Metrics) {
+	if m == nil {
+		m = nopMetrics{}
+	}
+	currentMetrics.Store(metricsHolder{m})
+}
+
+func metrics() Metrics {
+	return currentMetrics.Load().(metricsHolder).m
+}
+
+// observeResult reports a finished detection to the metrics
+func observeResult(m Metrics, result Result, err error, size int, elapsed time.Duration) {
+	m.BytesProcessed(size)
+	m.Latency(StageTotal, elapsed)
+	var language, strategy string
+	if result.Result != nil {
+		strategy = result.Result.Strategy
+		if result.Result.Language != nil {
+			language = result.Result.Language.Name
+		}
+	}
+	switch {
+	case err != nil:
+		m.Detection(language, OutcomeError, strategy)
+		return
+	case result.IsExcluded:
+		m.Detection(language, OutcomeExcluded, strategy)
+	case language == "":
+		m.Detection(language, OutcomeUnknown, strategy)
+	default:
+		m.Detection(language, OutcomeDetected, strategy)
+	}
+	if !result.IsExcluded {
+		return
+	}
+	switch {
+	case result.IsBinary:
+		m.Exclusion(ExclusionBinary)
+	case result.IsLarge:
+		m.Exclusion(ExclusionLarge)
+	case result.IsVendored:
+		m.Exclusion(ExclusionVendored)
+	case result.Result == nil:
+		m.Exclusion(ExclusionRule)
+	case result.Result.IsGenerated:
+		m.Exclusion(ExclusionGenerated)
+	case result.Result.IsDocumentation:
+		m.Exclusion(ExclusionDocumentation)
+	}
+}
+
+// DefaultLatencyBuckets are the upper bounds in seconds of the histograms of PrometheusMetrics
+var DefaultLatencyBuckets = []float64{0.00001, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	for i, b := range buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// PrometheusMetrics is a Metrics which keeps the measurements in memory and writes them in the
+// Prometheus text exposition format. It is an http.Handler, so it can be served directly:
+//
+//	m := linguist.NewPrometheusMetrics()
+//	linguist.SetMetrics(m)
+//	http.Handle("/metrics", m)
+type PrometheusMetrics struct {
+	mu         sync.Mutex
+	namespace  string
+	buckets    []float64
+	detections map[[3]string]int64
+	exclusions map[string]int64
+	cache      map[string]int64
+	latency    map[string]*histogram
+	lockWait   *histogram
+	bytes      int64
+}
+
+var _ Metrics = (*PrometheusMetrics)(nil)
+
+// NewPrometheusMetrics returns a PrometheusMetrics whose metric names start with namespace, or linguist if none is passed
+func NewPrometheusMetrics(namespace ...string) *PrometheusMetrics {
+	m := &PrometheusMetrics{
+		namespace:  "linguist",
+		buckets:    DefaultLatencyBuckets,
+		detections: make(map[[3]string]int64),
+		exclusions: make(map[string]int64),
+		cache:      make(map[string]int64),
+		latency:    make(map[string]*histogram),
+	}
+	if len(namespace) > 0 && namespace[0] != "" {
+		m.namespace = namespace[0]
+	}
+	m.lockWait = m.newHistogram()
+	return m
+}
+
+func (m *PrometheusMetrics) newHistogram() *histogram {
+	return &histogram{counts: make([]int64, len(m.buckets))}
+}
+
+// Detection counts a detection
+func (m *PrometheusMetrics) Detection(language, outcome, strategy string) {
+	m.mu.Lock()
+	m.detections[[3]string{language, outcome, strategy}]++
+	m.mu.Unlock()
+}
+
+// Latency observes the duration of a stage
+func (m *PrometheusMetrics) Latency(stage string, d time.Duration) {
+	m.mu.Lock()
+	h := m.latency[stage]
+	if h == nil {
+		h = m.newHistogram()
+		m.latency[stage] = h
+	}
+	h.observe(m.buckets, d.Seconds())
+	m.mu.Unlock()
+}
+
+// Exclusion counts an excluded file
+func (m *PrometheusMetrics) Exclusion(reason string) {
+	m.mu.Lock()
+	m.exclusions[reason]++
+	m.mu.Unlock()
+}
+
+// Cache counts a cache event
+func (m *PrometheusMetrics) Cache(event string) {
+	m.mu.Lock()
+	m.cache[event]++
+	m.mu.Unlock()
+}
+
+// BytesProcessed counts the bytes passed to detection
+func (m *PrometheusMetrics) BytesProcessed(n int) {
+	m.mu.Lock()
+	m.bytes += int64(n)
+	m.mu.Unlock()
+}
+
+// LockWait observes the time spent waiting for the language registry lock
+func (m *PrometheusMetrics) LockWait(d time.Duration) {
+	m.mu.Lock()
+	m.lockWait.observe(m.buckets, d.Seconds())
+	m.mu.Unlock()
+}
+
+// Reset zeroes all the metrics
+func (m *PrometheusMetrics) Reset() {
+	m.mu.Lock()
+	m.detections = make(map[[3]string]int64)
+	m.exclusions = make(map[string]int64)
+	m.cache = make(map[string]int64)
+	m.latency = make(map[string]*histogram)
+	m.lockWait = m.newHistogram()
+	m.bytes = 0
+	m.mu.Unlock()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats pairs of label names and values as {name="value",...}
+func labels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(pairs[i])
+		sb.WriteString(`="`)
+		sb.WriteString(labelEscaper.Replace(pairs[i+1]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	m.mu.Lock()
+	m.write(bw)
+	m.mu.Unlock()
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (m *PrometheusMetrics) header(w io.Writer, name, typ, help string) string {
+	name = m.namespace + "_" + name
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	return name
+}
+
+func (m *PrometheusMetrics) writeHistogram(w io.Writer, name string, h *histogram, pairs ...string) {
+	for i, b := range m.buckets {
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels(append(pairs, "le", formatFloat(b))...), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels(append(pairs, "le", "+Inf")...), h.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels(pairs...), formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels(pairs...), h.count)
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *PrometheusMetrics) write(w io.Writer) {
+	name := m.header(w, "detections_total", "counter", "Number of detections by language, outcome and strategy.")
+	detections := make([][3]string, 0, len(m.detections))
+	for k := range m.detections {
+		detections = append(detections, k)
+	}
+	sort.Slice(detections, func(i, j int) bool {
+		a, b := detections[i], detections[j]
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+	for _, k := range detections {
+		fmt.Fprintf(w, "%s%s %d\n", name, labels("language", k[0], "outcome", k[1], "strategy", k[2]), m.detections[k])
+	}
+
+	name = m.header(w, "detection_duration_seconds", "histogram", "Time spent detecting by stage.")
+	stages := make([]string, 0, len(m.latency))
+	for stage := range m.latency {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		m.writeHistogram(w, name, m.latency[stage], "stage", stage)
+	}
+
+	name = m.header(w, "exclusions_total", "counter", "Number of excluded files by reason.")
+	for _, reason := range sortedKeys(m.exclusions) {
+		fmt.Fprintf(w, "%s%s %d\n", name, labels("reason", reason), m.exclusions[reason])
+	}
+
+	name = m.header(w, "cache_events_total", "counter", "Number of cache hits, misses and evictions.")
+	for _, event := range sortedKeys(m.cache) {
+		fmt.Fprintf(w, "%s%s %d\n", name, labels("event", event), m.cache[event])
+	}
+
+	name = m.header(w, "processed_bytes_total", "counter", "Number of bytes passed to detection.")
+	fmt.Fprintf(w, "%s %d\n", name, m.bytes)
+
+	name = m.header(w, "lock_wait_seconds", "histogram", "Time spent waiting for the language registry lock.")
+	m.writeHistogram(w, name, m.lockWait)
+}
+
+// ServeHTTP writes the metrics for a Prometheus scrape
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
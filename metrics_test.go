@@ -0,0 +1,104 @@
+package linguist
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusMetricsFormat(t *testing.T) {
+	assert := assert.New(t)
+	m := NewPrometheusMetrics("test")
+	m.Detection("Go", OutcomeDetected, ExtensionStrategyName)
+	m.Detection("Go", OutcomeDetected, ExtensionStrategyName)
+	m.Detection(`C"#`, OutcomeDetected, ClassifierStrategyName)
+	m.Latency(StageTotal, 2*time.Millisecond)
+	m.Exclusion(ExclusionBinary)
+	m.Cache(CacheMiss)
+	m.BytesProcessed(42)
+	m.LockWait(time.Microsecond)
+	var buf bytes.Buffer
+	n, err := m.WriteTo(&buf)
+	assert.NoError(err)
+	assert.Equal(int64(buf.Len()), n)
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE test_detections_total counter",
+		`test_detections_total{language="Go",outcome="detected",strategy="extension"} 2`,
+		`test_detections_total{language="C\"#",outcome="detected",strategy="classifier"} 1`,
+		"# TYPE test_detection_duration_seconds histogram",
+		`test_detection_duration_seconds_bucket{stage="total",le="0.001"} 0`,
+		`test_detection_duration_seconds_bucket{stage="total",le="0.005"} 1`,
+		`test_detection_duration_seconds_bucket{stage="total",le="+Inf"} 1`,
+		`test_detection_duration_seconds_sum{stage="total"} 0.002`,
+		`test_detection_duration_seconds_count{stage="total"} 1`,
+		`test_exclusions_total{reason="binary"} 1`,
+		`test_cache_events_total{event="miss"} 1`,
+		"test_processed_bytes_total 42",
+		"test_lock_wait_seconds_count 1",
+	} {
+		assert.Contains(out, line+"\n")
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(out, rec.Body.String())
+	assert.True(strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain"))
+
+	m.Reset()
+	buf.Reset()
+	m.WriteTo(&buf)
+	assert.NotContains(buf.String(), "test_detections_total{")
+	assert.Contains(buf.String(), "test_processed_bytes_total 0\n")
+}
+
+func TestDetectorMetrics(t *testing.T) {
+	assert := assert.New(t)
+	m := NewPrometheusMetrics()
+	SetMetrics(m)
+	defer SetMetrics(nil)
+	d := NewDetector(WithCache(NewMemoryCache(memoryCacheShards)))
+	ctx := context.Background()
+	body := []byte("#include <stdio.h>\nint main() { return 0; }\n")
+	for i := 0; i < 2; i++ {
+		_, err := d.GetLanguageDetails(ctx, "main.c", body)
+		assert.NoError(err)
+	}
+	_, err := d.GetLanguageDetails(ctx, "image.png", []byte("\x89PNG\r\n\x1a\n\x00\x00"))
+	assert.NoError(err)
+	_, err = d.GetLanguageDetails(ctx, "api/api.pb.go", []byte("package api\n"))
+	assert.NoError(err)
+	// fill the cache to force an eviction
+	for i := 0; i < memoryCacheShards*4; i++ {
+		d.GetLanguageDetails(ctx, "foo.go", []byte(strings.Repeat("\n", i)+"package foo\n"))
+	}
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	out := buf.String()
+	assert.Contains(out, `linguist_detections_total{language="C",outcome="detected",strategy="preoptimization"} 2`)
+	assert.Contains(out, `linguist_exclusions_total{reason="binary"} 1`)
+	assert.Contains(out, `linguist_exclusions_total{reason="generated"} 1`)
+	assert.Contains(out, `linguist_cache_events_total{event="hit"} 1`)
+	assert.Contains(out, `linguist_cache_events_total{event="evict"}`)
+	assert.Contains(out, `linguist_detection_duration_seconds_count{stage="total"}`)
+	assert.NotContains(out, "linguist_processed_bytes_total 0\n")
+}
+
+func TestMetricsClassifierStages(t *testing.T) {
+	assert := assert.New(t)
+	m := NewPrometheusMetrics()
+	SetMetrics(m)
+	defer SetMetrics(nil)
+	_, err := GetLanguageDetails(context.Background(), "noext", []byte("package main\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n"), true)
+	assert.NoError(err)
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	assert.Contains(buf.String(), `linguist_detection_duration_seconds_count{stage="tokenize"} 1`)
+	assert.Contains(buf.String(), `linguist_detection_duration_seconds_count{stage="classify"} 1`)
+	assert.Contains(buf.String(), "linguist_lock_wait_seconds_count 1\n")
+}
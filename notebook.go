@@ -0,0 +1,256 @@
+package linguist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// notebookMetadata is the part of the metadata of a Jupyter notebook which names its language
+type notebookMetadata struct {
+	Kernelspec struct {
+		Language string `json:"language"`
+	} `json:"kernelspec"`
+	LanguageInfo struct {
+		Name string `json:"name"`
+	} `json:"language_info"`
+}
+
+// notebookCell is a cell of a Jupyter notebook with the offsets of its source in the file
+type notebookCell struct {
+	cellType   string
+	start, end int
+	source     []byte
+}
+
+// parseNotebook returns the metadata and cells of a Jupyter notebook, or false if it isn't one
+func parseNotebook(body []byte) (notebookMetadata, []notebookCell, bool) {
+	var meta notebookMetadata
+	var cells []notebookCell
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return meta, nil, false
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return meta, nil, false
+		}
+		switch key {
+		case "metadata":
+			if dec.Decode(&meta) != nil {
+				return meta, nil, false
+			}
+		case "cells":
+			if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+				return meta, nil, false
+			}
+			for dec.More() {
+				cell, ok := parseNotebookCell(dec)
+				if !ok {
+					return meta, nil, false
+				}
+				cells = append(cells, cell)
+			}
+			if _, err := dec.Token(); err != nil {
+				return meta, nil, false
+			}
+		default:
+			var skip json.RawMessage
+			if dec.Decode(&skip) != nil {
+				return meta, nil, false
+			}
+		}
+	}
+	return meta, cells, true
+}
+
+func parseNotebookCell(dec *json.Decoder) (notebookCell, bool) {
+	var cell notebookCell
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return cell, false
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return cell, false
+		}
+		var raw json.RawMessage
+		if dec.Decode(&raw) != nil {
+			return cell, false
+		}
+		switch key {
+		case "cell_type":
+			json.Unmarshal(raw, &cell.cellType)
+		case "source":
+			// the source is a string or a list of lines
+			cell.end = int(dec.InputOffset())
+			cell.start = cell.end - len(raw)
+			var lines []string
+			if json.Unmarshal(raw, &lines) != nil {
+				var s string
+				json.Unmarshal(raw, &s)
+				lines = []string{s}
+			}
+			cell.source = []byte(strings.Join(lines, ""))
+		}
+	}
+	_, err := dec.Token()
+	return cell, err == nil
+}
+
+// notebookLanguage returns the language of the code cells of a notebook from its metadata
+func (d *Detector) notebookLanguage(meta notebookMetadata) string {
+	for _, name := range []string{meta.LanguageInfo.Name, meta.Kernelspec.Language} {
+		if l := d.segmentLanguage(name); l != "" {
+			return l
+		}
+	}
+	return ""
+}
+
+// cellMagicRE matches the cell magics of IPython which run a cell in another language, such as %%bash
+var cellMagicRE = regexp.MustCompile(`^%%(\w+)`)
+
+// splitNotebook finds the source of the cells of a Jupyter notebook. The source of code cells is
+// in the language of the kernel unless a cell magic names another one.
+func splitNotebook(d *Detector, body []byte) []region {
+	meta, cells, ok := parseNotebook(body)
+	if !ok {
+		return nil
+	}
+	language := d.notebookLanguage(meta)
+	var regions []region
+	for _, cell := range cells {
+		r := region{start: cell.start, end: cell.end, body: cell.source}
+		switch cell.cellType {
+		case "code":
+			r.language = language
+			if m := cellMagicRE.FindSubmatch(cell.source); m != nil {
+				r.hint = string(m[1])
+			}
+		case "markdown":
+			r.language = "Markdown"
+			r.documentation = true
+		default:
+			continue
+		}
+		regions = append(regions, r)
+	}
+	return regions
+}
+
+// MaxNotebookSize is the size in bytes up to which notebooks are read whole by ScanDirectory and
+// ScanArchive, since most of a notebook is usually outputs which don't count towards MaxBufferSize
+const MaxNotebookSize = 50 << 20
+
+// readLimit returns the number of bytes of a file which are read to detect it
+func readLimit(filename string) int64 {
+	if IsNotebook(filename) {
+		return MaxNotebookSize + 1
+	}
+	return MaxBufferSize + 1
+}
+
+// IsNotebook returns true if the filename is a Jupyter notebook
+func IsNotebook(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".ipynb")
+}
+
+// NotebookStats are the sizes of the cells of a Jupyter notebook. Only the source of the cells is
+// counted, not their outputs such as images, nor the metadata of the notebook.
+type NotebookStats struct {
+	// Language is the language of the kernel from metadata.language_info or metadata.kernelspec,
+	// or detected from the code cells if the metadata doesn't name one
+	Language  string `json:"language,omitempty"`
+	CodeCells int    `json:"code_cells"`
+	CodeBytes int    `json:"code_bytes"`
+	CodeLines int    `json:"code_lines"`
+	// markdown cells are documentation
+	MarkdownCells int `json:"markdown_cells"`
+	MarkdownBytes int `json:"markdown_bytes"`
+	MarkdownLines int `json:"markdown_lines"`
+	// Languages are the bytes of the code cells by language, which differs from the kernel for
+	// cells run with a magic such as %%bash
+	Languages map[string]int `json:"languages,omitempty"`
+}
+
+// countLines returns the number of lines of source
+func countLines(source []byte) int {
+	n := bytes.Count(source, []byte("\n"))
+	if len(source) > 0 && source[len(source)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// notebookSourceSize returns the bytes of the source of the cells of a notebook, or false if body isn't one
+func notebookSourceSize(body []byte) (int, bool) {
+	_, cells, ok := parseNotebook(body)
+	if !ok {
+		return 0, false
+	}
+	var n int
+	for _, cell := range cells {
+		n += len(cell.source)
+	}
+	return n, true
+}
+
+// contentSize returns the size of a file which counts towards MaxBufferSize, which is the size of
+// the source of the cells of notebooks
+func contentSize(filename string, body []byte) int {
+	if IsNotebook(filename) {
+		if n, ok := notebookSourceSize(body); ok {
+			return n
+		}
+	}
+	return len(body)
+}
+
+// notebookStats returns the stats of a notebook, or nil if body isn't one. Code cells are in the
+// language of the kernel, and are detected from their source if the metadata doesn't name one.
+func (d *Detector) notebookStats(ctx context.Context, body []byte) (*NotebookStats, error) {
+	meta, cells, ok := parseNotebook(body)
+	if !ok {
+		return nil, nil
+	}
+	stats := &NotebookStats{Language: d.notebookLanguage(meta), Languages: make(map[string]int)}
+	for _, cell := range cells {
+		switch cell.cellType {
+		case "code":
+			stats.CodeCells++
+			stats.CodeBytes += len(cell.source)
+			stats.CodeLines += countLines(cell.source)
+			language := stats.Language
+			if m := cellMagicRE.FindSubmatch(cell.source); m != nil {
+				if l := d.segmentLanguage(string(m[1])); l != "" {
+					language = l
+				}
+			}
+			if language == "" {
+				var err error
+				if language, err = d.detectSegment(ctx, cell.source); err != nil {
+					return nil, err
+				}
+			}
+			stats.Languages[language] += len(cell.source)
+		case "markdown":
+			stats.MarkdownCells++
+			stats.MarkdownBytes += len(cell.source)
+			stats.MarkdownLines += countLines(cell.source)
+		}
+	}
+	if stats.Language == "" {
+		// without a kernel in the metadata, the notebook is in the language of most of its code
+		for language, n := range stats.Languages {
+			if language != "" && (n > stats.Languages[stats.Language] || n == stats.Languages[stats.Language] && language < stats.Language) {
+				stats.Language = language
+			}
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,126 @@
+package linguist
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// notebook returns a notebook with the cells, which are pairs of cell types and sources, and an
+// image output of size bytes on the first code cell
+func notebook(t *testing.T, kernel string, image int, cells ...string) []byte {
+	var list []map[string]interface{}
+	for i := 0; i+1 < len(cells); i += 2 {
+		cell := map[string]interface{}{"cell_type": cells[i], "metadata": map[string]interface{}{}, "source": strings.SplitAfter(cells[i+1], "\n")}
+		if cells[i] == "code" {
+			var outputs []interface{}
+			if image > 0 {
+				outputs = append(outputs, map[string]interface{}{"output_type": "display_data", "data": map[string]string{"image/png": strings.Repeat("iVBORw0KGgo", image/11+1)}})
+				image = 0
+			}
+			cell["outputs"] = outputs
+			cell["execution_count"] = 1
+		}
+		list = append(list, cell)
+	}
+	meta := map[string]interface{}{}
+	if kernel != "" {
+		meta["kernelspec"] = map[string]string{"name": kernel, "language": kernel, "display_name": kernel}
+		meta["language_info"] = map[string]string{"name": kernel}
+	}
+	body, err := json.MarshalIndent(map[string]interface{}{"cells": list, "metadata": meta, "nbformat": 4, "nbformat_minor": 5}, "", " ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+const (
+	notebookMarkdown = "# Analysis\nLoad the data.\n"
+	notebookCode     = "import pandas as pd\ndf = pd.read_csv('data.csv')\nprint(df.head())"
+	notebookBash     = "%%bash\nls -la\n"
+)
+
+func TestNotebookStats(t *testing.T) {
+	assert := assert.New(t)
+	body := notebook(t, "python", MaxBufferSize*2, "markdown", notebookMarkdown, "code", notebookCode, "code", notebookBash, "raw", "raw text")
+	assert.True(len(body) > MaxBufferSize)
+	for _, skip := range []bool{false, true} {
+		r, err := GetLanguageDetails(context.Background(), "analysis.ipynb", body, skip)
+		assert.NoError(err)
+		// outputs don't make a notebook large
+		assert.False(r.IsLarge)
+		assert.False(r.IsExcluded)
+		assert.Equal("Jupyter Notebook", r.Result.Language.Name)
+		nb := r.Result.Notebook
+		if assert.NotNil(nb) {
+			assert.Equal("Python", nb.Language)
+			assert.Equal(2, nb.CodeCells)
+			assert.Equal(len(notebookCode)+len(notebookBash), nb.CodeBytes)
+			assert.Equal(5, nb.CodeLines)
+			assert.Equal(1, nb.MarkdownCells)
+			assert.Equal(len(notebookMarkdown), nb.MarkdownBytes)
+			assert.Equal(2, nb.MarkdownLines)
+			assert.Equal(map[string]int{"Python": len(notebookCode), "Shell": len(notebookBash)}, nb.Languages)
+		}
+	}
+	r, err := GetLanguageDetails(context.Background(), "data.json", body)
+	assert.NoError(err)
+	assert.True(r.IsLarge)
+}
+
+func TestNotebookWithoutKernel(t *testing.T) {
+	assert := assert.New(t)
+	body := notebook(t, "", 0, "code", "#!/usr/bin/env ruby\nputs 1\n")
+	r, err := GetLanguageDetails(context.Background(), "ruby.ipynb", body)
+	assert.NoError(err)
+	assert.Equal("Ruby", r.Result.Notebook.Language)
+
+	// a notebook which isn't valid has no stats
+	r, err = GetLanguageDetails(context.Background(), "broken.ipynb", []byte("{\"cells\": [\n"))
+	assert.NoError(err)
+	assert.Nil(r.Result.Notebook)
+}
+
+func TestNotebookSegments(t *testing.T) {
+	assert := assert.New(t)
+	body := notebook(t, "python", 0, "markdown", notebookMarkdown, "code", notebookCode)
+	segments, err := NewDetector().Segments(context.Background(), "analysis.ipynb", body)
+	assert.NoError(err)
+	var embedded []Segment
+	for _, s := range segments {
+		if s.Embedded {
+			embedded = append(embedded, s)
+		}
+	}
+	if assert.Len(embedded, 2) {
+		assert.Equal("Markdown", embedded[0].Language)
+		assert.True(embedded[0].IsDocumentation)
+		assert.Equal("Python", embedded[1].Language)
+		assert.False(embedded[1].IsDocumentation)
+	}
+}
+
+func TestScanDirectoryNotebook(t *testing.T) {
+	assert := assert.New(t)
+	body := notebook(t, "python", MaxBufferSize*2, "markdown", notebookMarkdown, "code", notebookCode, "code", notebookBash)
+	dir := writeTree(t, map[string]string{"analysis.ipynb": string(body)})
+	defer os.RemoveAll(dir)
+	stats, err := ScanDirectory(context.Background(), dir, nil)
+	assert.NoError(err)
+	assert.Equal(0, stats.Excluded())
+	nb := stats.Language("Jupyter Notebook")
+	assert.Equal(1, nb.Files)
+	assert.Equal(int64(len(notebookCode)+len(notebookBash)), nb.Bytes)
+
+	stats, err = NewDetector(WithSegmentation()).ScanDirectory(context.Background(), dir, nil)
+	assert.NoError(err)
+	assert.Equal(int64(0), stats.Language("Jupyter Notebook").Bytes)
+	assert.Equal(int64(len(notebookCode)), stats.Language("Python").EmbeddedBytes)
+	assert.Equal(int64(len(notebookBash)), stats.Language("Shell").EmbeddedBytes)
+	assert.Nil(stats.Language("Markdown"))
+}
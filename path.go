@@ -0,0 +1,39 @@
+package linguist
+
+import (
+	"path"
+	"strings"
+)
+
+// NormalizePath returns filename in the form which the rules of the package are matched against:
+// separated with forward slashes, without . and .. elements where possible and without a leading
+// ./, so that src\app\main.go and ./src/app/../app/main.go are both src/app/main.go.
+//
+// Paths should be relative to the root of the repository, because rules such as ^dist/ are
+// anchored to it. Absolute paths are kept as they are and only match the rules which aren't
+// anchored, such as (^|/)node_modules/, unless the detector is given their root with WithRoot.
+func NormalizePath(filename string) string {
+	if filename == "" {
+		return ""
+	}
+	p := path.Clean(strings.Replace(filename, `\`, "/", -1))
+	if p == "." {
+		return ""
+	}
+	return p
+}
+
+// relativePath returns filename normalized and relative to root if it's under it
+func relativePath(root, filename string) string {
+	p := NormalizePath(filename)
+	if root == "" {
+		return p
+	}
+	if root == "/" {
+		return strings.TrimPrefix(p, "/")
+	}
+	if rel := strings.TrimPrefix(p, root+"/"); rel != p {
+		return rel
+	}
+	return p
+}
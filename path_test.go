@@ -0,0 +1,105 @@
+package linguist
+
+import (
+	"context"
+	"testing"
+
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizePath(t *testing.T) {
+	assert := assert.New(t)
+	for in, out := range map[string]string{
+		"":                      "",
+		".":                     "",
+		"main.go":               "main.go",
+		`src\app\main.go`:       "src/app/main.go",
+		"./src/app/../app/x.go": "src/app/x.go",
+		`.\src\main.go`:         "src/main.go",
+		"src//main.go":          "src/main.go",
+		"dist/":                 "dist",
+		`C:\repo\x.go`:          "C:/repo/x.go",
+		"/home/u/repo/x.go":     "/home/u/repo/x.go",
+	} {
+		assert.Equal(out, NormalizePath(in), in)
+	}
+}
+
+func TestRelativePath(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("dist/app.js", relativePath("/home/u/repo", "/home/u/repo/dist/app.js"))
+	assert.Equal("dist/app.js", relativePath("C:/repo", `C:\repo\dist\app.js`))
+	assert.Equal("/home/u/other/app.js", relativePath("/home/u/repo", "/home/u/other/app.js"))
+	assert.Equal("/home/u/repository/app.js", relativePath("/home/u/repo", "/home/u/repository/app.js"))
+	assert.Equal("home/u/app.js", relativePath("/", "/home/u/app.js"))
+	assert.Equal("src/app.js", relativePath("", `src\app.js`))
+}
+
+func TestFilenamesOfNestedPaths(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("Makefile", generaltso.BaseName("build/Makefile"))
+	assert.Equal("Dockerfile", generaltso.BaseName(`docker\Dockerfile`))
+	assert.Equal("Makefile", generaltso.BaseName("Makefile"))
+	assert.Equal([]string{"Makefile"}, generaltso.LanguagesByFilename("build/Makefile"))
+	assert.Equal([]string{"Dockerfile"}, generaltso.LanguagesByFilename(`docker\Dockerfile`))
+	assert.Equal("Makefile", generaltso.LanguageByFilename("a/b/c/Makefile"))
+	assert.Equal("Go", generaltso.LanguageByFilename(`src\main.go`))
+}
+
+func TestDetectNestedAndWindowsPaths(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	d := NewDetector()
+	for _, tc := range []struct {
+		filename, path, language, strategy string
+	}{
+		{"build/Makefile", "build/Makefile", "Makefile", "filename"},
+		{"docker/Dockerfile", "docker/Dockerfile", "Dockerfile", "filename"},
+		{`docker\Dockerfile`, "docker/Dockerfile", "Dockerfile", "filename"},
+		{`.\src\main.go`, "src/main.go", "Go", "extension"},
+	} {
+		r, err := d.GetLanguageDetails(ctx, tc.filename, []byte("all:\n\techo\n"), true)
+		assert.NoError(err)
+		if assert.NotNil(r.Result, tc.filename) && assert.NotNil(r.Result.Language, tc.filename) {
+			assert.Equal(tc.language, r.Result.Language.Name, tc.filename)
+			assert.Equal(tc.strategy, r.Result.Strategy, tc.filename)
+			assert.Equal(tc.path, r.Result.Path, tc.filename)
+		}
+	}
+}
+
+func TestExclusionOfWindowsPaths(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(IsExcluded(`.vscode\settings.json`, nil))
+	assert.True(IsExcluded(".vscode/settings.json", nil))
+	assert.True(IsVendored(`web\node_modules\x.js`))
+	assert.True(IsVendored("./a/../node_modules/x.js"))
+	r, err := NewDetector().GetLanguageDetails(context.Background(), `web\node_modules\x.js`, []byte("var x = 1;\n"), true)
+	assert.NoError(err)
+	assert.True(r.IsExcluded)
+}
+
+func TestWithRoot(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	filename := "/home/u/repo/.github/workflows/ci.yml"
+	body := []byte("on: push\n")
+	// anchored rules don't match absolute paths without a root
+	r, err := NewDetector().GetLanguageDetails(ctx, filename, body, true)
+	assert.NoError(err)
+	assert.False(r.IsExcluded)
+	r, err = NewDetector(WithRoot("/home/u/repo")).GetLanguageDetails(ctx, filename, body, true)
+	assert.NoError(err)
+	assert.True(r.IsExcluded)
+	r, err = NewDetector(WithRoot(`C:\repo\`)).GetLanguageDetails(ctx, `C:\repo\.vscode\settings.json`, []byte("{}\n"), true)
+	assert.NoError(err)
+	assert.True(r.IsExcluded)
+	// paths outside the root are kept as they are
+	r, err = NewDetector(WithRoot("/home/u/repo")).GetLanguageDetails(ctx, "/srv/.github/workflows/ci.yml", body, true)
+	assert.NoError(err)
+	assert.False(r.IsExcluded)
+	if assert.NotNil(r.Result) {
+		assert.Equal("/srv/.github/workflows/ci.yml", r.Result.Path)
+	}
+}
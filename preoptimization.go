@@ -0,0 +1,431 @@
+package linguist
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+	"gopkg.in/yaml.v1"
+)
+
+// PreoptimizationRule maps matching files straight to a language without running the detection
+// pipeline. Exactly one of Extension, Filename or Pattern must be set.
+type PreoptimizationRule struct {
+	// Extension matches the extension of the file, such as .go
+	Extension string `json:"extension,omitempty" yaml:"extension,omitempty"`
+	// Filename matches the base name of the file, such as Makefile
+	Filename string `json:"filename,omitempty" yaml:"filename,omitempty"`
+	// Pattern is a regular expression matched against the whole path of the file
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	// Language is the name or an alias of a language in languages.yml
+	Language string `json:"language" yaml:"language"`
+}
+
+func (r PreoptimizationRule) String() string {
+	switch {
+	case r.Extension != "":
+		return fmt.Sprintf("extension %s -> %s", r.Extension, r.Language)
+	case r.Filename != "":
+		return fmt.Sprintf("filename %s -> %s", r.Filename, r.Language)
+	}
+	return fmt.Sprintf("pattern %s -> %s", r.Pattern, r.Language)
+}
+
+type preoptimization struct {
+	Rule      PreoptimizationRule
+	Language  Language
+	CacheHits int32
+	re        *regexp.Regexp
+}
+
+type preoptimizationTable struct {
+	extensions map[string]*preoptimization
+	filenames  map[string]*preoptimization
+	patterns   []*preoptimization
+}
+
+var (
+	preoptimizations = newPreoptimizationTable()
+	preoptimizeOnce  sync.Once
+	// preoptimizationHits is used to resort the patterns every 100 hits
+	preoptimizationHits int32
+)
+
+func newPreoptimizationTable() *preoptimizationTable {
+	return &preoptimizationTable{
+		extensions: make(map[string]*preoptimization),
+		filenames:  make(map[string]*preoptimization),
+	}
+}
+
+// registryLanguage returns the details of a language from the languages.yml of data
+func registryLanguage(data *generaltso.Data, name string) *Language {
+	l, _ := data.Language(name)
+	return &Language{
+		Name:    name,
+		Type:    l.Type,
+		Group:   l.Group,
+		AceMode: l.AceMode,
+	}
+}
+
+func compilePreoptimization(rule PreoptimizationRule) (*preoptimization, error) {
+	var set int
+	for _, s := range []string{rule.Extension, rule.Filename, rule.Pattern} {
+		if s != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("preoptimization %s must have exactly one of extension, filename or pattern", rule)
+	}
+	name := generaltso.LanguageByAlias(rule.Language)
+	if name == "" {
+		return nil, fmt.Errorf("preoptimization %s has an unknown language", rule)
+	}
+	p := &preoptimization{Rule: rule, Language: *registryLanguage(generaltso.CurrentData(), name)}
+	if rule.Pattern != "" {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("preoptimization %s: %v", rule, err)
+		}
+		p.re = re
+	}
+	return p, nil
+}
+
+func (t *preoptimizationTable) add(p *preoptimization) {
+	switch {
+	case p.Rule.Extension != "":
+		t.extensions[p.Rule.Extension] = p
+	case p.Rule.Filename != "":
+		t.filenames[p.Rule.Filename] = p
+	default:
+		for i, e := range t.patterns {
+			if e.Rule.Pattern == p.Rule.Pattern {
+				t.patterns[i] = p
+				return
+			}
+		}
+		t.patterns = append(t.patterns, p)
+	}
+}
+
+func (t *preoptimizationTable) remove(rule PreoptimizationRule) bool {
+	switch {
+	case rule.Extension != "":
+		_, ok := t.extensions[rule.Extension]
+		delete(t.extensions, rule.Extension)
+		return ok
+	case rule.Filename != "":
+		_, ok := t.filenames[rule.Filename]
+		delete(t.filenames, rule.Filename)
+		return ok
+	}
+	for i, p := range t.patterns {
+		if p.Rule.Pattern == rule.Pattern {
+			t.patterns = append(t.patterns[:i], t.patterns[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *preoptimizationTable) lookup(filename string) *preoptimization {
+	base := filepath.Base(filename)
+	if p := t.filenames[base]; p != nil {
+		return p
+	}
+	// the longest extension which the table or languages.yml knows decides, so that a rule
+	// for .php doesn't match index.blade.php if it's a different language
+	data := generaltso.CurrentData()
+	if ext := generaltso.MatchExtension(base, func(ext string) bool {
+		return t.extensions[ext] != nil || len(data.ExtensionLanguages(ext)) > 0
+	}); ext != "" {
+		if p := t.extensions[ext]; p != nil {
+			return p
+		}
+	}
+	for _, p := range t.patterns {
+		if p.re.MatchString(filename) {
+			return p
+		}
+	}
+	return nil
+}
+
+func (t *preoptimizationTable) each(fn func(p *preoptimization)) {
+	for _, p := range t.filenames {
+		fn(p)
+	}
+	for _, p := range t.extensions {
+		fn(p)
+	}
+	for _, p := range t.patterns {
+		fn(p)
+	}
+}
+
+// DefaultPreoptimizationRules returns a rule for every filename and extension in languages.yml
+// which belongs to exactly one language and has no heuristics
+func DefaultPreoptimizationRules() []PreoptimizationRule {
+	rules := make([]PreoptimizationRule, 0)
+	for filename, language := range generaltso.UnambiguousFilenames() {
+		rules = append(rules, PreoptimizationRule{Filename: filename, Language: language})
+	}
+	for ext, language := range generaltso.UnambiguousExtensions() {
+		if heuristics[ext] != nil {
+			// the heuristics know better than the extension
+			continue
+		}
+		rules = append(rules, PreoptimizationRule{Extension: ext, Language: language})
+	}
+	sortPreoptimizationRules(rules)
+	return rules
+}
+
+func sortPreoptimizationRules(rules []PreoptimizationRule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		a, b := rules[i], rules[j]
+		if a.Filename != b.Filename {
+			return a.Filename > b.Filename
+		}
+		if a.Extension != b.Extension {
+			return a.Extension < b.Extension
+		}
+		return false
+	})
+}
+
+// PreoptimizationRules returns the rules in the preoptimization table. Patterns come last, in the order they are checked.
+func PreoptimizationRules() []PreoptimizationRule {
+	preoptimizeInit()
+	rules := make([]PreoptimizationRule, 0)
+	mutex.RLock()
+	for _, p := range preoptimizations.filenames {
+		rules = append(rules, p.Rule)
+	}
+	for _, p := range preoptimizations.extensions {
+		rules = append(rules, p.Rule)
+	}
+	sortPreoptimizationRules(rules)
+	for _, p := range preoptimizations.patterns {
+		rules = append(rules, p.Rule)
+	}
+	mutex.RUnlock()
+	return rules
+}
+
+// SetPreoptimizationRules replaces the preoptimization table with rules. Nothing is changed if any rule is invalid.
+func SetPreoptimizationRules(rules []PreoptimizationRule) error {
+	preoptimizeInit()
+	table := newPreoptimizationTable()
+	for _, rule := range rules {
+		p, err := compilePreoptimization(rule)
+		if err != nil {
+			return err
+		}
+		table.add(p)
+	}
+	mutex.Lock()
+	preoptimizations = table
+	mutex.Unlock()
+	atomic.AddInt64(&rulesetGeneration, 1)
+	return nil
+}
+
+// AddPreoptimizationRule adds rule to the preoptimization table, replacing any rule for the same extension, filename or pattern
+func AddPreoptimizationRule(rule PreoptimizationRule) error {
+	preoptimizeInit()
+	p, err := compilePreoptimization(rule)
+	if err != nil {
+		return err
+	}
+	mutex.Lock()
+	preoptimizations.add(p)
+	mutex.Unlock()
+	atomic.AddInt64(&rulesetGeneration, 1)
+	return nil
+}
+
+// RemovePreoptimizationRule removes the rule for the same extension, filename or pattern as rule and returns true if there was one
+func RemovePreoptimizationRule(rule PreoptimizationRule) bool {
+	preoptimizeInit()
+	mutex.Lock()
+	ok := preoptimizations.remove(rule)
+	mutex.Unlock()
+	if ok {
+		atomic.AddInt64(&rulesetGeneration, 1)
+	}
+	return ok
+}
+
+// ReadPreoptimizationRules reads a list of rules as YAML or JSON. An empty list is an error.
+func ReadPreoptimizationRules(r io.Reader) ([]PreoptimizationRule, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]PreoptimizationRule, 0)
+	if err := yaml.Unmarshal(buf, &rules); err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("no preoptimization rules found")
+	}
+	return rules, nil
+}
+
+// LoadPreoptimizationRules replaces the preoptimization table with the rules in a YAML or JSON file
+func LoadPreoptimizationRules(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rules, err := ReadPreoptimizationRules(f)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", filename, err)
+	}
+	return SetPreoptimizationRules(rules)
+}
+
+// Initialize will warm up the preoptimization cache. It is safe to call more than once,
+// and the cache is also initialized by the first detection.
+func Initialize() {
+	preoptimizeInit()
+}
+
+// initialize the pre-optimization cache with the extensions and filenames which
+// belong to exactly one language to speed up calculating predictable language results
+func preoptimizeInit() {
+	preoptimizeOnce.Do(func() {
+		table := defaultPreoptimizationTable()
+		mutex.Lock()
+		preoptimizations = table
+		mutex.Unlock()
+	})
+}
+
+// defaultPreoptimizationTable returns a table of the DefaultPreoptimizationRules
+func defaultPreoptimizationTable() *preoptimizationTable {
+	table := newPreoptimizationTable()
+	for _, rule := range DefaultPreoptimizationRules() {
+		if p, err := compilePreoptimization(rule); err == nil {
+			table.add(p)
+		}
+	}
+	return table
+}
+
+// resort moves the most popular patterns to the front so that they are checked first
+func resort() {
+	mutex.Lock()
+	patterns := preoptimizations.patterns
+	sort.Slice(patterns, func(i, j int) bool {
+		return atomic.LoadInt32(&patterns[j].CacheHits) < atomic.LoadInt32(&patterns[i].CacheHits)
+	})
+	mutex.Unlock()
+}
+
+func preoptimizationCounterReset() {
+	atomic.StoreInt32(&preoptimizationHits, 0)
+	resort()
+}
+
+// mostPopularPreoptimization returns the detection of the preoptimization with the most hits
+func mostPopularPreoptimization() Detection {
+	var popular *preoptimization
+	mutex.RLock()
+	preoptimizations.each(func(p *preoptimization) {
+		hits := atomic.LoadInt32(&p.CacheHits)
+		if hits > 0 && (popular == nil || hits > atomic.LoadInt32(&popular.CacheHits) ||
+			(hits == atomic.LoadInt32(&popular.CacheHits) && p.Language.Name < popular.Language.Name)) {
+			popular = p
+		}
+	})
+	mutex.RUnlock()
+	if popular == nil {
+		return Detection{}
+	}
+	l := popular.Language
+	return Detection{Type: "text", Language: &l}
+}
+
+// CheckPreoptimizationCache will return a potential Result for a filename match based on the preoptimization cache.
+// If a body is passed, the result is only returned for a body which is neither empty, binary nor large, and
+// IsGenerated is checked against the body. Files which don't match a rule return a Result without Success so
+// that they go through the detection pipeline. Vendored files are handled with the policy of the default detector.
+func CheckPreoptimizationCache(filename string, body ...[]byte) Result {
+	var buf []byte
+	if len(body) > 0 {
+		buf = body[0]
+	}
+	filename = NormalizePath(filename)
+	preoptimizeInit()
+	ex, r := IsExcluded(filename, buf)
+	vendored := IsVendored(filename)
+	if !ex && vendored && defaultDetector.VendoredPolicy() == VendoredExclude {
+		ex, r = true, vendoredResult
+	}
+	if ex {
+		if preoptimizationMatch(filename) != nil {
+			return *r
+		}
+		return noResult
+	}
+	return checkPreoptimization(filename, buf, vendored)
+}
+
+// checkPreoptimization returns the Result of the rule matching a file which isn't excluded, or a Result
+// without Success. The caller has already checked the exclusions and whether the file is vendored.
+func checkPreoptimization(filename string, buf []byte, vendored bool) Result {
+	preoptimizeInit()
+	if buf != nil && len(bytes.TrimSpace(buf)) == 0 {
+		// there's nothing to go on for an empty file, so leave it to the pipeline
+		return noResult
+	}
+	p := preoptimizationMatch(filename)
+	if p == nil {
+		return noResult
+	}
+	atomic.AddInt32(&p.CacheHits, 1)
+	// make a copy so that the result can't be mutated
+	l := p.Language
+	if o := languageOverride(l.Name, filename); o != "" {
+		l = *registryLanguage(generaltso.CurrentData(), o)
+	}
+	generated := IsGenerated(filename, buf)
+	documentation := IsDocumentation(filename)
+	return Result{
+		Success:    true,
+		IsCached:   true,
+		IsVendored: vendored,
+		IsExcluded: generated || (documentation && isDocumentationExcluded()),
+		Result: &Detection{
+			Path:            filename,
+			Type:            "text",
+			Language:        &l,
+			Strategy:        PreoptimizationStrategyName,
+			IsGenerated:     generated,
+			IsVendored:      vendored,
+			IsDocumentation: documentation,
+			IsTest:          IsTest(filename, l.Name, buf),
+		},
+	}
+}
+
+func preoptimizationMatch(filename string) *preoptimization {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return preoptimizations.lookup(filename)
+}
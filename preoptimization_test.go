@@ -0,0 +1,190 @@
+package linguist
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// restorePreoptimizations puts the default rules back after a test changes them
+func restorePreoptimizations(t *testing.T) {
+	if err := SetPreoptimizationRules(DefaultPreoptimizationRules()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefaultPreoptimizationRules(t *testing.T) {
+	assert := assert.New(t)
+	rules := DefaultPreoptimizationRules()
+	assert.NotEmpty(rules)
+	var goExt bool
+	for _, r := range rules {
+		switch r.Extension {
+		case ".go":
+			goExt = true
+			assert.Equal("Go", r.Language)
+		case ".h", ".m", ".pl":
+			t.Fatalf("ambiguous extension %s shouldn't be preoptimized", r.Extension)
+		}
+	}
+	assert.True(goExt)
+	assert.Equal(rules, PreoptimizationRules())
+}
+
+func TestPreoptimizationResultFromRegistry(t *testing.T) {
+	assert := assert.New(t)
+	r := CheckPreoptimizationCache("main.go")
+	assert.True(r.Success)
+	assert.True(r.IsCached)
+	assert.Equal(PreoptimizationStrategyName, r.Result.Strategy)
+	assert.Equal("Go", r.Result.Language.Name)
+	assert.Equal("programming", r.Result.Language.Type)
+	assert.Equal("golang", r.Result.Language.AceMode)
+	// results are copies which can't change the table
+	r.Result.Language.Name = "C"
+	assert.Equal("Go", CheckPreoptimizationCache("main.go").Result.Language.Name)
+	assert.False(CheckPreoptimizationCache("foo.h").Success)
+}
+
+func TestPreoptimizationRuleAPI(t *testing.T) {
+	assert := assert.New(t)
+	defer restorePreoptimizations(t)
+	assert.False(CheckPreoptimizationCache("foo.h").Success)
+	assert.NoError(AddPreoptimizationRule(PreoptimizationRule{Extension: ".h", Language: "c"}))
+	r := CheckPreoptimizationCache("foo.h")
+	assert.True(r.Success)
+	assert.Equal("C", r.Result.Language.Name)
+	assert.True(RemovePreoptimizationRule(PreoptimizationRule{Extension: ".h"}))
+	assert.False(RemovePreoptimizationRule(PreoptimizationRule{Extension: ".h"}))
+	assert.False(CheckPreoptimizationCache("foo.h").Success)
+
+	assert.NoError(AddPreoptimizationRule(PreoptimizationRule{Pattern: `^include/.*\.h$`, Language: "C++"}))
+	assert.Equal("C++", CheckPreoptimizationCache("include/foo.h").Result.Language.Name)
+	assert.False(CheckPreoptimizationCache("src/foo.h").Success)
+
+	assert.Error(AddPreoptimizationRule(PreoptimizationRule{Extension: ".h", Language: "NotALanguage"}))
+	assert.Error(AddPreoptimizationRule(PreoptimizationRule{Extension: ".h", Filename: "foo.h", Language: "C"}))
+	assert.Error(AddPreoptimizationRule(PreoptimizationRule{Language: "C"}))
+	assert.Error(AddPreoptimizationRule(PreoptimizationRule{Pattern: "(", Language: "C"}))
+
+	assert.NoError(SetPreoptimizationRules([]PreoptimizationRule{{Filename: "Makefile", Language: "Makefile"}}))
+	assert.Len(PreoptimizationRules(), 1)
+	assert.True(CheckPreoptimizationCache("src/Makefile").Success)
+	assert.False(CheckPreoptimizationCache("main.go").Success)
+	// an invalid rule leaves the table unchanged
+	assert.Error(SetPreoptimizationRules([]PreoptimizationRule{{Extension: ".go", Language: "Go"}, {Extension: ".x"}}))
+	assert.Len(PreoptimizationRules(), 1)
+}
+
+func TestPreoptimizationRulesInvalidateCache(t *testing.T) {
+	assert := assert.New(t)
+	defer restorePreoptimizations(t)
+	d := NewDetector(WithCache(NewMemoryCache(100)))
+	r, err := d.GetLanguageDetails(context.Background(), "foo.h", []byte("int x;\n"))
+	assert.NoError(err)
+	assert.NotEqual(PreoptimizationStrategyName, r.Result.Strategy)
+	assert.NoError(AddPreoptimizationRule(PreoptimizationRule{Extension: ".h", Language: "Objective-C"}))
+	r, err = d.GetLanguageDetails(context.Background(), "foo.h", []byte("int x;\n"))
+	assert.NoError(err)
+	assert.Equal(PreoptimizationStrategyName, r.Result.Strategy)
+	assert.Equal("Objective-C", r.Result.Language.Name)
+}
+
+func TestLoadPreoptimizationRules(t *testing.T) {
+	assert := assert.New(t)
+	defer restorePreoptimizations(t)
+	rules, err := ReadPreoptimizationRules(strings.NewReader(`[{"extension": ".h", "language": "C"}, {"filename": "BUILD", "language": "Python"}]`))
+	assert.NoError(err)
+	assert.Equal([]PreoptimizationRule{{Extension: ".h", Language: "C"}, {Filename: "BUILD", Language: "Python"}}, rules)
+
+	dir, err := ioutil.TempDir("", "preoptimization")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "rules.yml")
+	assert.NoError(ioutil.WriteFile(fn, []byte("- extension: .h\n  language: C\n- pattern: ^docs/\n  language: Markdown\n"), 0644))
+	assert.NoError(LoadPreoptimizationRules(fn))
+	assert.Len(PreoptimizationRules(), 2)
+	assert.Equal("Markdown", CheckPreoptimizationCache("docs/README").Result.Language.Name)
+
+	assert.NoError(ioutil.WriteFile(fn, []byte("- extension: .h\n  language: Nope\n"), 0644))
+	assert.Error(LoadPreoptimizationRules(fn))
+	assert.Len(PreoptimizationRules(), 2)
+	assert.Error(LoadPreoptimizationRules(filepath.Join(dir, "missing.yml")))
+
+	// an empty list is an error whether it's read or loaded
+	_, err = ReadPreoptimizationRules(strings.NewReader("[]"))
+	assert.Error(err)
+	assert.NoError(ioutil.WriteFile(fn, []byte("[]\n"), 0644))
+	err = LoadPreoptimizationRules(fn)
+	assert.Error(err)
+	assert.Contains(err.Error(), fn)
+	assert.Len(PreoptimizationRules(), 2)
+}
+
+func TestPreoptimizationConcurrent(t *testing.T) {
+	defer restorePreoptimizations(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				CheckPreoptimizationCache("main.go")
+				mostPopularPreoptimization()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				AddPreoptimizationRule(PreoptimizationRule{Pattern: `\.inc$`, Language: "PHP"})
+				RemovePreoptimizationRule(PreoptimizationRule{Pattern: `\.inc$`})
+				resort()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPreoptimizationChecksBody(t *testing.T) {
+	assert := assert.New(t)
+	r := CheckPreoptimizationCache("main.go", []byte("package main\n"))
+	assert.True(r.Success)
+	assert.False(r.IsExcluded)
+	assert.False(r.IsLarge)
+	assert.Equal("Go", r.Result.Language.Name)
+
+	// empty files go through the pipeline
+	assert.False(CheckPreoptimizationCache("empty.js", []byte{}).Success)
+	assert.False(CheckPreoptimizationCache("empty.js", []byte("\n  \n")).Success)
+
+	r = CheckPreoptimizationCache("main.go", make([]byte, MaxBufferSize+1))
+	assert.True(r.Success)
+	assert.Nil(r.Result)
+	assert.True(r.IsExcluded)
+
+	r = CheckPreoptimizationCache("main.go", []byte("// Code generated by stringer. DO NOT EDIT.\n\npackage main\n"))
+	assert.True(r.Success)
+	assert.True(r.IsExcluded)
+	assert.True(r.Result.IsGenerated)
+	assert.Equal("Go", r.Result.Language.Name)
+}
+
+func TestPreoptimizationAmbiguousExtensions(t *testing.T) {
+	assert := assert.New(t)
+	for _, name := range []string{"app_en.ts", "foo.m", "foo.h", "foo.cs"} {
+		assert.False(CheckPreoptimizationCache(name, []byte("x\n")).Success, name)
+	}
+	r, err := GetLanguageDetails(context.Background(), "app_en.ts", []byte("<?xml version=\"1.0\"?>\n<TS version=\"2.1\">\n</TS>\n"))
+	assert.NoError(err)
+	assert.Equal("XML", r.Result.Language.Name)
+	assert.NotEqual(PreoptimizationStrategyName, r.Result.Strategy)
+	r, err = GetLanguageDetails(context.Background(), "app.ts", []byte("let x: number = 1;\n"))
+	assert.NoError(err)
+	assert.Equal("TypeScript", r.Result.Language.Name)
+}
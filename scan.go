@@ -0,0 +1,262 @@
+package linguist
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// LanguageStats are the totals of a language in Stats
+type LanguageStats struct {
+	Language string `json:"language"`
+	// Files is the number of files detected as the language
+	Files int `json:"files"`
+	// Bytes are the bytes of the language, including the segments embedded in files of other languages
+	Bytes int64 `json:"bytes"`
+	// EmbeddedBytes are the bytes of segments of the language embedded in files of other languages
+	EmbeddedBytes int64 `json:"embedded_bytes,omitempty"`
+	// TestFiles and TestBytes are the files and bytes of the language which are tests, see IsTest
+	TestFiles int   `json:"test_files,omitempty"`
+	TestBytes int64 `json:"test_bytes,omitempty"`
+}
+
+// Stats are the totals of the detections of many files, such as a directory. It's safe for concurrent use.
+type Stats struct {
+	mu        sync.Mutex
+	files     int
+	bytes     int64
+	excluded  int
+	unknown   int
+	languages map[string]*LanguageStats
+	// the tests among the detected files, and the bytes attributed to languages of tests and other files
+	testFiles    int
+	testBytes    int64
+	nonTestBytes int64
+	// documentation which isn't excluded, see SetExcludeDocumentation
+	documentationFiles int
+	documentationBytes int64
+}
+
+// NewStats returns empty Stats
+func NewStats() *Stats {
+	return &Stats{languages: make(map[string]*LanguageStats)}
+}
+
+func (s *Stats) language(name string) *LanguageStats {
+	l := s.languages[name]
+	if l == nil {
+		l = &LanguageStats{Language: name}
+		s.languages[name] = l
+	}
+	return l
+}
+
+// Add counts the result of the detection of a file of size bytes. The bytes of a file with
+// Segments are attributed to the language of each segment, and segments whose language wasn't
+// detected count as the language of the file. Only the source of the code cells of a notebook
+// counts, attributed to the languages of the cells if it has Segments. Documentation which
+// isn't excluded with SetExcludeDocumentation counts towards its language like any other file,
+// and also towards the total of Documentation.
+func (s *Stats) Add(size int64, r Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files++
+	s.bytes += size
+	if !r.IsExcluded && r.Result != nil && r.Result.IsDocumentation {
+		s.documentationFiles++
+		s.documentationBytes += size
+	}
+	switch {
+	case r.IsExcluded:
+		s.excluded++
+		return
+	case r.Result == nil || r.Result.Language == nil || r.Result.Language.Name == "":
+		s.unknown++
+		return
+	}
+	name := r.Result.Language.Name
+	test := r.Result.IsTest
+	l := s.language(name)
+	l.Files++
+	if test {
+		l.TestFiles++
+		s.testFiles++
+	}
+	attribute := func(language string, n int64, embedded bool) {
+		e := l
+		if embedded && language != "" && language != name {
+			e = s.language(language)
+			e.EmbeddedBytes += n
+		}
+		e.Bytes += n
+		if test {
+			e.TestBytes += n
+			s.testBytes += n
+		} else {
+			s.nonTestBytes += n
+		}
+	}
+	if nb := r.Result.Notebook; nb != nil {
+		// only the source of the code cells of a notebook counts
+		if len(r.Result.Segments) == 0 {
+			attribute(name, int64(nb.CodeBytes), false)
+			return
+		}
+		for language, n := range nb.Languages {
+			attribute(language, int64(n), true)
+		}
+		return
+	}
+	if len(r.Result.Segments) == 0 {
+		attribute(name, size, false)
+		return
+	}
+	for _, seg := range r.Result.Segments {
+		attribute(seg.Language, int64(seg.End-seg.Start), seg.Embedded)
+	}
+}
+
+// Files returns the number of files counted
+func (s *Stats) Files() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.files
+}
+
+// Bytes returns the size of all the files counted
+func (s *Stats) Bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bytes
+}
+
+// Excluded returns the number of excluded files
+func (s *Stats) Excluded() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.excluded
+}
+
+// Unknown returns the number of files whose language wasn't detected
+func (s *Stats) Unknown() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unknown
+}
+
+// Tests returns the number of detected files which are tests and their bytes, see IsTest
+func (s *Stats) Tests() (files int, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.testFiles, s.testBytes
+}
+
+// NonTests returns the number of detected files which aren't tests and their bytes
+func (s *Stats) NonTests() (files int, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.files - s.excluded - s.unknown - s.testFiles, s.nonTestBytes
+}
+
+// Documentation returns the number of documentation files which weren't excluded and their bytes, see IsDocumentation.
+// They are also counted in the totals of their languages.
+func (s *Stats) Documentation() (files int, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.documentationFiles, s.documentationBytes
+}
+
+// Language returns the totals of a language, or nil if it wasn't found
+func (s *Stats) Language(name string) *LanguageStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l := s.languages[name]; l != nil {
+		c := *l
+		return &c
+	}
+	return nil
+}
+
+// Languages returns the totals of each language with the most bytes first
+func (s *Stats) Languages() []LanguageStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	languages := make([]LanguageStats, 0, len(s.languages))
+	for _, l := range s.languages {
+		languages = append(languages, *l)
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		if languages[i].Bytes != languages[j].Bytes {
+			return languages[i].Bytes > languages[j].Bytes
+		}
+		return languages[i].Language < languages[j].Language
+	})
+	return languages
+}
+
+// ScanDirectory detects the language of every file under dir and returns the totals. Paths are
+// passed to the detector relative to dir with forward slashes, and .git directories are skipped.
+// fn, if not nil, is called with the result of each file.
+func (d *Detector) ScanDirectory(ctx context.Context, dir string, fn func(path string, size int64, r Result) error) (*Stats, error) {
+	stats := NewStats()
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return canceled(err, name)
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		body, err := readHead(name)
+		if err != nil {
+			return err
+		}
+		r, err := d.GetLanguageDetails(ctx, rel, body)
+		if err != nil {
+			return err
+		}
+		stats.Add(info.Size(), r)
+		if fn != nil {
+			return fn(rel, info.Size(), r)
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// ScanDirectory detects the language of every file under dir with the default detector
+func ScanDirectory(ctx context.Context, dir string, fn func(path string, size int64, r Result) error) (*Stats, error) {
+	return defaultDetector.ScanDirectory(ctx, dir, fn)
+}
+
+// readHead reads enough of a file to detect it and to decide if it's large
+func readHead(filename string) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(f, readLimit(filename)))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", filename, err)
+	}
+	return body, nil
+}
@@ -0,0 +1,86 @@
+package linguist
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTree writes files to a temporary directory and returns it
+func writeTree(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range files {
+		fn := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fn, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const scanHTML = "<html>\n<script>\nconsole.log(1);\n</script>\n</html>\n"
+
+func TestScanDirectory(t *testing.T) {
+	assert := assert.New(t)
+	dir := writeTree(t, map[string]string{
+		"main.go":              "package main\n",
+		"web/index.html":       scanHTML,
+		"node_modules/x/a.js":  "module.exports = 1;\n",
+		".git/config":          "[core]\n",
+		"docs/image.png":       "\x89PNG\r\n\x1a\n\x00\x00",
+		"src/lib/util/util.go": "package util\n",
+	})
+	defer os.RemoveAll(dir)
+	var paths []string
+	stats, err := NewDetector().ScanDirectory(context.Background(), dir, func(path string, size int64, r Result) error {
+		paths = append(paths, path)
+		return nil
+	})
+	assert.NoError(err)
+	assert.ElementsMatch([]string{"main.go", "web/index.html", "node_modules/x/a.js", "docs/image.png", "src/lib/util/util.go"}, paths)
+	assert.Equal(5, stats.Files())
+	assert.Equal(2, stats.Excluded())
+	golang := stats.Language("Go")
+	assert.Equal(2, golang.Files)
+	assert.Equal(int64(len("package main\n")+len("package util\n")), golang.Bytes)
+	html := stats.Language("HTML")
+	assert.Equal(int64(len(scanHTML)), html.Bytes)
+	assert.Nil(stats.Language("JavaScript"))
+	assert.Equal("HTML", stats.Languages()[0].Language)
+}
+
+func TestScanDirectorySegments(t *testing.T) {
+	assert := assert.New(t)
+	dir := writeTree(t, map[string]string{"index.html": scanHTML, "app.js": "console.log(2);\n"})
+	defer os.RemoveAll(dir)
+	stats, err := NewDetector(WithSegmentation()).ScanDirectory(context.Background(), dir, nil)
+	assert.NoError(err)
+	js := stats.Language("JavaScript")
+	embedded := int64(len("\nconsole.log(1);\n"))
+	assert.Equal(1, js.Files)
+	assert.Equal(embedded, js.EmbeddedBytes)
+	assert.Equal(int64(len("console.log(2);\n"))+embedded, js.Bytes)
+	html := stats.Language("HTML")
+	assert.Equal(1, html.Files)
+	assert.Equal(int64(len(scanHTML))-embedded, html.Bytes)
+	assert.Equal(stats.Bytes(), js.Bytes+html.Bytes)
+}
+
+func TestScanDirectoryCanceled(t *testing.T) {
+	dir := writeTree(t, map[string]string{"main.go": "package main\n"})
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := ScanDirectory(ctx, dir, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,438 @@
+package linguist
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+)
+
+// Segment is a region of a file in a single language, such as a <script> block of an HTML file or
+// a fenced code block of a Markdown file. The segments of a file cover all of its bytes.
+type Segment struct {
+	// Language is empty if the language of an embedded region couldn't be detected
+	Language string `json:"language"`
+	// Start and End are the byte offsets of the segment, End is exclusive
+	Start int `json:"start"`
+	End   int `json:"end"`
+	// StartLine and EndLine are the 1-based lines of the first and last byte of the segment
+	StartLine int `json:"start_line"`
+	EndLine   int `json:"end_line"`
+	// Hint is the fence info string or attribute which named the language, if there was one
+	Hint string `json:"hint,omitempty"`
+	// Embedded is false for the segments in the language of the file itself
+	Embedded bool `json:"embedded"`
+	// IsDocumentation is true for segments of documentation, such as the markdown cells of a notebook
+	IsDocumentation bool `json:"is_documentation,omitempty"`
+}
+
+// region is an embedded region found by a segmenter. language is used if the hint doesn't name one.
+type region struct {
+	start, end int
+	hint       string
+	language   string
+	// body is the text of the region if it differs from the bytes of the file, such as a JSON string
+	body []byte
+	// documentation is true for regions which are documentation, such as the markdown cells of notebooks
+	documentation bool
+}
+
+// segmenter splits the body of a file of a host language into embedded regions, in order
+type segmenter struct {
+	// host is the language of the bytes between the regions, or the file's language if empty
+	host  string
+	split func(d *Detector, body []byte) []region
+}
+
+var (
+	segmentersByLanguage = map[string]*segmenter{
+		"HTML":             {split: splitHTML},
+		"Vue":              {host: "HTML", split: splitVue},
+		"Markdown":         {split: splitMarkdown},
+		"HTML+ERB":         {host: "HTML", split: splitTemplate("Ruby")},
+		"EJS":              {host: "HTML", split: splitTemplate("JavaScript")},
+		"Jupyter Notebook": {split: splitNotebook},
+	}
+	// segmentersByExtension are used for files whose language isn't in the language registry
+	segmentersByExtension = map[string]*segmenter{
+		".svelte": {host: "HTML", split: splitHTML},
+		".ipynb":  segmentersByLanguage["Jupyter Notebook"],
+	}
+)
+
+// IsSegmentable returns true if files of the language or with the filename's extension can be split into segments
+func IsSegmentable(filename, language string) bool {
+	return findSegmenter(filename, language) != nil
+}
+
+func findSegmenter(filename, language string) *segmenter {
+	if s := segmentersByLanguage[language]; s != nil {
+		return s
+	}
+	return segmentersByExtension[generaltso.MatchExtension(filename, func(ext string) bool { return segmentersByExtension[ext] != nil })]
+}
+
+var (
+	htmlBlockRE = regexp.MustCompile(`(?i)<(script|style)\b([^>]*)>`)
+	vueBlockRE  = regexp.MustCompile(`(?i)<(script|style|template)\b([^>]*)>`)
+	attributeRE = regexp.MustCompile(`([\w:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// attributes returns the attributes of a tag by lower case name
+func attributes(tag []byte) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range attributeRE.FindAllSubmatch(tag, -1) {
+		attrs[strings.ToLower(string(m[1]))] = string(m[2]) + string(m[3]) + string(m[4])
+	}
+	return attrs
+}
+
+// closingTag returns the offset of the tag closing an element of name opened before from, or -1.
+// Elements of the same name nested inside are skipped. Tag names are compared at each < rather
+// than lowering the rest of the body for each element.
+func closingTag(body []byte, name string, from int) (int, int) {
+	tag := []byte(name)
+	depth := 0
+	for i := from; i < len(body); i++ {
+		j := bytes.IndexByte(body[i:], '<')
+		if j < 0 {
+			return -1, -1
+		}
+		i += j
+		start := i + 1
+		closing := start < len(body) && body[start] == '/'
+		if closing {
+			start++
+		}
+		if start+len(tag) > len(body) || !bytes.EqualFold(body[start:start+len(tag)], tag) {
+			continue
+		}
+		if !closing {
+			depth++
+			continue
+		}
+		end := bytes.IndexByte(body[start:], '>')
+		if end < 0 {
+			return -1, -1
+		}
+		if depth == 0 {
+			return i, start + end + 1
+		}
+		depth--
+		i = start + end
+	}
+	return -1, -1
+}
+
+func splitBlocks(body []byte, re *regexp.Regexp) []region {
+	var regions []region
+	for pos := 0; pos < len(body); {
+		m := re.FindSubmatchIndex(body[pos:])
+		if m == nil {
+			break
+		}
+		name := strings.ToLower(string(body[pos+m[2] : pos+m[3]]))
+		attrs := attributes(body[pos+m[4] : pos+m[5]])
+		start := pos + m[1]
+		end, next := closingTag(body, name, start)
+		if end < 0 {
+			break
+		}
+		pos = next
+		r := region{start: start, end: end}
+		switch name {
+		case "script":
+			r.language = "JavaScript"
+			r.hint = attrs["lang"]
+			if r.hint == "" {
+				r.hint = attrs["type"]
+			}
+		case "style":
+			r.language = "CSS"
+			r.hint = attrs["lang"]
+		case "template":
+			// a template without a lang is the HTML of the host
+			if r.hint = attrs["lang"]; r.hint == "" {
+				continue
+			}
+		}
+		regions = append(regions, r)
+	}
+	return regions
+}
+
+// splitHTML finds the <script> and <style> blocks of HTML and Svelte files
+func splitHTML(d *Detector, body []byte) []region {
+	return splitBlocks(body, htmlBlockRE)
+}
+
+// splitVue finds the top level blocks of a Vue single file component
+func splitVue(d *Detector, body []byte) []region {
+	return splitBlocks(body, vueBlockRE)
+}
+
+var fenceRE = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})[ \t]*([^\n]*)$")
+
+// splitMarkdown finds the contents of fenced code blocks. An unclosed fence runs to the end of the file.
+func splitMarkdown(d *Detector, body []byte) []region {
+	var regions []region
+	var fence []byte
+	var current region
+	for pos := 0; pos < len(body); {
+		end := bytes.IndexByte(body[pos:], '\n')
+		next := len(body)
+		if end >= 0 {
+			next = pos + end + 1
+			end = pos + end
+		} else {
+			end = len(body)
+		}
+		line := bytes.TrimRight(body[pos:end], "\r")
+		if fence == nil {
+			if m := fenceRE.FindSubmatch(line); m != nil && !(m[1][0] == '`' && bytes.IndexByte(m[2], '`') >= 0) {
+				fence = m[1]
+				current = region{start: next, hint: fenceInfo(string(m[2]))}
+			}
+		} else if t := bytes.TrimSpace(line); len(t) >= len(fence) && t[0] == fence[0] && len(bytes.Trim(t, string(fence[:1]))) == 0 && len(line)-len(bytes.TrimLeft(line, " ")) <= 3 {
+			current.end = pos
+			regions = append(regions, current)
+			fence = nil
+		}
+		pos = next
+	}
+	if fence != nil {
+		current.end = len(body)
+		regions = append(regions, current)
+	}
+	return regions
+}
+
+// fenceInfo returns the language of a fence info string such as "python title=x" or "{.python}"
+func fenceInfo(info string) string {
+	info = strings.TrimSpace(info)
+	if strings.HasPrefix(info, "{") {
+		info = strings.Trim(info, "{}")
+	}
+	if f := strings.Fields(info); len(f) > 0 {
+		return strings.TrimPrefix(strings.Trim(f[0], ","), ".")
+	}
+	return ""
+}
+
+// splitTemplate returns a segmenter for <% %> templates whose code is in language. Comments
+// (<%# %>) and escaped delimiters (<%%) are left to the host.
+func splitTemplate(language string) func(d *Detector, body []byte) []region {
+	return func(d *Detector, body []byte) []region {
+		var regions []region
+		for pos := 0; pos < len(body); {
+			i := bytes.Index(body[pos:], []byte("<%"))
+			if i < 0 {
+				break
+			}
+			start := pos + i + 2
+			j := bytes.Index(body[start:], []byte("%>"))
+			if j < 0 {
+				break
+			}
+			end := start + j
+			pos = end + 2
+			if start < len(body) && (body[start] == '#' || body[start] == '%') {
+				continue
+			}
+			if start < end && (body[start] == '=' || body[start] == '-' || body[start] == '_') {
+				start++
+			}
+			if end > start && (body[end-1] == '-' || body[end-1] == '_') {
+				end--
+			}
+			regions = append(regions, region{start: start, end: end, language: language})
+		}
+		return regions
+	}
+}
+
+// mimeLanguages are the languages of the type attributes of script blocks
+var mimeLanguages = map[string]string{
+	"javascript": "JavaScript",
+	"ecmascript": "JavaScript",
+	"module":     "JavaScript",
+	"babel":      "JavaScript",
+	"jsx":        "JavaScript",
+	"json":       "JSON",
+	"ld+json":    "JSON",
+	"importmap":  "JSON",
+	"template":   "HTML",
+	"html":       "HTML",
+}
+
+// segmentLanguage returns the language named by a hint, which can be a language name or alias,
+// an extension or a MIME type such as text/typescript, in the detector's data. It returns an empty
+// string if there isn't one.
+func (d *Detector) segmentLanguage(hint string) string {
+	hint = strings.ToLower(strings.TrimSpace(hint))
+	if hint == "" {
+		return ""
+	}
+	if i := strings.LastIndexByte(hint, '/'); i >= 0 {
+		hint = strings.TrimPrefix(hint[i+1:], "x-")
+		if l := mimeLanguages[hint]; l != "" {
+			return l
+		}
+	}
+	data := d.Data()
+	if l := data.LanguageByAlias(hint); l != "" {
+		return l
+	}
+	if l := data.LanguageByAlias(strings.Replace(hint, " ", "-", -1)); l != "" {
+		return l
+	}
+	if languages := data.LanguagesByExtension("file." + hint); len(languages) == 1 {
+		return languages[0]
+	}
+	return ""
+}
+
+// detectSegment detects the language of the body of a region without a language using the strategies
+// of the pipeline which don't need a filename
+func (d *Detector) detectSegment(ctx context.Context, body []byte) (string, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return "", nil
+	}
+	if err := lockGeneraltso(ctx); err != nil {
+		return "", err
+	}
+	defer unlockGeneraltso()
+	language, _, err := d.detect(ctx, &Blob{Body: body, detector: d})
+	return language, err
+}
+
+// segmentFile splits the body of a file of language into segments, or returns nil if it can't be split
+func (d *Detector) segmentFile(ctx context.Context, filename, language string, body []byte) ([]Segment, error) {
+	s := findSegmenter(filename, language)
+	if s == nil {
+		return nil, nil
+	}
+	host := s.host
+	if host == "" {
+		host = language
+	}
+	lines := newLineIndex(body)
+	var segments []Segment
+	add := func(seg Segment) {
+		if seg.Start >= seg.End {
+			return
+		}
+		seg.StartLine, seg.EndLine = lines.line(seg.Start), lines.line(seg.End-1)
+		// merge the segments of the host which are only split by regions without any bytes
+		if n := len(segments); n > 0 && !seg.Embedded && !segments[n-1].Embedded && segments[n-1].End == seg.Start {
+			segments[n-1].End, segments[n-1].EndLine = seg.End, seg.EndLine
+			return
+		}
+		segments = append(segments, seg)
+	}
+	pos := 0
+	for _, r := range s.split(d, body) {
+		if r.start < pos || r.end > len(body) || r.start > r.end {
+			continue
+		}
+		add(Segment{Language: host, Start: pos, End: r.start})
+		language := d.segmentLanguage(r.hint)
+		if language == "" {
+			language = r.language
+		}
+		if language == "" {
+			content := r.body
+			if content == nil {
+				content = body[r.start:r.end]
+			}
+			var err error
+			if language, err = d.detectSegment(ctx, content); err != nil {
+				return nil, err
+			}
+		}
+		add(Segment{Language: language, Start: r.start, End: r.end, Hint: r.hint, Embedded: true, IsDocumentation: r.documentation})
+		pos = r.end
+	}
+	add(Segment{Language: host, Start: pos, End: len(body)})
+	return segments, nil
+}
+
+// lineIndex maps byte offsets to line numbers
+type lineIndex []int
+
+func newLineIndex(body []byte) lineIndex {
+	index := lineIndex{0}
+	for i, b := range body {
+		if b == '\n' {
+			index = append(index, i+1)
+		}
+	}
+	return index
+}
+
+// line returns the 1-based line of the byte at offset
+func (l lineIndex) line(offset int) int {
+	lo, hi := 0, len(l)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if l[mid] <= offset {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// annotate sets the notebook stats of a detection of a notebook and the segments of a detection
+// if the detector splits files into segments
+func (d *Detector) annotate(ctx context.Context, filename string, body []byte, result *Result) error {
+	if result.IsExcluded || result.Result == nil || result.Result.Language == nil {
+		return nil
+	}
+	language := result.Result.Language.Name
+	if language == "Jupyter Notebook" || IsNotebook(filename) {
+		nb, err := d.notebookStats(ctx, body)
+		if err != nil {
+			return canceled(err, filename)
+		}
+		result.Result.Notebook = nb
+	}
+	if !d.Segmentation() {
+		return nil
+	}
+	segments, err := d.segmentFile(ctx, filename, language, body)
+	if err != nil {
+		return canceled(err, filename)
+	}
+	result.Result.Segments = segments
+	return nil
+}
+
+// Segments detects the language of a file and splits it into the languages embedded in it, such as
+// the <script> and <style> blocks of HTML, the blocks of Vue and Svelte components, fenced code in
+// Markdown, the code of ERB and EJS templates and the cells of Jupyter notebooks. Fence info strings,
+// lang attributes and the type of script blocks name the language of a segment, and segments without
+// one are detected from their contents. It returns nil for files which can't be split.
+func (d *Detector) Segments(ctx context.Context, filename string, body []byte) ([]Segment, error) {
+	filename = d.normalize(filename)
+	r, err := d.GetLanguageDetails(ctx, filename, body)
+	if err != nil || r.IsExcluded || r.Result == nil || r.Result.Language == nil {
+		return nil, err
+	}
+	if r.Result.Segments != nil {
+		return r.Result.Segments, nil
+	}
+	segments, err := d.segmentFile(ctx, filename, r.Result.Language.Name, body)
+	if err != nil {
+		return nil, canceled(err, filename)
+	}
+	return segments, nil
+}
+
+// Segments splits a file into the languages embedded in it using the default detector
+func Segments(ctx context.Context, filename string, body []byte) ([]Segment, error) {
+	return defaultDetector.Segments(ctx, filename, body)
+}
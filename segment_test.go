@@ -0,0 +1,248 @@
+package linguist
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// segmentText returns the text and language of each embedded segment
+func segmentText(body string, segments []Segment) [][2]string {
+	var result [][2]string
+	for _, s := range segments {
+		if s.Embedded {
+			result = append(result, [2]string{s.Language, strings.TrimSpace(body[s.Start:s.End])})
+		}
+	}
+	return result
+}
+
+// assertCovers checks that the segments cover the whole body in order
+func assertCovers(t *testing.T, body string, segments []Segment) {
+	pos := 0
+	for _, s := range segments {
+		assert.Equal(t, pos, s.Start)
+		assert.True(t, s.End > s.Start)
+		assert.True(t, s.StartLine <= s.EndLine)
+		pos = s.End
+	}
+	assert.Equal(t, len(body), pos)
+}
+
+func TestSegmentHTML(t *testing.T) {
+	assert := assert.New(t)
+	body := `<!DOCTYPE html>
+<html>
+<head>
+<style>
+body { color: red; }
+</style>
+<script type="application/ld+json">{"@type": "Person"}</script>
+<script src="app.js"></script>
+<script type="text/typescript">
+let x: number = 1;
+</script>
+</head>
+<body><script>console.log("hi");</script></body>
+</html>
+`
+	segments, err := NewDetector().segmentFile(context.Background(), "index.html", "HTML", []byte(body))
+	assert.NoError(err)
+	assertCovers(t, body, segments)
+	assert.Equal([][2]string{
+		{"CSS", "body { color: red; }"},
+		{"JSON", `{"@type": "Person"}`},
+		{"TypeScript", "let x: number = 1;"},
+		{"JavaScript", `console.log("hi");`},
+	}, segmentText(body, segments))
+	assert.Equal("HTML", segments[0].Language)
+	assert.False(segments[0].Embedded)
+	css := segments[1]
+	assert.Equal(4, css.StartLine)
+	assert.Equal(5, css.EndLine)
+	assert.Equal("text/typescript", segments[5].Hint)
+}
+
+func TestSegmentVue(t *testing.T) {
+	assert := assert.New(t)
+	body := `<template lang="pug">
+div
+  template(v-if="ok") p hi
+</template>
+
+<script lang="ts">
+export default { name: "hello" } as const
+</script>
+
+<style lang="scss" scoped>
+$c: red;
+.a { color: $c; }
+</style>
+`
+	segments, err := NewDetector().segmentFile(context.Background(), "Hello.vue", "Vue", []byte(body))
+	assert.NoError(err)
+	assertCovers(t, body, segments)
+	langs := segmentText(body, segments)
+	assert.Equal("Pug", langs[0][0])
+	assert.Equal("TypeScript", langs[1][0])
+	assert.Equal("SCSS", langs[2][0])
+	assert.Equal("HTML", segments[0].Language)
+
+	// a template without lang is the HTML of the component, even with nested templates
+	body = "<template>\n<div><template v-if=\"ok\">x</template></div>\n</template>\n<script>\nexport default {}\n</script>\n"
+	segments, err = NewDetector().segmentFile(context.Background(), "Hello.vue", "Vue", []byte(body))
+	assert.NoError(err)
+	assert.Equal([][2]string{{"JavaScript", "export default {}"}}, segmentText(body, segments))
+}
+
+func TestSegmentSvelte(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(IsSegmentable("App.svelte", ""))
+	body := "<script lang=\"ts\">\nlet n: number = 0;\n</script>\n<button on:click={() => n++}>{n}</button>\n"
+	segments, err := NewDetector().segmentFile(context.Background(), "App.svelte", "", []byte(body))
+	assert.NoError(err)
+	assertCovers(t, body, segments)
+	assert.Equal([][2]string{{"TypeScript", "let n: number = 0;"}}, segmentText(body, segments))
+}
+
+func TestSegmentMarkdown(t *testing.T) {
+	assert := assert.New(t)
+	body := "# Title\n\n```go\npackage main\n```\n\ntext\n\n~~~ {.python}\nprint('hi')\n~~~\n\n````\n```\nnested fence\n```\n````\n\n```ruby title=\"x.rb\"\nputs 1\n"
+	segments, err := NewDetector().segmentFile(context.Background(), "README.md", "Markdown", []byte(body))
+	assert.NoError(err)
+	assertCovers(t, body, segments)
+	embedded := segmentText(body, segments)
+	assert.Len(embedded, 4)
+	assert.Equal([2]string{"Go", "package main"}, embedded[0])
+	assert.Equal([2]string{"Python", "print('hi')"}, embedded[1])
+	assert.Equal("```\nnested fence\n```", embedded[2][1])
+	// an unclosed fence runs to the end of the file
+	assert.Equal([2]string{"Ruby", "puts 1"}, embedded[3])
+	assert.Equal("go", segments[1].Hint)
+	assert.Equal(4, segments[1].StartLine)
+	assert.Equal(4, segments[1].EndLine)
+}
+
+func TestSegmentTemplates(t *testing.T) {
+	assert := assert.New(t)
+	body := "<ul>\n<% items.each do |i| -%>\n<li><%= i.name %></li>\n<%# a comment %>\n<% end %>\n</ul>\n"
+	segments, err := NewDetector().segmentFile(context.Background(), "index.html.erb", "HTML+ERB", []byte(body))
+	assert.NoError(err)
+	assertCovers(t, body, segments)
+	assert.Equal([][2]string{{"Ruby", "items.each do |i|"}, {"Ruby", "i.name"}, {"Ruby", "end"}}, segmentText(body, segments))
+	assert.Equal("HTML", segments[0].Language)
+
+	body = "<% if (user) { %><h2><%= user.name %></h2><% } %>"
+	segments, err = NewDetector().segmentFile(context.Background(), "user.ejs", "EJS", []byte(body))
+	assert.NoError(err)
+	assert.Equal([][2]string{{"JavaScript", "if (user) {"}, {"JavaScript", "user.name"}, {"JavaScript", "}"}}, segmentText(body, segments))
+}
+
+func TestSegmentNotebook(t *testing.T) {
+	assert := assert.New(t)
+	body := `{
+ "cells": [
+  {"cell_type": "markdown", "metadata": {}, "source": ["# Analysis\n", "Some text"]},
+  {"cell_type": "code", "execution_count": 1, "metadata": {}, "outputs": [{"output_type": "stream", "text": ["hi\n"]}], "source": ["import pandas as pd\n", "print('hi')"]},
+  {"cell_type": "code", "execution_count": 2, "metadata": {}, "outputs": [], "source": "%%bash\nls -la"}
+ ],
+ "metadata": {"kernelspec": {"display_name": "Python 3", "language": "python", "name": "python3"}, "language_info": {"name": "python"}},
+ "nbformat": 4,
+ "nbformat_minor": 5
+}
+`
+	segments, err := NewDetector().segmentFile(context.Background(), "analysis.ipynb", "Jupyter Notebook", []byte(body))
+	assert.NoError(err)
+	assertCovers(t, body, segments)
+	embedded := segmentText(body, segments)
+	assert.Equal([][2]string{
+		{"Markdown", `["# Analysis\n", "Some text"]`},
+		{"Python", `["import pandas as pd\n", "print('hi')"]`},
+		{"Shell", `"%%bash\nls -la"`},
+	}, embedded)
+
+	segments, err = NewDetector().segmentFile(context.Background(), "broken.ipynb", "Jupyter Notebook", []byte("{not json"))
+	assert.NoError(err)
+	assert.Len(segments, 1)
+	assert.False(segments[0].Embedded)
+}
+
+func TestSegmentDetectsUnlabelledBlocks(t *testing.T) {
+	assert := assert.New(t)
+	body := "Run it:\n\n```\n#!/usr/bin/env python3\nprint('hi')\n```\n\n```notalanguage\n#!/bin/bash\necho hi\n```\n"
+	segments, err := NewDetector().segmentFile(context.Background(), "README.md", "Markdown", []byte(body))
+	assert.NoError(err)
+	embedded := segmentText(body, segments)
+	assert.Equal("Python", embedded[0][0])
+	assert.Equal("Shell", embedded[1][0])
+}
+
+func TestClosingTag(t *testing.T) {
+	assert := assert.New(t)
+	body := []byte(`<SCRIPT>İ<script>a</script></Script ><p></scrip`)
+	end, next := closingTag(body, "script", len("<SCRIPT>"))
+	assert.Equal(len(body)-len(`</Script ><p></scrip`), end)
+	assert.Equal(len(body)-len(`<p></scrip`), next)
+	end, _ = closingTag(body, "style", 0)
+	assert.Equal(-1, end)
+	end, _ = closingTag(body, "p", len(body)-len(`</scrip`))
+	assert.Equal(-1, end)
+}
+
+func TestSegmentLanguage(t *testing.T) {
+	assert := assert.New(t)
+	d := NewDetector()
+	for hint, language := range map[string]string{
+		"go":                     "Go",
+		"Python":                 "Python",
+		"ts":                     "TypeScript",
+		"js":                     "JavaScript",
+		"scss":                   "SCSS",
+		"text/javascript":        "JavaScript",
+		"module":                 "",
+		"application/ld+json":    "JSON",
+		"text/x-template":        "HTML",
+		"text/coffeescript":      "CoffeeScript",
+		"":                       "",
+		"definitely-not-a-thing": "",
+	} {
+		assert.Equal(language, d.segmentLanguage(hint), hint)
+	}
+	// hints are looked up in the detector's data
+	data, err := ReadData(DataFiles{Languages: strings.NewReader(zigLanguages)}, DataMerge)
+	assert.NoError(err)
+	assert.Equal("", d.segmentLanguage("zig"))
+	assert.Equal("Zig", NewDetector(WithData(data)).segmentLanguage("zig"))
+	assert.Equal("Zig", NewDetector(WithData(data)).segmentLanguage("ziglang"))
+}
+
+func TestDetectorSegmentation(t *testing.T) {
+	assert := assert.New(t)
+	body := []byte("# Title\n\n```go\npackage main\n```\n")
+	d := NewDetector(WithCache(NewMemoryCache(100)))
+	r, err := d.GetLanguageDetails(context.Background(), "README.md", body)
+	assert.NoError(err)
+	assert.Nil(r.Result.Segments)
+	version := d.cacheVersion()
+
+	d.SetSegmentation(true)
+	assert.NotEqual(version, d.cacheVersion())
+	for _, skip := range []bool{false, false, true} {
+		r, err = d.GetLanguageDetails(context.Background(), "README.md", body, skip)
+		assert.NoError(err)
+		assert.Len(r.Result.Segments, 3)
+		assert.Equal("Go", r.Result.Segments[1].Language)
+	}
+	assert.True(r.Result.IsDocumentation)
+
+	// files which can't be split have no segments
+	r, err = d.GetLanguageDetails(context.Background(), "main.go", []byte("package main\n"))
+	assert.NoError(err)
+	assert.Nil(r.Result.Segments)
+
+	segments, err := Segments(context.Background(), "README.md", body)
+	assert.NoError(err)
+	assert.Len(segments, 3)
+}
@@ -0,0 +1,237 @@
+package linguist
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"time"
+
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+)
+
+// names of the built-in strategies
+const (
+	ModelineStrategyName        = "modeline"
+	FilenameStrategyName        = "filename"
+	ShebangStrategyName         = "shebang"
+	ExtensionStrategyName       = "extension"
+	XMLStrategyName             = "xml"
+	HeuristicsStrategyName      = "heuristics"
+	ClassifierStrategyName      = "classifier"
+	PreoptimizationStrategyName = "preoptimization"
+)
+
+// Blob is a file which is passed through the detection strategies
+type Blob struct {
+	Filename string
+	Body     []byte
+	detector *Detector
+}
+
+// Data returns the linguist data files which the blob is detected with, see WithData
+func (b *Blob) Data() *generaltso.Data {
+	if b.detector != nil {
+		return b.detector.Data()
+	}
+	return generaltso.CurrentData()
+}
+
+// Strategy is a single step of the language detection pipeline.
+//
+// Detect is given the candidate languages returned by the previous strategies
+// (empty if none have matched yet) and returns the languages it thinks the blob
+// could be. Returning exactly one language ends detection. Returning more than one
+// narrows the candidates for the strategies which follow and returning none
+// leaves the candidates unchanged.
+type Strategy interface {
+	Name() string
+	Detect(ctx context.Context, blob *Blob, candidates []string) []string
+}
+
+type strategyFunc struct {
+	name string
+	fn   func(ctx context.Context, blob *Blob, candidates []string) []string
+}
+
+func (s *strategyFunc) Name() string {
+	return s.name
+}
+
+func (s *strategyFunc) Detect(ctx context.Context, blob *Blob, candidates []string) []string {
+	return s.fn(ctx, blob, candidates)
+}
+
+// NewStrategy returns a Strategy with the name which calls fn
+func NewStrategy(name string, fn func(ctx context.Context, blob *Blob, candidates []string) []string) Strategy {
+	return &strategyFunc{name, fn}
+}
+
+var (
+	// ModelineStrategy detects the language from a Vim or Emacs modeline
+	ModelineStrategy = NewStrategy(ModelineStrategyName, detectModeline)
+	// FilenameStrategy detects the language from well-known filenames such as Makefile
+	FilenameStrategy = NewStrategy(FilenameStrategyName, detectFilename)
+	// ShebangStrategy detects the language from the interpreter in a #! line
+	ShebangStrategy = NewStrategy(ShebangStrategyName, detectShebang)
+	// ExtensionStrategy detects the language from the file extension
+	ExtensionStrategy = NewStrategy(ExtensionStrategyName, detectExtension)
+	// XMLStrategy detects XML files from their <?xml declaration when nothing else matched
+	XMLStrategy = NewStrategy(XMLStrategyName, detectXML)
+	// HeuristicsStrategy disambiguates between candidates using content rules for ambiguous extensions
+	HeuristicsStrategy = NewStrategy(HeuristicsStrategyName, detectHeuristics)
+	// ClassifierStrategy uses the Bayesian classifier trained on language samples
+	ClassifierStrategy = NewStrategy(ClassifierStrategyName, detectClassifier)
+)
+
+// DefaultStrategies returns the built-in detection pipeline in the order it's run
+func DefaultStrategies() []Strategy {
+	return []Strategy{
+		ModelineStrategy,
+		FilenameStrategy,
+		ShebangStrategy,
+		ExtensionStrategy,
+		XMLStrategy,
+		HeuristicsStrategy,
+		ClassifierStrategy,
+	}
+}
+
+// firstLanguage returns the first of the languages in alphabetical order
+func firstLanguage(languages []string) string {
+	first := languages[0]
+	for _, l := range languages[1:] {
+		if l < first {
+			first = l
+		}
+	}
+	return first
+}
+
+// intersect returns the languages which are also candidates, or all the languages if there are no candidates
+func intersect(candidates []string, languages []string) []string {
+	if len(candidates) == 0 {
+		return languages
+	}
+	result := make([]string, 0)
+	for _, l := range languages {
+		for _, c := range candidates {
+			if l == c {
+				result = append(result, l)
+				break
+			}
+		}
+	}
+	return result
+}
+
+var (
+	vimModelineRE   = regexp.MustCompile(`(?i)(?:vim?|ex):.*[\s:](?:ft|filetype|syntax)=([\w+#-]+)`)
+	emacsModelineRE = regexp.MustCompile(`(?i)-\*-(?:.*;)?\s*(?:mode:\s*)?([\w+#-]+)\s*(?:;.*)?-\*-`)
+)
+
+// modelines are only searched for in the first and last few lines of the file
+const modelineSearchLines = 5
+
+func detectModeline(ctx context.Context, blob *Blob, candidates []string) []string {
+	lines := bytes.Split(blob.Body, []byte("\n"))
+	if len(lines) > modelineSearchLines*2 {
+		lines = append(lines[:modelineSearchLines], lines[len(lines)-modelineSearchLines:]...)
+	}
+	for _, line := range lines {
+		for _, re := range []*regexp.Regexp{vimModelineRE, emacsModelineRE} {
+			if m := re.FindSubmatch(line); m != nil {
+				spanFromContext(ctx).SetAttribute("modeline", string(bytes.TrimSpace(line)))
+				if l := blob.Data().LanguageByAlias(string(m[1])); l != "" {
+					return []string{l}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func detectFilename(ctx context.Context, blob *Blob, candidates []string) []string {
+	return blob.Data().LanguagesByFilename(blob.Filename)
+}
+
+func detectShebang(ctx context.Context, blob *Blob, candidates []string) []string {
+	data := blob.Data()
+	shebang, ok := data.ParseShebang(blob.Body)
+	span := spanFromContext(ctx)
+	span.SetAttribute("interpreter", shebang.Interpreter)
+	if !ok {
+		return nil
+	}
+	if shebang.Version != "" {
+		span.SetAttribute("version", shebang.Version)
+	}
+	if shebang.Exec {
+		span.SetAttribute("exec", true)
+	}
+	// several languages of the interpreter narrow the candidates for the strategies which follow
+	return intersect(candidates, data.LanguagesByInterpreter(shebang.Interpreter))
+}
+
+func detectExtension(ctx context.Context, blob *Blob, candidates []string) []string {
+	return intersect(candidates, blob.Data().LanguagesByExtension(blob.Filename))
+}
+
+func detectXML(ctx context.Context, blob *Blob, candidates []string) []string {
+	if len(candidates) > 0 {
+		return nil
+	}
+	header := blob.Body
+	if len(header) > 512 {
+		header = header[:512]
+	}
+	if bytes.Contains(header, []byte("<?xml version=")) {
+		return []string{"XML"}
+	}
+	return nil
+}
+
+func detectClassifier(ctx context.Context, blob *Blob, candidates []string) []string {
+	if len(candidates) == 1 {
+		return candidates
+	}
+	m := metrics()
+	start := time.Now()
+	_, span := startSpan(ctx, SpanTokenize)
+	classifier := embeddedClassifier()
+	var tokens []string
+	var err error
+	if blob.detector != nil {
+		classifier = blob.detector.Classifier()
+		tokens, err = blob.detector.tokenizeContext(ctx, classifier, blob.Body)
+	} else {
+		tokens, err = classifier.tokenizeContext(ctx, blob.Body)
+	}
+	if span.IsRecording() {
+		span.SetAttribute("legacy", classifier.Legacy)
+		span.SetAttribute("count", len(tokens))
+		span.SetAttribute("tokens", tokens)
+	}
+	span.End()
+	m.Latency(StageTokenize, time.Since(start))
+	// don't score a partial document, the pipeline returns the error of ctx
+	if err != nil || ctx.Err() != nil {
+		return nil
+	}
+	start = time.Now()
+	_, span = startSpan(ctx, SpanClassify)
+	l := generaltso.AnalyseTokens(classifier.Classifier, tokens, candidates)
+	if span.IsRecording() {
+		scores := generaltso.Scores(classifier.Classifier, tokens)
+		if len(scores) > traceScores {
+			scores = scores[:traceScores]
+		}
+		span.SetAttribute("scores", scores)
+		span.SetAttribute("language", l)
+	}
+	span.End()
+	m.Latency(StageClassify, time.Since(start))
+	if l != "" {
+		return []string{l}
+	}
+	return nil
+}
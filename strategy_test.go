@@ -0,0 +1,294 @@
+package linguist
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+	"github.com/stretchr/testify/assert"
+)
+
+func detectWith(t *testing.T, d *Detector, filename string, body string) *Detection {
+	r, err := d.GetLanguageDetails(context.Background(), filename, []byte(body), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Result == nil {
+		t.Fatalf("expected a result for %s but was nil", filename)
+	}
+	return r.Result
+}
+
+func TestStrategyPipeline(t *testing.T) {
+	assert := assert.New(t)
+	d := NewDetector()
+	var expected = []struct {
+		filename string
+		body     string
+		language string
+		strategy string
+	}{
+		{"Makefile", "all:\n\techo hi\n", "Makefile", FilenameStrategyName},
+		{"foo.rs", "fn main() {}\n", "Rust", HeuristicsStrategyName},
+		{"foo.go", "package foo\n", "Go", ExtensionStrategyName},
+		{"script", "#!/usr/bin/env ruby\nputs 1\n", "Ruby", ShebangStrategyName},
+		{"foo.txt", "# vim: set ft=python:\nprint(1)\n", "Python", ModelineStrategyName},
+		{"foo", "# -*- mode: ruby -*-\nputs 1\n", "Ruby", ModelineStrategyName},
+		{"foo.h", "@interface Foo\n@end\n", "Objective-C", HeuristicsStrategyName},
+		{"foo.h", "#include <stdio.h>\nint a;\n", "C", HeuristicsStrategyName},
+		{"foo.ts", "<?xml version=\"1.0\"?>\n<TS version=\"2.1\"></TS>\n", "XML", HeuristicsStrategyName},
+		{"foo.ts", "interface Foo {\n}\n", "TypeScript", HeuristicsStrategyName},
+		{"foo.unknown", "<?xml version=\"1.0\"?>\n<foo/>\n", "XML", XMLStrategyName},
+		{"foo.foogo", "package test\nvar a string\n", "Go", ClassifierStrategyName},
+	}
+	for _, e := range expected {
+		r := detectWith(t, d, e.filename, e.body)
+		assert.Equal(e.language, r.Language.Name, e.filename)
+		assert.Equal(e.strategy, r.Strategy, e.filename)
+	}
+}
+
+func TestCustomStrategy(t *testing.T) {
+	assert := assert.New(t)
+	dsl := NewStrategy("dsl", func(ctx context.Context, blob *Blob, candidates []string) []string {
+		if len(blob.Body) > 4 && string(blob.Body[:5]) == "@dsl\n" {
+			return []string{"MyDSL"}
+		}
+		return nil
+	})
+	d := NewDetector()
+	d.AddStrategy(dsl, ExtensionStrategyName)
+	names := make([]string, 0)
+	for _, s := range d.Strategies() {
+		names = append(names, s.Name())
+	}
+	assert.Equal([]string{"modeline", "filename", "shebang", "dsl", "extension", "xml", "heuristics", "classifier"}, names)
+	r := detectWith(t, d, "foo.js", "@dsl\nfoo bar\n")
+	assert.Equal("MyDSL", r.Language.Name)
+	assert.Equal("dsl", r.Strategy)
+	r = detectWith(t, d, "foo.js", "var a = 1\n")
+	assert.Equal("JavaScript", r.Language.Name)
+	d.RemoveStrategy("dsl")
+	assert.Len(d.Strategies(), len(DefaultStrategies()))
+}
+
+func TestCustomStrategyWithPreoptimization(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	dsl := NewStrategy("dsl", func(ctx context.Context, blob *Blob, candidates []string) []string {
+		if strings.HasPrefix(string(blob.Body), "@dsl\n") {
+			return []string{"MyDSL"}
+		}
+		return nil
+	})
+	AddStrategy(dsl, ExtensionStrategyName)
+	// .js is in the preoptimization table, which doesn't know about the strategy
+	r, err := GetLanguageDetails(ctx, "foo.js", []byte("@dsl\nfoo bar\n"))
+	RemoveStrategy("dsl")
+	assert.NoError(err)
+	if assert.NotNil(r.Result) {
+		assert.Equal("MyDSL", r.Result.Language.Name)
+		assert.Equal("dsl", r.Result.Strategy)
+	}
+	r, err = GetLanguageDetails(ctx, "foo.js", []byte("@dsl\nfoo bar\n"))
+	assert.NoError(err)
+	if assert.NotNil(r.Result) {
+		assert.Equal("JavaScript", r.Result.Language.Name)
+		assert.Equal(PreoptimizationStrategyName, r.Result.Strategy)
+	}
+	r, err = NewDetector(WithStrategies(FilenameStrategy)).GetLanguageDetails(ctx, "bar.js", []byte("var a = 1\n"))
+	assert.NoError(err)
+	if assert.NotNil(r.Result) {
+		assert.Equal("", r.Result.Language.Name)
+		assert.Equal("", r.Result.Strategy)
+	}
+}
+
+func TestWithStrategies(t *testing.T) {
+	assert := assert.New(t)
+	d := NewDetector(WithStrategies(ExtensionStrategy))
+	r := detectWith(t, d, "foo.h", "@interface Foo\n@end\n")
+	// without heuristics or the classifier the first candidate in alphabetical order is picked
+	assert.Equal(ExtensionStrategyName, r.Strategy)
+	assert.Equal("C", r.Language.Name)
+	reversed := NewStrategy("reversed", func(ctx context.Context, blob *Blob, candidates []string) []string {
+		return []string{"Objective-C", "C++", "C"}
+	})
+	r = detectWith(t, NewDetector(WithStrategies(reversed)), "foo.h", "@interface Foo\n@end\n")
+	assert.Equal("C", r.Language.Name)
+	assert.Equal("reversed", r.Strategy)
+	r = detectWith(t, d, "foo.nothing", "hello")
+	assert.Equal("", r.Language.Name)
+	assert.Equal("", r.Strategy)
+}
+
+func TestUnambiguousHints(t *testing.T) {
+	assert := assert.New(t)
+	body := []byte("package test\nvar a string\n")
+	// a single hint is returned without asking the classifier
+	assert.Equal("NotALanguage", generaltso.LanguageByContents(body, []string{"NotALanguage"}))
+	assert.Equal("NotALanguage", generaltso.Analyse(body, []string{"NotALanguage"}))
+	// hints without any training samples are never replaced with an empty string
+	assert.Equal("AlsoNotALanguage", generaltso.Analyse(body, []string{"NotALanguage", "AlsoNotALanguage"}))
+	assert.Equal("AlsoNotALanguage", generaltso.Analyse(body, []string{"AlsoNotALanguage", "NotALanguage"}))
+	assert.Equal("Go", generaltso.Analyse(body, []string{"NotALanguage", "Go"}))
+
+	r := detectWith(t, NewDetector(), "foo.go", "var a string")
+	assert.Equal("Go", r.Language.Name)
+	assert.Equal(ExtensionStrategyName, r.Strategy)
+	r = detectWith(t, NewDetector(), "Dockerfile", "FROM nodejs\n")
+	assert.Equal("Dockerfile", r.Language.Name)
+	assert.Equal(FilenameStrategyName, r.Strategy)
+}
+
+func TestParseShebang(t *testing.T) {
+	assert := assert.New(t)
+	var expected = []struct {
+		body        string
+		interpreter string
+		version     string
+		args        []string
+		exec        bool
+	}{
+		{"#!/usr/bin/ruby\n", "ruby", "", []string{}, false},
+		{"#! /usr/bin/env  ruby -w\r\n", "ruby", "", []string{"-w"}, false},
+		{"\xef\xbb\xbf#!/usr/bin/env node\n", "node", "", []string{}, false},
+		{"#!/usr/bin/env -S deno run --allow-net\n", "deno", "", []string{"run", "--allow-net"}, false},
+		{"#!/usr/bin/env -Sdeno run\n", "deno", "", []string{"run"}, false},
+		{"#!/usr/bin/env -i PYTHONPATH=lib python3 -u\n", "python", "3", []string{"-u"}, false},
+		{"#!/usr/bin/env -u HOME -- ruby\n", "ruby", "", []string{}, false},
+		{"#!/usr/local/bin/python3.12\n", "python", "3.12", []string{}, false},
+		{"#!/usr/bin/perl5.36 -w\n", "perl", "5.36", []string{"-w"}, false},
+		{"#!/usr/bin/env perl6\n", "perl6", "6", []string{}, false},
+		{"#!/bin/sh\n# \\\nexec tclsh \"$0\" ${1+\"$@\"}\n", "tclsh", "", nil, true},
+		{"#!/bin/sh\nexec /usr/bin/env ruby -x \"$0\" \"$@\"\n#!ruby\n", "ruby", "", nil, true},
+		// only an exec of a known interpreter with the script re-dispatches it
+		{"#!/bin/sh\nexec java -jar \"$0\" \"$@\"\n", "sh", "", []string{}, false},
+		{"#!/bin/bash\nexec ruby other.rb\n", "bash", "", []string{}, false},
+		{"#!/usr/bin/perl -w # caf\xe9\n", "perl", "", []string{"-w", "#", "caf\ufffd"}, false},
+	}
+	for _, e := range expected {
+		s, ok := generaltso.ParseShebang([]byte(e.body))
+		assert.True(ok, e.body)
+		assert.Equal(e.interpreter, s.Interpreter, e.body)
+		assert.Equal(e.version, s.Version, e.body)
+		assert.Equal(e.args, s.Args, e.body)
+		assert.Equal(e.exec, s.Exec, e.body)
+		assert.Equal(e.interpreter, generaltso.DetectInterpreter([]byte(e.body)), e.body)
+	}
+	for _, body := range []string{"", "puts 1\n#!/usr/bin/ruby\n", "#!\n", "#!/usr/bin/env -i FOO=1\n"} {
+		_, ok := generaltso.ParseShebang([]byte(body))
+		assert.False(ok, body)
+		assert.Equal("", generaltso.DetectInterpreter([]byte(body)), body)
+	}
+}
+
+func TestShebangStrategy(t *testing.T) {
+	assert := assert.New(t)
+	d := NewDetector()
+	for _, e := range [][2]string{
+		{"#!/usr/bin/env -S ruby -w\nputs 1\n", "Ruby"},
+		{"#!/usr/local/bin/python3.12\nprint(1)\n", "Python"},
+		{"#!/bin/sh\nexec ruby \"$0\" \"$@\"\nputs 1\n", "Ruby"},
+	} {
+		r := detectWith(t, d, "script", e[0])
+		assert.Equal(e[1], r.Language.Name, e[0])
+		assert.Equal(ShebangStrategyName, r.Strategy, e[0])
+	}
+	// the languages of an interpreter of several languages become the hints
+	assert.Len(generaltso.LanguagesByInterpreter("lua"), 2)
+	r := detectWith(t, d, "script", "#!/usr/bin/env lua\nlocal x = 1\nprint(x)\n")
+	assert.Contains(generaltso.LanguagesByInterpreter("lua"), r.Language.Name)
+	assert.Contains(generaltso.LanguagesByInterpreter("lua"), generaltso.LanguageByContents([]byte("#!/usr/bin/env lua\nprint(1)\n"), nil))
+	assert.Equal("Lua", generaltso.LanguageByContents([]byte("#!/usr/bin/env lua\nprint(1)\n"), []string{"Lua", "Ruby"}))
+}
+
+func benchmarkDetector(b *testing.B, d *Detector, filename string, body []byte) {
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.GetLanguageDetails(ctx, filename, body, true); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+var benchmarkGoBody = []byte("package test\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n")
+
+func BenchmarkUnambiguousExtension(b *testing.B) {
+	benchmarkDetector(b, NewDetector(), "foo.go", benchmarkGoBody)
+}
+
+func BenchmarkClassifierOnly(b *testing.B) {
+	benchmarkDetector(b, NewDetector(WithStrategies(ClassifierStrategy)), "foo.go", benchmarkGoBody)
+}
+
+func TestDetectCanceled(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := GetLanguageDetails(ctx, "main.go", []byte("package main\n"))
+	assert.True(errors.Is(err, context.Canceled))
+	assert.Contains(err.Error(), "main.go")
+}
+
+func TestDetectDeadlineLargeInput(t *testing.T) {
+	assert := assert.New(t)
+	// a strategy which takes longer than the deadline, such as a slow regex on a large file
+	slow := NewStrategy("slow", func(ctx context.Context, blob *Blob, candidates []string) []string {
+		<-ctx.Done()
+		return []string{"Go"}
+	})
+	d := NewDetector(WithStrategies(slow, ClassifierStrategy))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	body := []byte(strings.Repeat("x := y + z // some code\n", MaxBufferSize/25))
+	start := time.Now()
+	r, err := d.GetLanguageDetails(ctx, "big", body, true)
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	assert.Nil(r.Result)
+	assert.True(time.Since(start) < time.Second)
+
+	// a deadline which passes before detection starts
+	ctx, cancel = context.WithTimeout(context.Background(), time.Microsecond)
+	defer cancel()
+	_, err = NewDetector(WithStrategies(ClassifierStrategy)).GetLanguageDetails(ctx, "big", body, true)
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestDetectLockWaitDeadline(t *testing.T) {
+	assert := assert.New(t)
+	// hold the lock as a long detection in another goroutine would
+	assert.NoError(lockGeneraltso(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := GetLanguageDetails(ctx, "noext", []byte("hello world\n"), true)
+	unlockGeneraltso()
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	_, err = GetLanguageDetails(context.Background(), "noext", []byte("hello world\n"), true)
+	assert.NoError(err)
+}
+
+func TestMultipleCanceledPartialResults(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := NewStrategy("stop", func(ctx context.Context, blob *Blob, candidates []string) []string {
+		if blob.Filename == "second.go" {
+			cancel()
+		}
+		return nil
+	})
+	AddStrategy(stop, ModelineStrategyName)
+	defer RemoveStrategy("stop")
+	results, err := GetLanguageDetailsMultiple(ctx, []*File{
+		NewFile("first.go", []byte("package first\n")),
+		NewFile("second.go", []byte("package second\n")),
+		NewFile("third.go", []byte("package third\n")),
+	}, true)
+	assert.True(errors.Is(err, context.Canceled))
+	assert.Len(results, 1)
+	assert.Equal("Go", results[0].Result.Language.Name)
+}
@@ -0,0 +1,199 @@
+package linguist
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+)
+
+// TestFileRule identifies test files by the conventions of a language. A file is a test if its path
+// matches Path and its body matches Content. An empty Path or Content matches every file.
+type TestFileRule struct {
+	// Languages limits the rule to files of the languages, or it applies to all files if empty
+	Languages []string `json:"languages,omitempty" yaml:"languages,omitempty"`
+	// Path is a regular expression matched against the path of the file with forward slashes
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Content is a regular expression matched against the body of the file
+	Content string `json:"content,omitempty" yaml:"content,omitempty"`
+}
+
+func (r TestFileRule) String() string {
+	return fmt.Sprintf("TestFileRule<languages:%v,path:%v,content:%v>", r.Languages, r.Path, r.Content)
+}
+
+// equal returns true if the rules match the same files
+func (r TestFileRule) equal(o TestFileRule) bool {
+	return r.Path == o.Path && r.Content == o.Content && strings.Join(r.Languages, ",") == strings.Join(o.Languages, ",")
+}
+
+type testFileRule struct {
+	TestFileRule
+	languages map[string]bool
+	path      *regexp.Regexp
+	content   *regexp.Regexp
+}
+
+func compileTestFileRule(rule TestFileRule) (*testFileRule, error) {
+	if rule.Path == "" && rule.Content == "" {
+		return nil, fmt.Errorf("test file rule %s needs a path or content", rule)
+	}
+	r := &testFileRule{TestFileRule: rule, languages: make(map[string]bool)}
+	for _, l := range rule.Languages {
+		name := generaltso.LanguageByAlias(l)
+		if name == "" {
+			return nil, fmt.Errorf("test file rule %s has an unknown language %s", rule, l)
+		}
+		r.languages[name] = true
+	}
+	var err error
+	if rule.Path != "" {
+		if r.path, err = regexp.Compile(rule.Path); err != nil {
+			return nil, fmt.Errorf("test file rule %s: %v", rule, err)
+		}
+	}
+	if rule.Content != "" {
+		if r.content, err = regexp.Compile(rule.Content); err != nil {
+			return nil, fmt.Errorf("test file rule %s: %v", rule, err)
+		}
+	}
+	return r, nil
+}
+
+func (r *testFileRule) match(filename, language string, body []byte) bool {
+	if len(r.languages) > 0 && !r.languages[language] {
+		return false
+	}
+	if r.path != nil && !r.path.MatchString(filename) {
+		return false
+	}
+	return r.content == nil || r.content.Match(body)
+}
+
+// DefaultTestFileRules returns the built in rules for test files
+func DefaultTestFileRules() []TestFileRule {
+	javascript := []string{"JavaScript", "TypeScript", "JSX"}
+	jvm := []string{"Java", "Kotlin", "Scala", "Groovy"}
+	return []TestFileRule{
+		// directories of tests in any language
+		{Path: `(^|/)(__tests__|tests?|specs?)/`},
+		{Languages: []string{"Go"}, Path: `_test\.go$`},
+		{Languages: []string{"Go"}, Content: `(?m)^func (Test|Benchmark|Fuzz)\w*\(\w+ \*testing\.[TBF]\)`},
+		{Languages: []string{"Ruby"}, Path: `_(spec|test)\.rb$`},
+		{Languages: []string{"Ruby"}, Content: `RSpec\.describe|Minitest::Test|Test::Unit::TestCase`},
+		{Languages: []string{"Python"}, Path: `((^|/)test_[^/]*|_tests?)\.py$|(^|/)conftest\.py$`},
+		{Languages: []string{"Python"}, Content: `unittest\.TestCase|(?m)^(import|from) pytest\b`},
+		{Languages: javascript, Path: `\.(test|spec)\.[cm]?[jt]sx?$`},
+		{Languages: javascript, Content: "(?m)^\\s*(describe|it|test)\\(\\s*['\"`]"},
+		{Languages: jvm, Path: `(^|/)src/(test|androidTest|integrationTest)/`},
+		{Languages: jvm, Path: `[^/]Tests?\.(java|kt|scala|groovy)$`},
+		{Languages: jvm, Content: `(?m)^\s*@(Test|ParameterizedTest)\b`},
+		{Languages: []string{"Swift"}, Path: `(^|/)[^/]*Tests/|Tests?\.swift$`},
+		{Languages: []string{"Swift"}, Content: `(?m)^import XCTest\b`},
+		{Languages: []string{"C#"}, Path: `(^|/)[^/]*\.Tests?/|Tests?\.cs$`},
+		{Languages: []string{"C#"}, Content: `\[(Test|Fact|Theory|TestMethod)\]`},
+		{Languages: []string{"PHP"}, Path: `Test\.php$`},
+		{Languages: []string{"PHP"}, Content: `extends\s+(\\?PHPUnit\\Framework\\)?TestCase\b`},
+		{Languages: []string{"Rust"}, Path: `(^|/)tests/`},
+		{Languages: []string{"Elixir"}, Path: `_test\.exs$`},
+	}
+}
+
+var (
+	testFileRulesMu sync.RWMutex
+	testFileRules   []*testFileRule
+)
+
+func init() {
+	if err := SetTestFileRules(DefaultTestFileRules()); err != nil {
+		panic(err)
+	}
+}
+
+// TestFileRules returns a copy of the rules for test files
+func TestFileRules() []TestFileRule {
+	testFileRulesMu.RLock()
+	defer testFileRulesMu.RUnlock()
+	rules := make([]TestFileRule, 0, len(testFileRules))
+	for _, r := range testFileRules {
+		rules = append(rules, r.TestFileRule)
+	}
+	return rules
+}
+
+// SetTestFileRules replaces the rules for test files. If any rule is invalid, the rules are left unchanged.
+func SetTestFileRules(rules []TestFileRule) error {
+	compiled := make([]*testFileRule, 0, len(rules))
+	for _, rule := range rules {
+		r, err := compileTestFileRule(rule)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, r)
+	}
+	defer atomic.AddInt64(&rulesetGeneration, 1)
+	testFileRulesMu.Lock()
+	testFileRules = compiled
+	testFileRulesMu.Unlock()
+	return nil
+}
+
+// AddTestFileRule adds a rule for test files
+func AddTestFileRule(rule TestFileRule) error {
+	r, err := compileTestFileRule(rule)
+	if err != nil {
+		return err
+	}
+	defer atomic.AddInt64(&rulesetGeneration, 1)
+	testFileRulesMu.Lock()
+	testFileRules = append(testFileRules, r)
+	testFileRulesMu.Unlock()
+	return nil
+}
+
+// RemoveTestFileRule removes the rule for test files with the same languages and patterns, and returns false if there wasn't one
+func RemoveTestFileRule(rule TestFileRule) bool {
+	testFileRulesMu.Lock()
+	defer testFileRulesMu.Unlock()
+	for i, r := range testFileRules {
+		if r.equal(rule) {
+			testFileRules = append(testFileRules[:i:i], testFileRules[i+1:]...)
+			atomic.AddInt64(&rulesetGeneration, 1)
+			return true
+		}
+	}
+	return false
+}
+
+// IsTest returns true if the file of language is a test according to the rules for test files,
+// by the conventions of its path such as _test.go or __tests__/, or by its content such as
+// unittest.TestCase or @Test. The body may be nil to only check the path.
+func IsTest(filename, language string, body []byte) bool {
+	filename = NormalizePath(filename)
+	testFileRulesMu.RLock()
+	defer testFileRulesMu.RUnlock()
+	for _, r := range testFileRules {
+		if r.content != nil && body == nil {
+			continue
+		}
+		if r.match(filename, language, body) {
+			return true
+		}
+	}
+	return false
+}
+
+// testFileRulesVersion returns the rules for test files in a stable order for the ruleset version
+func testFileRulesVersion() []string {
+	rules := TestFileRules()
+	s := make([]string, 0, len(rules))
+	for _, r := range rules {
+		s = append(s, r.String())
+	}
+	sort.Strings(s)
+	return s
+}
@@ -0,0 +1,149 @@
+package linguist
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// restoreTestFileRules puts the default rules back after a test changes them
+func restoreTestFileRules(t *testing.T) {
+	if err := SetTestFileRules(DefaultTestFileRules()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsTestByPath(t *testing.T) {
+	assert := assert.New(t)
+	for _, tc := range [][2]string{
+		{"linguist_test.go", "Go"},
+		{"spec/models/user_spec.rb", "Ruby"},
+		{"lib/user_spec.rb", "Ruby"},
+		{"test_parser.py", "Python"},
+		{"pkg/parser_test.py", "Python"},
+		{"conftest.py", "Python"},
+		{"src/app.test.ts", "TypeScript"},
+		{"src/app.spec.jsx", "JavaScript"},
+		{"src/__tests__/app.js", "JavaScript"},
+		{"src/test/java/com/example/AppTest.java", "Java"},
+		{"app/src/androidTest/kotlin/Main.kt", "Kotlin"},
+		{"Tests/AppTests/AppTests.swift", "Swift"},
+		{"App.Tests/ParserTests.cs", "C#"},
+		{"tests/integration.rs", "Rust"},
+		{"test/user_test.exs", "Elixir"},
+	} {
+		assert.True(IsTest(tc[0], tc[1], nil), tc[0])
+	}
+	for _, tc := range [][2]string{
+		{"linguist.go", "Go"},
+		{"testing.go", "Go"},
+		{"lib/spec_helper.rb", "Ruby"},
+		{"src/contest.py", "Python"},
+		{"src/latest.ts", "TypeScript"},
+		{"src/main/java/com/example/App.java", "Java"},
+		{"Sources/App/App.swift", "Swift"},
+		{"src/attest/lib.rs", "Rust"},
+		// conventions only apply to their language
+		{"parser_test.py", "Go"},
+	} {
+		assert.False(IsTest(tc[0], tc[1], nil), tc[0])
+	}
+}
+
+func TestIsTestByContent(t *testing.T) {
+	assert := assert.New(t)
+	for _, tc := range []struct {
+		filename, language, body string
+	}{
+		{"check.go", "Go", "package check\n\nimport \"testing\"\n\nfunc TestCheck(t *testing.T) {}\n"},
+		{"checks.py", "Python", "import unittest\n\nclass CheckTest(unittest.TestCase):\n    pass\n"},
+		{"checks.py", "Python", "import pytest\n\ndef check_it():\n    pass\n"},
+		{"app.js", "JavaScript", "describe('app', () => {\n  it('works', () => {})\n})\n"},
+		{"Check.java", "Java", "class Check {\n  @Test\n  void works() {}\n}\n"},
+		{"user.rb", "Ruby", "RSpec.describe User do\nend\n"},
+		{"Check.swift", "Swift", "import XCTest\n\nclass Check: XCTestCase {}\n"},
+		{"Check.cs", "C#", "public class Check {\n  [Fact]\n  public void Works() {}\n}\n"},
+	} {
+		assert.True(IsTest(tc.filename, tc.language, []byte(tc.body)), tc.filename)
+		// content rules need the body
+		assert.False(IsTest(tc.filename, tc.language, nil), tc.filename)
+	}
+	for _, tc := range []struct {
+		filename, language, body string
+	}{
+		{"main.go", "Go", "package main\n\nimport \"testing\"\n\nvar _ = testing.Short\n"},
+		{"app.js", "JavaScript", "const describe = (x) => x;\nexport default describe;\n"},
+		{"app.py", "Python", "def test():\n    pass\n"},
+	} {
+		assert.False(IsTest(tc.filename, tc.language, []byte(tc.body)), tc.filename)
+	}
+}
+
+func TestTestFileRuleAPI(t *testing.T) {
+	assert := assert.New(t)
+	defer restoreTestFileRules(t)
+	assert.Equal(DefaultTestFileRules(), TestFileRules())
+	rule := TestFileRule{Languages: []string{"go"}, Path: `(^|/)e2e/`}
+	assert.False(IsTest("e2e/login.go", "Go", nil))
+	assert.NoError(AddTestFileRule(rule))
+	assert.True(IsTest("e2e/login.go", "Go", nil))
+	assert.False(IsTest("e2e/login.py", "Python", nil))
+	assert.True(RemoveTestFileRule(rule))
+	assert.False(RemoveTestFileRule(rule))
+	assert.False(IsTest("e2e/login.go", "Go", nil))
+
+	assert.Error(AddTestFileRule(TestFileRule{Languages: []string{"Go"}}))
+	assert.Error(AddTestFileRule(TestFileRule{Languages: []string{"NotALanguage"}, Path: "x"}))
+	assert.Error(AddTestFileRule(TestFileRule{Path: "("}))
+	assert.Error(AddTestFileRule(TestFileRule{Content: "("}))
+
+	assert.NoError(SetTestFileRules([]TestFileRule{{Path: `\.check$`}}))
+	assert.Len(TestFileRules(), 1)
+	assert.False(IsTest("linguist_test.go", "Go", nil))
+	// an invalid rule leaves the rules unchanged
+	assert.Error(SetTestFileRules([]TestFileRule{{Path: "x"}, {}}))
+	assert.Len(TestFileRules(), 1)
+}
+
+func TestDetectionIsTest(t *testing.T) {
+	assert := assert.New(t)
+	defer restoreTestFileRules(t)
+	d := NewDetector(WithCache(NewMemoryCache(100)))
+	for _, skip := range []bool{false, true} {
+		r, err := d.GetLanguageDetails(context.Background(), "pkg/parser_test.go", []byte("package pkg\n"), skip)
+		assert.NoError(err)
+		assert.True(r.Result.IsTest)
+		r, err = d.GetLanguageDetails(context.Background(), "pkg/parser.go", []byte("package pkg\n"), skip)
+		assert.NoError(err)
+		assert.False(r.Result.IsTest)
+	}
+	// changing the rules changes cached results
+	assert.NoError(AddTestFileRule(TestFileRule{Path: `(^|/)parser\.go$`}))
+	r, err := d.GetLanguageDetails(context.Background(), "pkg/parser.go", []byte("package pkg\n"))
+	assert.NoError(err)
+	assert.True(r.Result.IsTest)
+}
+
+func TestScanDirectoryTests(t *testing.T) {
+	assert := assert.New(t)
+	dir := writeTree(t, map[string]string{
+		"parser.go":      "package parser\n",
+		"parser_test.go": "package parser\n\nimport \"testing\"\n",
+		"app.js":         "console.log(1);\n",
+		"app.test.js":    "test('app', () => {});\n",
+	})
+	defer os.RemoveAll(dir)
+	stats, err := ScanDirectory(context.Background(), dir, nil)
+	assert.NoError(err)
+	files, bytes := stats.Tests()
+	assert.Equal(2, files)
+	assert.Equal(int64(len("package parser\n\nimport \"testing\"\n")+len("test('app', () => {});\n")), bytes)
+	files, bytes = stats.NonTests()
+	assert.Equal(2, files)
+	assert.Equal(int64(len("package parser\n")+len("console.log(1);\n")), bytes)
+	golang := stats.Language("Go")
+	assert.Equal(1, golang.TestFiles)
+	assert.Equal(int64(len("package parser\n\nimport \"testing\"\n")), golang.TestBytes)
+}
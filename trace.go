@@ -0,0 +1,229 @@
+package linguist
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+)
+
+// Span is one step of a detection, such as an exclusion check or a strategy
+type Span interface {
+	// SetAttribute records a detail of the step
+	SetAttribute(key string, value interface{})
+	// IsRecording returns false if attributes are thrown away, so that expensive ones can be skipped
+	IsRecording() bool
+	// End marks the end of the step
+	End()
+}
+
+// Tracer starts the spans of a detection. It has the shape of an OpenTelemetry tracer, so an
+// adapter only needs to wrap trace.Tracer.Start and the returned trace.Span.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// names of the spans started during a detection
+const (
+	SpanDetect          = "linguist.detect"
+	SpanExclusion       = "linguist.exclusion"
+	SpanCache           = "linguist.cache"
+	SpanPreoptimization = "linguist.preoptimization"
+	SpanStrategy        = "linguist.strategy."
+	SpanTokenize        = "linguist.tokenize"
+	SpanClassify        = "linguist.classify"
+)
+
+// the number of classifier scores recorded by a span
+const traceScores = 10
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(key string, value interface{}) {}
+func (nopSpan) IsRecording() bool                          { return false }
+func (nopSpan) End()                                       {}
+
+type tracerHolder struct {
+	t Tracer
+}
+
+var currentTracer atomic.Value
+
+func init() {
+	currentTracer.Store(tracerHolder{})
+}
+
+// SetTracer sets the Tracer which receives the spans of every detection. Tracing is off by default, and nil turns it off again.
+func SetTracer(t Tracer) {
+	currentTracer.Store(tracerHolder{t})
+}
+
+type spanKey struct{}
+type recorderKey struct{}
+
+// startSpan starts a span with the global tracer and the recorder of Explain, if there are any
+func startSpan(ctx context.Context, name string) (context.Context, Span) {
+	t := currentTracer.Load().(tracerHolder).t
+	rec, _ := ctx.Value(recorderKey{}).(*recorder)
+	if t == nil && rec == nil {
+		return ctx, nopSpan{}
+	}
+	var span Span = nopSpan{}
+	if t != nil {
+		ctx, span = t.Start(ctx, name)
+	}
+	if rec != nil {
+		span = rec.start(ctx, name, span)
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// spanFromContext returns the span started for ctx, which strategies use to record their details
+func spanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return nopSpan{}
+}
+
+// TraceStep is a step of a detection recorded by Explain
+type TraceStep struct {
+	Name string `json:"name"`
+	// Depth is the number of steps the step is nested in
+	Depth      int                    `json:"depth"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Duration   time.Duration          `json:"duration"`
+}
+
+// Explanation is the trace of a single detection returned by Explain
+type Explanation struct {
+	Path string `json:"path"`
+	// Steps are in the order they were started
+	Steps []*TraceStep `json:"steps"`
+	// Hints are the languages which list the filename or extension of the file
+	Hints []string `json:"hints,omitempty"`
+	// Tokens are the tokens passed to the classifier, if it was used
+	Tokens []string `json:"tokens,omitempty"`
+	// Scores are the best scores of the classifier, if it was used
+	Scores []generaltso.Score `json:"scores,omitempty"`
+	Result Result             `json:"result"`
+}
+
+// Step returns the first step with the name, or nil if there isn't one
+func (e *Explanation) Step(name string) *TraceStep {
+	for _, s := range e.Steps {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (e *Explanation) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s\n", e.Path)
+	for _, s := range e.Steps {
+		fmt.Fprintf(&sb, "%s%s (%v)", strings.Repeat("  ", s.Depth+1), s.Name, s.Duration)
+		keys := make([]string, 0, len(s.Attributes))
+		for k := range s.Attributes {
+			if k != "tokens" {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&sb, " %s=%v", k, s.Attributes[k])
+		}
+		sb.WriteByte('\n')
+	}
+	r := e.Result
+	switch {
+	case r.Result != nil && r.Result.Language != nil && r.Result.Language.Name != "":
+		fmt.Fprintf(&sb, "  result: %s by %s", r.Result.Language.Name, r.Result.Strategy)
+	case r.Result != nil:
+		fmt.Fprintf(&sb, "  result: unknown")
+	default:
+		fmt.Fprintf(&sb, "  result: none")
+	}
+	fmt.Fprintf(&sb, " (cached=%v excluded=%v binary=%v large=%v vendored=%v)\n", r.IsCached, r.IsExcluded, r.IsBinary, r.IsLarge, r.IsVendored)
+	return sb.String()
+}
+
+// recorder collects the spans of a detection for Explain
+type recorder struct {
+	mu    sync.Mutex
+	steps []*TraceStep
+}
+
+type recordedSpan struct {
+	rec   *recorder
+	step  *TraceStep
+	start time.Time
+	next  Span
+}
+
+func (r *recorder) start(ctx context.Context, name string, next Span) Span {
+	depth := 0
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		depth = parent.step.Depth + 1
+	}
+	step := &TraceStep{Name: name, Depth: depth, Attributes: make(map[string]interface{})}
+	r.mu.Lock()
+	r.steps = append(r.steps, step)
+	r.mu.Unlock()
+	return &recordedSpan{r, step, time.Now(), next}
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) {
+	s.rec.mu.Lock()
+	s.step.Attributes[key] = value
+	s.rec.mu.Unlock()
+	s.next.SetAttribute(key, value)
+}
+
+func (s *recordedSpan) IsRecording() bool {
+	return true
+}
+
+func (s *recordedSpan) End() {
+	s.rec.mu.Lock()
+	s.step.Duration = time.Since(s.start)
+	s.rec.mu.Unlock()
+	s.next.End()
+}
+
+// Explain detects the language of a file like GetLanguageDetails and returns a trace of every
+// step: the exclusion checks, the cache lookup, each strategy with the languages it returned,
+// the tokens and scores of the classifier and the final result. Pass skip to see the pipeline
+// for a file which would be answered from a cache.
+func (d *Detector) Explain(ctx context.Context, filename string, body []byte, skip ...bool) (*Explanation, error) {
+	filename = d.normalize(filename)
+	rec := &recorder{}
+	result, err := d.GetLanguageDetails(context.WithValue(ctx, recorderKey{}, rec), filename, body, skip...)
+	if err != nil {
+		return nil, err
+	}
+	e := &Explanation{
+		Path:   filename,
+		Steps:  rec.steps,
+		Hints:  d.Data().LanguageHints(filename),
+		Result: result,
+	}
+	if s := e.Step(SpanTokenize); s != nil {
+		e.Tokens, _ = s.Attributes["tokens"].([]string)
+	}
+	if s := e.Step(SpanClassify); s != nil {
+		e.Scores, _ = s.Attributes["scores"].([]generaltso.Score)
+	}
+	return e, nil
+}
+
+// Explain returns a trace of the detection of a file by the default detector
+func Explain(ctx context.Context, filename string, body []byte, skip ...bool) (*Explanation, error) {
+	return defaultDetector.Explain(ctx, filename, body, skip...)
+}
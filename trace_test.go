@@ -0,0 +1,150 @@
+package linguist
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainPipeline(t *testing.T) {
+	assert := assert.New(t)
+	e, err := Explain(context.Background(), "script", []byte("#!/usr/bin/env python3\nprint('hi')\n"), true)
+	assert.NoError(err)
+	assert.Equal("Python", e.Result.Result.Language.Name)
+	names := make([]string, 0, len(e.Steps))
+	for _, s := range e.Steps {
+		names = append(names, s.Name)
+	}
+	assert.Equal([]string{
+		SpanDetect,
+		SpanExclusion + ".binary",
+		SpanExclusion + ".large",
+		SpanExclusion + ".rule",
+		SpanExclusion + ".vendored",
+		SpanStrategy + ModelineStrategyName,
+		SpanStrategy + FilenameStrategyName,
+		SpanStrategy + ShebangStrategyName,
+		SpanExclusion + ".generated",
+		SpanExclusion + ".documentation",
+	}, names)
+	assert.Equal(0, e.Steps[0].Depth)
+	assert.Equal(1, e.Steps[1].Depth)
+	shebang := e.Step(SpanStrategy + ShebangStrategyName)
+	assert.Equal("python", shebang.Attributes["interpreter"])
+	assert.Equal([]string{"Python"}, shebang.Attributes["languages"])
+	assert.Equal("Python", e.Step(SpanDetect).Attributes["language"])
+	assert.Equal(ShebangStrategyName, e.Step(SpanDetect).Attributes["strategy"])
+	assert.Contains(e.String(), "result: Python by shebang")
+}
+
+func TestExplainClassifierAndHeuristics(t *testing.T) {
+	assert := assert.New(t)
+	e, err := Explain(context.Background(), "main.fs", []byte("let x = 1\n"), true)
+	assert.NoError(err)
+	assert.ElementsMatch([]string{"F#", "Forth", "GLSL", "Filterscript"}, e.Hints)
+	heuristics := e.Step(SpanStrategy + HeuristicsStrategyName)
+	assert.NotNil(heuristics)
+	assert.NotEmpty(heuristics.Attributes["tried"])
+
+	e, err = Explain(context.Background(), "noext", []byte("package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n"), true)
+	assert.NoError(err)
+	assert.NotEmpty(e.Tokens)
+	assert.NotEmpty(e.Scores)
+	assert.True(len(e.Scores) <= traceScores)
+	for i := 1; i < len(e.Scores); i++ {
+		assert.True(e.Scores[i-1].Score >= e.Scores[i].Score)
+	}
+	assert.Equal(2, e.Step(SpanTokenize).Depth)
+	assert.Equal(e.Result.Result.Language.Name, e.Step(SpanClassify).Attributes["language"])
+}
+
+func TestExplainExcludedAndCached(t *testing.T) {
+	assert := assert.New(t)
+	e, err := Explain(context.Background(), "node_modules/foo/index.js", []byte("x"))
+	assert.NoError(err)
+	assert.True(e.Result.IsExcluded)
+	assert.True(e.Result.IsVendored)
+	assert.Equal(true, e.Step(SpanExclusion + ".vendored").Attributes["excluded"])
+	assert.Nil(e.Step(SpanCache))
+
+	e, err = Explain(context.Background(), ".vscode/settings.json", []byte("{}"))
+	assert.NoError(err)
+	assert.True(e.Result.IsExcluded)
+	rule := e.Step(SpanExclusion + ".rule")
+	assert.Equal(true, rule.Attributes["excluded"])
+	assert.NotEmpty(rule.Attributes["rule"])
+	assert.Nil(e.Step(SpanCache))
+
+	d := NewDetector(WithCache(NewMemoryCache(100)))
+	body := []byte("int main() { return 0; }\n")
+	e, err = d.Explain(context.Background(), "main.c", body)
+	assert.NoError(err)
+	assert.Equal(false, e.Step(SpanCache).Attributes["hit"])
+	assert.Equal(true, e.Step(SpanPreoptimization).Attributes["matched"])
+	e, err = d.Explain(context.Background(), "main.c", body)
+	assert.NoError(err)
+	assert.Equal(true, e.Step(SpanCache).Attributes["hit"])
+	assert.Nil(e.Step(SpanPreoptimization))
+	assert.True(strings.Contains(e.String(), "cached=true"))
+}
+
+func TestExplainHintsFromData(t *testing.T) {
+	assert := assert.New(t)
+	data, err := ReadData(DataFiles{Languages: strings.NewReader(zigLanguages)}, DataMerge)
+	assert.NoError(err)
+	d := NewDetector(WithData(data))
+	e, err := d.Explain(context.Background(), "src/main.zig", []byte("const std = @import(\"std\");\n"), true)
+	assert.NoError(err)
+	assert.Equal([]string{"Zig"}, e.Hints)
+	assert.Equal([]string{"Zig"}, e.Step(SpanDetect).Attributes["hints"])
+	e, err = Explain(context.Background(), "src/main.zig", []byte("const std = @import(\"std\");\n"), true)
+	assert.NoError(err)
+	assert.Empty(e.Hints)
+}
+
+type testTracer struct {
+	mu    sync.Mutex
+	spans []string
+	ended int
+}
+
+type testSpan struct {
+	t    *testTracer
+	name string
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	t.spans = append(t.spans, name)
+	t.mu.Unlock()
+	return ctx, &testSpan{t, name}
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) {}
+func (s *testSpan) IsRecording() bool                          { return false }
+func (s *testSpan) End() {
+	s.t.mu.Lock()
+	s.t.ended++
+	s.t.mu.Unlock()
+}
+
+func TestTracer(t *testing.T) {
+	assert := assert.New(t)
+	tracer := &testTracer{}
+	SetTracer(tracer)
+	defer SetTracer(nil)
+	_, err := GetLanguageDetails(context.Background(), "Makefile", []byte("all:\n\techo hi\n"), true)
+	assert.NoError(err)
+	assert.Equal(SpanDetect, tracer.spans[0])
+	assert.Contains(tracer.spans, SpanStrategy+FilenameStrategyName)
+	assert.Equal(len(tracer.spans), tracer.ended)
+
+	// Explain records spans and still passes them on to the tracer
+	n := len(tracer.spans)
+	e, err := Explain(context.Background(), "Makefile", []byte("all:\n"), true)
+	assert.NoError(err)
+	assert.Equal(len(e.Steps), len(tracer.spans)-n)
+}
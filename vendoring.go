@@ -0,0 +1,70 @@
+package linguist
+
+import (
+	"sync/atomic"
+
+	generaltso "github.com/jhaynie/linguist/generaltso/linguist"
+)
+
+// VendoredPolicy controls what a Detector does with vendored files
+type VendoredPolicy int
+
+const (
+	// VendoredExclude excludes vendored files without detecting their language. This is the default.
+	VendoredExclude VendoredPolicy = iota
+	// VendoredFlag detects vendored files like any other file and flags them with IsVendored
+	VendoredFlag
+)
+
+func (p VendoredPolicy) String() string {
+	if p == VendoredFlag {
+		return "flag"
+	}
+	return "exclude"
+}
+
+// vendorRules are checked in addition to the vendor.yml rules of linguist
+var vendorRules = []Match{
+	NewMatcher(`(^|/)Godeps/`),
+}
+
+// IsVendored returns true if the file is third party code according to the vendor.yml rules of
+// linguist or a rule added with AddVendorRule
+func IsVendored(filename string) bool {
+	return isVendored(generaltso.CurrentData(), NormalizePath(filename))
+}
+
+// isVendored is IsVendored with the vendor.yml rules of data
+func isVendored(data *generaltso.Data, filename string) bool {
+	if data.IsVendored(filename) {
+		return true
+	}
+	for _, rule := range vendorRules {
+		if rule.MatchString(filename) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddVendorRule will add a rule for files which are vendored
+func AddVendorRule(match Match) {
+	defer atomic.AddInt64(&rulesetGeneration, 1)
+	vendorRules = append(vendorRules, match)
+}
+
+// RemoveVendorRule will remove the added match from the vendor rules
+func RemoveVendorRule(match Match) {
+	defer atomic.AddInt64(&rulesetGeneration, 1)
+	for i, m := range vendorRules {
+		if match == m {
+			vendorRules = append(vendorRules[:i], vendorRules[i+1:]...)
+			break
+		}
+	}
+}
+
+// SetVendoredPolicy sets what GetLanguageDetails does with vendored files
+func SetVendoredPolicy(p VendoredPolicy) {
+	defaultDetector.SetVendoredPolicy(p)
+}
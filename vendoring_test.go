@@ -0,0 +1,93 @@
+package linguist
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsVendored(t *testing.T) {
+	assert := assert.New(t)
+	for _, name := range []string{
+		"node_modules/left-pad/index.js",
+		"vendor/github.com/pkg/errors/errors.go",
+		"src/vendor/foo.c",
+		"Godeps/Godeps.json",
+		"dist/app.js",
+	} {
+		assert.True(IsVendored(name), name)
+	}
+	for _, name := range []string{"main.go", "src/vendors.go", "lib/godeps.rb"} {
+		assert.False(IsVendored(name), name)
+	}
+}
+
+func TestVendorRule(t *testing.T) {
+	assert := assert.New(t)
+	rule := NewMatcher(`^imported/`)
+	assert.False(IsVendored("imported/zlib/inflate.c"))
+	AddVendorRule(rule)
+	assert.True(IsVendored("imported/zlib/inflate.c"))
+	r, err := GetLanguageDetails(context.Background(), "imported/zlib/inflate.c", []byte("int x;\n"))
+	assert.NoError(err)
+	assert.True(r.IsExcluded)
+	assert.True(r.IsVendored)
+	RemoveVendorRule(rule)
+	assert.False(IsVendored("imported/zlib/inflate.c"))
+	r, err = GetLanguageDetails(context.Background(), "imported/zlib/inflate.c", []byte("int x;\n"))
+	assert.NoError(err)
+	assert.False(r.IsExcluded)
+}
+
+func TestVendoredExcluded(t *testing.T) {
+	assert := assert.New(t)
+	d := NewDetector(WithCache(NewMemoryCache(100)))
+	body := []byte("package errors\n")
+	for _, skip := range []bool{false, true} {
+		r, err := d.GetLanguageDetails(context.Background(), "vendor/github.com/pkg/errors/errors.go", body, skip)
+		assert.NoError(err)
+		assert.True(r.Success)
+		assert.True(r.IsExcluded)
+		assert.True(r.IsVendored)
+		assert.Nil(r.Result)
+	}
+	r := CheckPreoptimizationCache("vendor/github.com/pkg/errors/errors.go", body)
+	assert.True(r.IsExcluded)
+	assert.Nil(r.Result)
+}
+
+func TestVendoredFlag(t *testing.T) {
+	assert := assert.New(t)
+	d := NewDetector(WithCache(NewMemoryCache(100)), WithVendoredPolicy(VendoredFlag))
+	assert.Equal(VendoredFlag, d.VendoredPolicy())
+	for _, name := range []string{"vendor/github.com/pkg/errors/errors.go", "vendor/lib/script"} {
+		body := []byte("package errors\n")
+		if name == "vendor/lib/script" {
+			body = []byte("#!/usr/bin/env python3\nprint('hi')\n")
+		}
+		for _, skip := range []bool{false, true} {
+			r, err := d.GetLanguageDetails(context.Background(), name, body, skip)
+			assert.NoError(err)
+			assert.False(r.IsExcluded, name)
+			assert.True(r.IsVendored, name)
+			assert.True(r.Result.IsVendored, name)
+			assert.NotEmpty(r.Result.Language.Name, name)
+		}
+	}
+	r := checkPreoptimization("vendor/github.com/pkg/errors/errors.go", []byte("package errors\n"), true)
+	assert.True(r.Success)
+	assert.False(r.IsExcluded)
+	assert.True(r.Result.IsVendored)
+	assert.Equal("Go", r.Result.Language.Name)
+}
+
+func TestVendoredPolicyInvalidatesCache(t *testing.T) {
+	assert := assert.New(t)
+	d := NewDetector(WithCache(NewMemoryCache(100)))
+	version := d.cacheVersion()
+	d.SetVendoredPolicy(VendoredFlag)
+	assert.NotEqual(version, d.cacheVersion())
+	d.SetVendoredPolicy(VendoredExclude)
+	assert.Equal(version, d.cacheVersion())
+}